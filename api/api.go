@@ -0,0 +1,7 @@
+// Package api отдаёт исходники контрактов в рантайм (например, для регистрации в schema registry).
+package api
+
+import _ "embed"
+
+//go:embed orders/v1/orders.proto
+var OrdersProto string
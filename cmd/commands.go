@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/audit"
+	"github.com/RaikyD/wb-orders-service/internal/config"
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/kafka"
+	"github.com/RaikyD/wb-orders-service/internal/kafka/codec"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/migrate"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Служебные команды: wb-orders <команда> [флаги]. Без команды бинарь запускает сервис.
+var commands = map[string]func(cfg *config.Config, args []string) int{
+	"migrate-payloads": migratePayloads,
+	"consumer-rewind":  consumerRewind,
+	"dlq-list":         dlqList,
+	"dlq-redrive":      dlqRedrive,
+	"archive-orders":   archiveOrders,
+	"erase-customer":   eraseCustomer,
+}
+
+func runCommand(cfg *config.Config, name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\ncommands:\n", name)
+		for _, n := range slices.Sorted(maps.Keys(commands)) {
+			fmt.Fprintf(os.Stderr, "  %s\n", n)
+		}
+		return 2
+	}
+	return cmd(cfg, args)
+}
+
+// openDB — пул с применёнными миграциями; ошибки уже в логе
+func openDB(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+	if err := migrate.Up(cfg.MIGRATE_DB_STRING); err != nil {
+		logger.Warn("goose up failed", "err", err)
+		return nil, err
+	}
+	pool, err := pgxpool.New(ctx, cfg.DB_STRING)
+	if err != nil {
+		logger.Warn("pgxpool new failed", "err", err)
+		return nil, err
+	}
+	return pool, nil
+}
+
+// migratePayloads переписывает wb.orders.payload старых версий в domain.OrderSchemaVersion
+func migratePayloads(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("migrate-payloads", flag.ContinueOnError)
+	batch := fs.Int("batch", 500, "строк в одной транзакции")
+	dryRun := fs.Bool("dry-run", false, "только посчитать, ничего не писать")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *batch <= 0 {
+		fmt.Fprintln(os.Stderr, "-batch must be positive")
+		return 2
+	}
+
+	ctx := context.Background()
+	pool, err := openDB(ctx, cfg)
+	if err != nil {
+		return 1
+	}
+	defer pool.Close()
+
+	logger.Info("upgrading payloads", "target_version", domain.OrderSchemaVersion, "batch", *batch, "dry_run", *dryRun)
+	upgraded, broken, err := repository.NewOrderRepository(pool).UpgradePayloads(ctx, *batch, *dryRun)
+	logger.Info("payloads upgraded", "upgraded", upgraded, "broken", broken, "dry_run", *dryRun)
+	if err != nil {
+		logger.Warn("payload upgrade failed", "err", err)
+		return 1
+	}
+	if broken > 0 {
+		return 1
+	}
+	return 0
+}
+
+// consumerRewind перематывает группу пайплайна (-pipeline; без него — единственного).
+// Без -token только печатает план с токеном. С токеном применяет его, но Kafka примет коммит
+// лишь в пустую группу: сервис должен быть остановлен. На живом сервисе — POST /admin/consumer/rewind.
+func consumerRewind(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("consumer-rewind", flag.ContinueOnError)
+	mode := fs.String("mode", kafka.RewindEarliest, "earliest, timestamp или offsets")
+	ts := fs.String("timestamp", "", "RFC3339, для -mode timestamp")
+	offsets := fs.String("offsets", "", "partition=offset через запятую, для -mode offsets")
+	token := fs.String("token", "", "confirm_token из dry-run; без него ничего не меняется")
+	name := fs.String("pipeline", "", "имя пайплайна из KAFKA_PIPELINES_FILE; можно не указывать, если он один")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	p, err := pipeline(cfg, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	t := kafka.RewindTarget{Mode: *mode}
+	if *ts != "" {
+		v, err := time.Parse(time.RFC3339, *ts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-timestamp:", err)
+			return 2
+		}
+		t.Timestamp = v
+	}
+	if *offsets != "" {
+		t.Offsets = map[int]int64{}
+		for _, kv := range strings.Split(*offsets, ",") {
+			p, off, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			pi, err1 := strconv.Atoi(p)
+			oi, err2 := strconv.ParseInt(off, 10, 64)
+			if !ok || err1 != nil || err2 != nil {
+				fmt.Fprintf(os.Stderr, "-offsets: bad pair %q, expected partition=offset\n", kv)
+				return 2
+			}
+			t.Offsets[pi] = oi
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	admin := kafka.NewOffsetAdmin(cfg.KAFKA_BROKERS, p.Topic, p.Group)
+
+	var plan *kafka.RewindPlan
+	if *token == "" {
+		plan, err = admin.Plan(ctx, t)
+	} else {
+		plan, err = admin.Apply(ctx, t, *token)
+	}
+	if plan != nil {
+		printJSON(plan)
+	}
+	switch {
+	case errors.Is(err, kafka.ErrGroupActive):
+		fmt.Fprintln(os.Stderr, err, "- stop the service or use POST /admin/consumer/rewind on a paused instance")
+		return 1
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	case *token == "":
+		fmt.Fprintf(os.Stderr, "dry run: %d message(s) would be reprocessed, %d skipped; apply with -token %s\n",
+			plan.Reprocess, plan.Skip, plan.Token)
+	default:
+		logger.Info("consumer group rewound", "group", plan.Group, "topic", plan.Topic, "reprocess", plan.Reprocess, "skip", plan.Skip)
+	}
+	return 0
+}
+
+// pipeline — пайплайн по имени; пустое имя подходит, только если пайплайн один
+func pipeline(cfg *config.Config, name string) (config.Pipeline, error) {
+	ps, err := cfg.Pipelines()
+	if err != nil {
+		return config.Pipeline{}, err
+	}
+	names := make([]string, 0, len(ps))
+	for _, p := range ps {
+		if p.Name == name || (name == "" && len(ps) == 1) {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+	if name == "" {
+		return config.Pipeline{}, fmt.Errorf("-pipeline is required, one of: %s", strings.Join(names, ", "))
+	}
+	return config.Pipeline{}, fmt.Errorf("unknown pipeline %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// openDLQ — то же, что у сервиса: DLQ KAFKA_DLT, возврат в топики пайплайнов, журнал отправок в Postgres
+func openDLQ(ctx context.Context, cfg *config.Config) (*kafka.DLQAdmin, func(), error) {
+	ps, err := cfg.Pipelines()
+	if err != nil {
+		logger.Warn("pipelines config failed", "err", err)
+		return nil, nil, err
+	}
+	topics := make([]string, 0, len(ps))
+	for _, p := range ps {
+		topics = append(topics, p.Topic)
+	}
+
+	reg, err := codec.NewRegistry(cfg.SCHEMA_REGISTRY_URL)
+	if err != nil {
+		logger.Warn("schema registry init failed", "err", err)
+		return nil, nil, err
+	}
+	codecs, err := codec.NewSet(reg)
+	if err != nil {
+		logger.Warn("codecs init failed", "err", err)
+		return nil, nil, err
+	}
+	pool, err := openDB(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	a := kafka.NewDLQAdmin(cfg.KAFKA_BROKERS, cfg.KAFKA_DLT, topics, codecs, repository.NewDLQRepository(pool))
+	return a, func() { _ = a.Close(); pool.Close() }, nil
+}
+
+func dlqList(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("dlq-list", flag.ContinueOnError)
+	partition := fs.Int("partition", -1, "только эта партиция; -1 — все")
+	offset := fs.Int64("offset", 0, "с какого оффсета")
+	limit := fs.Int("limit", 100, "сколько сообщений, не больше 500")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	a, closeFn, err := openDLQ(ctx, cfg)
+	if err != nil {
+		return 1
+	}
+	defer closeFn()
+
+	q := kafka.DLQQuery{Offset: *offset, Limit: *limit}
+	if *partition >= 0 {
+		q.Partition = partition
+	}
+	msgs, err := a.List(ctx, q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return printJSON(msgs)
+}
+
+// dlqRedrive — как POST /admin/dlq/redrive; -messages "0:12,0:15" или -all
+func dlqRedrive(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("dlq-redrive", flag.ContinueOnError)
+	all := fs.Bool("all", false, "все сообщения DLQ")
+	messages := fs.String("messages", "", "partition:offset через запятую")
+	patch := fs.String("patch", "", "JSON Merge Patch заказа, @file — из файла")
+	force := fs.Bool("force", false, "отправить и уже отправленные")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	req := kafka.RedriveRequest{All: *all, Force: *force, Actor: "cli:" + os.Getenv("USER")}
+	if *messages != "" {
+		for _, kv := range strings.Split(*messages, ",") {
+			p, off, ok := strings.Cut(strings.TrimSpace(kv), ":")
+			pi, err1 := strconv.Atoi(p)
+			oi, err2 := strconv.ParseInt(off, 10, 64)
+			if !ok || err1 != nil || err2 != nil {
+				fmt.Fprintf(os.Stderr, "-messages: bad pair %q, expected partition:offset\n", kv)
+				return 2
+			}
+			req.Messages = append(req.Messages, repository.DLQKey{Partition: pi, Offset: oi})
+		}
+	}
+	if *patch != "" {
+		b := []byte(*patch)
+		if name, ok := strings.CutPrefix(*patch, "@"); ok {
+			var err error
+			if b, err = os.ReadFile(name); err != nil {
+				fmt.Fprintln(os.Stderr, "-patch:", err)
+				return 2
+			}
+		}
+		req.Patch = b
+	}
+
+	ctx := context.Background()
+	a, closeFn, err := openDLQ(ctx, cfg)
+	if err != nil {
+		return 1
+	}
+	defer closeFn()
+
+	results, err := a.Redrive(ctx, req)
+	printJSON(results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, r := range results {
+		if r.Status == kafka.RedriveFailed {
+			return 1
+		}
+	}
+	return 0
+}
+
+// archiveOrders — один прогон холодного архива, без ожидания ARCHIVE_INTERVAL
+func archiveOrders(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("archive-orders", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", cfg.ARCHIVE_OLDER_THAN, "архивировать заказы с date_created старше")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.ARCHIVE_PATH == "" {
+		fmt.Fprintln(os.Stderr, "ARCHIVE_PATH is not set")
+		return 2
+	}
+	cfg.ARCHIVE_OLDER_THAN = *olderThan
+
+	ctx := context.Background()
+	pool, err := openDB(ctx, cfg)
+	if err != nil {
+		return 1
+	}
+	defer pool.Close()
+
+	prot, err := openPII(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	arch, err := openArchive(cfg, repository.NewOrderRepository(pool).WithPII(prot), prot, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	n, err := arch.RunOnce(ctx)
+	if err != nil {
+		logger.Warn("archive failed", "err", err, "archived", n)
+		return 1
+	}
+	return printJSON(map[string]any{"archived": n, "older_than": olderThan.String()})
+}
+
+// eraseCustomer — то же, что DELETE /customers/{id}/personal-data, для запросов, пришедших мимо API.
+// Кэш запущенных инстансов этим не сбросить: он обновится при перезапуске или при следующей записи заказа
+func eraseCustomer(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("erase-customer", flag.ContinueOnError)
+	customer := fs.String("customer", "", "customer_id клиента")
+	tenant := fs.String("tenant", domain.DefaultTenant, "тенант клиента")
+	actor := fs.String("actor", os.Getenv("USER"), "кто стирает, для журнала")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if strings.TrimSpace(*customer) == "" {
+		fmt.Fprintln(os.Stderr, "-customer is required")
+		return 2
+	}
+	if !domain.ValidTenant(*tenant) {
+		fmt.Fprintf(os.Stderr, "bad -tenant %q\n", *tenant)
+		return 2
+	}
+
+	ctx := context.Background()
+	pool, err := openDB(ctx, cfg)
+	if err != nil {
+		return 1
+	}
+	defer pool.Close()
+
+	e, err := repository.NewOrderRepository(pool).EraseCustomer(ctx, *tenant, *customer, *actor, repository.ErasureSourceCLI)
+	if err != nil {
+		logger.Warn("erase customer failed", "err", err, "customer_id", *customer, "tenant", *tenant)
+		return 1
+	}
+
+	// в журнал доступа пишем сразу, без фоновой очереди: процесс сейчас завершится
+	entries := make([]repository.AuditEntry, 0, len(e.OrderUIDs))
+	for _, uid := range e.OrderUIDs {
+		entries = append(entries, repository.AuditEntry{
+			Tenant: *tenant, At: e.ErasedAt, Actor: *actor, Action: audit.ActionErase,
+			OrderUID: uid, RequestID: e.ID.String(), Source: audit.SourceAdmin, Fields: audit.ErasedFields,
+		})
+	}
+	if err := repository.NewAuditRepository(pool).InsertAudit(ctx, entries); err != nil {
+		logger.Warn("audit write failed", "err", err, "erasure_id", e.ID)
+	}
+	return printJSON(e)
+}
+
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -2,34 +2,81 @@ package main
 
 import (
 	"context"
+	"github.com/RaikyD/wb-orders-service/internal/grpcapi"
 	"github.com/RaikyD/wb-orders-service/internal/kafka"
+	"github.com/RaikyD/wb-orders-service/internal/kafka/codec"
 	"github.com/RaikyD/wb-orders-service/internal/migrate"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
 	kfk "github.com/segmentio/kafka-go"
 	//"github.com/joho/godotenv"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/archive"
+	"github.com/RaikyD/wb-orders-service/internal/audit"
 	"github.com/RaikyD/wb-orders-service/internal/config"
+	"github.com/RaikyD/wb-orders-service/internal/domain"
 	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/partitions"
+	"github.com/RaikyD/wb-orders-service/internal/pii"
 	"github.com/RaikyD/wb-orders-service/internal/presentation"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/idempotency"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/masking"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/openapi"
 	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/RaikyD/wb-orders-service/internal/webhooks"
 )
 
+// потолок на обычный HTTP-запрос; на него же рассчитана аренда Idempotency-Key
+const requestTimeout = 60 * time.Second
+
 func main() {
 	//_ = godotenv.Load()
 	logger.Init()
 	cfg, err := config.LoadConfig()
-	logger.Info("kafka config", "brokers", cfg.KAFKA_BROKERS, "topic", cfg.KAFKA_TOPIC, "group", cfg.KAFKA_GROUP_ID)
-
 	if err != nil {
 		logger.Warn("config load failed", "err", err)
 		os.Exit(1)
 	}
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1], os.Args[2:]))
+	}
+
+	pipelines, err := cfg.Pipelines()
+	if err != nil {
+		logger.Warn("pipelines config failed", "err", err)
+		os.Exit(1)
+	}
+	topics := make([]string, 0, len(pipelines))
+	for _, p := range pipelines {
+		topics = append(topics, p.Topic)
+	}
+	logger.Info("kafka config", "brokers", cfg.KAFKA_BROKERS, "topics", topics, "pipelines", len(pipelines))
+
+	authn, err := auth.NewAuthenticator(auth.Config{
+		Enabled:     cfg.AUTH_ENABLED,
+		APIKeysFile: cfg.AUTH_API_KEYS_FILE,
+		HS256Secret: cfg.AUTH_JWT_HS256_SECRET,
+		JWKSFile:    cfg.AUTH_JWKS_FILE,
+		JWTIssuer:   cfg.AUTH_JWT_ISSUER,
+		JWTAudience: cfg.AUTH_JWT_AUDIENCE,
+	})
+	if err != nil {
+		logger.Warn("auth init failed", "err", err)
+		os.Exit(1)
+	}
+	if !cfg.AUTH_ENABLED {
+		logger.Warn("auth is DISABLED, every endpoint is open")
+	}
 
 	// DB pool
 	pool, err := pgxpool.New(context.Background(), cfg.DB_STRING)
@@ -39,7 +86,7 @@ func main() {
 	}
 	defer pool.Close()
 
-	if err := migrate.Up(cfg.DB_STRING); err != nil {
+	if err := migrate.Up(cfg.MIGRATE_DB_STRING); err != nil {
 		logger.Warn("goose up failed", "err", err)
 		os.Exit(1)
 	}
@@ -50,10 +97,79 @@ func main() {
 		os.Exit(1)
 	}
 	logger.Info("db connected")
+	warnBypassRLS(pool)
 
-	repo := repository.NewOrderRepository(pool)
+	// DDL партиций (detach/drop/перенос в архив) — от владельца схемы, у роли сервиса таких прав нет
+	ownerPool := pool
+	if cfg.MIGRATE_DB_STRING != cfg.DB_STRING {
+		ownerPool, err = pgxpool.New(context.Background(), cfg.MIGRATE_DB_STRING)
+		if err != nil {
+			logger.Warn("pgxpool new failed", "dsn", "MIGRATE_DB_STRING", "err", err)
+			os.Exit(1)
+		}
+		defer ownerPool.Close()
+	}
+
+	prot, err := openPII(cfg)
+	if err != nil {
+		logger.Warn("pii keys load failed", "err", err)
+		os.Exit(1)
+	}
+	repo := repository.NewOrderRepository(pool).WithPII(prot)
+	if prot != nil {
+		// старым ключом или открытым текстом записанное перешифровываем в фоне
+		go pii.RunRotation(context.Background(), repo, cfg.PII_ROTATE_INTERVAL, cfg.PII_ROTATE_BATCH)
+	} else {
+		logger.Warn("PII_KEYS_FILE is not set, delivery contacts are stored in plaintext")
+	}
 	svc := application.NewOrdersService(repo)
 
+	// журнал доступа: кто читал и менял заказы; пишется в фоне пачками
+	auditRepo := repository.NewAuditRepository(pool)
+	auditLog := audit.New(auditRepo, cfg.AUDIT_BUFFER)
+	go auditLog.Run(context.Background())
+	svc.SetAudit(auditLog)
+
+	// что из контактов доставки и оплаты видно без scope orders:pii и что уходит подписчикам вебхуков
+	mask, err := masking.Load(cfg.PII_MASKING_FILE)
+	if err != nil {
+		logger.Warn("masking rules load failed", "err", err)
+		os.Exit(1)
+	}
+
+	// вебхуки: события кладутся в очередь в Postgres, диспетчер разносит их подписчикам
+	hooks := repository.NewWebhookRepository(pool)
+	svc.AddSink(webhooks.NewQueue(hooks, mask.Webhook().Apply))
+	go webhooks.NewDispatcher(hooks, webhooks.Config{
+		Timeout:      cfg.WEBHOOK_TIMEOUT,
+		MaxAge:       cfg.WEBHOOK_MAX_AGE,
+		DisableAfter: cfg.WEBHOOK_DISABLE_AFTER,
+	}).Run(context.Background())
+
+	// помесячные партиции заказов: будущие заводим заранее, старые убираем по сроку хранения
+	partCfg := partitions.Config{
+		Interval:        cfg.PARTITION_CHECK_INTERVAL,
+		PremakeMonths:   cfg.PARTITION_PREMAKE_MONTHS,
+		RetentionMonths: cfg.ORDERS_RETENTION_MONTHS,
+		RetentionMode:   cfg.ORDERS_RETENTION_MODE,
+	}
+	if err := partCfg.Validate(); err != nil {
+		logger.Warn("bad partition config", "err", err)
+		os.Exit(1)
+	}
+	go partitions.NewMaintainer(repository.NewPartitionRepository(ownerPool), partCfg, svc.Forget).Run(context.Background())
+
+	// холодный архив: старые заказы уезжают в файлы, GET по uid находит их и там
+	if cfg.ARCHIVE_PATH != "" {
+		arch, err := openArchive(cfg, repo, prot, svc.Forget)
+		if err != nil {
+			logger.Warn("archive init failed", "err", err)
+			os.Exit(1)
+		}
+		svc.SetArchive(arch)
+		go arch.Run(context.Background())
+	}
+
 	if err := svc.RestoreCache(context.Background(), 1000); err != nil {
 		logger.Warn("restore cache failed", "err", err)
 	}
@@ -62,42 +178,173 @@ func main() {
 	conn, err := d.DialContext(context.Background(), "tcp", "wb-kafka:9092") // "wb-kafka:9092"
 	if err == nil {
 		defer conn.Close()
+		for _, t := range topics {
+			_ = conn.CreateTopics(kfk.TopicConfig{
+				Topic: t, NumPartitions: 1, ReplicationFactor: 1,
+			})
+		}
 		_ = conn.CreateTopics(kfk.TopicConfig{
-			Topic: "orders", NumPartitions: 1, ReplicationFactor: 1,
+			Topic: cfg.KAFKA_DLT, NumPartitions: 1, ReplicationFactor: 1,
 		})
 		_ = conn.CreateTopics(kfk.TopicConfig{
-			Topic: "orders.dlq", NumPartitions: 1, ReplicationFactor: 1,
+			Topic: cfg.KAFKA_EVENTS, NumPartitions: 1, ReplicationFactor: 1,
 		})
 	} else {
 		logger.Warn("kafka admin dial failed", "err", err)
 	}
 
-	var prod *kafka.Producer
-	prod = kafka.NewProducer(cfg.KAFKA_BROKERS, cfg.KAFKA_TOPIC)
-	defer prod.Close()
+	reg, err := codec.NewRegistry(cfg.SCHEMA_REGISTRY_URL)
+	if err != nil {
+		logger.Warn("schema registry init failed", "err", err)
+		os.Exit(1)
+	}
+	codecs, err := codec.NewSet(reg)
+	if err != nil {
+		logger.Warn("codecs init failed", "err", err)
+		os.Exit(1)
+	}
+	// заказы из API пишутся в топик пайплайна своего тенанта, в его формате
+	prods := kafka.Producers{}
+	for _, p := range pipelines {
+		enc, err := codecs.For(p.ContentType)
+		if err != nil {
+			logger.Warn("bad pipeline content_type", "err", err, "pipeline", p.Name)
+			os.Exit(1)
+		}
+		prods[p.Tenant] = kafka.NewProducer(cfg.KAFKA_BROKERS, p.Topic, enc)
+	}
+	defer prods.Close()
+
+	dlq := kafka.NewDeadLetter(cfg.KAFKA_BROKERS, cfg.KAFKA_DLT)
+	defer dlq.Close()
+	dlqAdmin := kafka.NewDLQAdmin(cfg.KAFKA_BROKERS, cfg.KAFKA_DLT, topics, codecs, repository.NewDLQRepository(pool))
+	defer dlqAdmin.Close()
 
-	_, _ = kafka.StartConsumer(
-		context.Background(),
-		svc,
-		kafka.ConsumerConfig{
-			Brokers: cfg.KAFKA_BROKERS,
-			Topic:   cfg.KAFKA_TOPIC,
-			GroupID: cfg.KAFKA_GROUP_ID,
-		},
+	outbox := repository.NewOutboxRepository(pool)
+	relay := kafka.NewOutboxRelay(outbox, cfg.KAFKA_BROKERS, cfg.KAFKA_EVENTS)
+	defer relay.Close()
+	go relay.Run(context.Background())
+
+	var (
+		consumers []presentation.ConsumerControl
+		lagChecks []presentation.LagReporter
 	)
+	for _, p := range pipelines {
+		consumer, err := kafka.StartConsumer(
+			context.Background(),
+			svc,
+			kafka.ConsumerConfig{
+				Name:        p.Name,
+				Brokers:     cfg.KAFKA_BROKERS,
+				Topic:       p.Topic,
+				GroupID:     p.Group,
+				Tenant:      p.Tenant,
+				ContentType: p.ContentType,
+				Validation:  domain.ValidationProfile(p.Validation),
+				Outbox:      outbox,
+				Codecs:      codecs,
+				DeadLetter:  dlq,
+				Lag: kafka.LagThresholds{
+					Interval:    cfg.KAFKA_LAG_CHECK_INTERVAL,
+					MaxMessages: cfg.KAFKA_LAG_MAX_MESSAGES,
+					MaxDelay:    cfg.KAFKA_LAG_MAX_DELAY,
+				},
+			},
+		)
+		if err != nil {
+			logger.Warn("kafka consumer start failed", "err", err, "pipeline", p.Name)
+			os.Exit(1)
+		}
+		consumers = append(consumers, consumer)
+		lagChecks = append(lagChecks, consumer)
+	}
+
+	defRate, err := limits.ParseRate(cfg.RATE_LIMIT_DEFAULT)
+	if err != nil {
+		logger.Warn("bad RATE_LIMIT_DEFAULT", "err", err)
+		os.Exit(1)
+	}
+	routeRates, err := limits.ParseRouteRates(cfg.RATE_LIMIT_ROUTES)
+	if err != nil {
+		logger.Warn("bad RATE_LIMIT_ROUTES", "err", err)
+		os.Exit(1)
+	}
+	routeSizes, err := limits.ParseRouteSizes(cfg.HTTP_ROUTE_MAX_BODY)
+	if err != nil {
+		logger.Warn("bad HTTP_ROUTE_MAX_BODY", "err", err)
+		os.Exit(1)
+	}
+	lim := limits.New(limits.Config{
+		RateLimitEnabled: cfg.RATE_LIMIT_ENABLED,
+		DefaultRate:      defRate,
+		RouteRates:       routeRates,
+		MaxBodyBytes:     cfg.HTTP_MAX_BODY_BYTES,
+		RouteMaxBody:     routeSizes,
+	})
+
+	idem := idempotency.NewGuard(repository.NewIdempotencyRepository(pool), cfg.IDEMPOTENCY_TTL, requestTimeout)
+	go idem.RunCleanup(context.Background(), 10*time.Minute)
+
+	spec, err := openapi.Load()
+	if err != nil {
+		logger.Warn("openapi load failed", "err", err)
+		os.Exit(1)
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(lim.MaxBody)
+	r.Use(authn.Middleware)
+	r.Use(auth.Tenants)
+	r.Use(auth.AuditContext)
+	// только после authn.Middleware: без принципала валидатор пропускает закрытые операции
+	// к RequireScope, и аноним получает 401, а не 400
+	if cfg.OPENAPI_VALIDATE {
+		r.Use(spec.Validate)
+	}
 
-	h := presentation.NewOrdersHandler(*svc, prod)
-	h.Register(r)
+	h := presentation.NewOrdersHandler(svc, prods, lim, idem, mask)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(requestTimeout))
+		h.Register(r)
+		presentation.NewWebhooksHandler(hooks, lim).Register(r)
+		presentation.NewConsumerHandler(consumers, lim).Register(r)
+		presentation.NewDLQHandler(dlqAdmin, lim).Register(r)
+		presentation.NewAuditHandler(auditRepo, lim).Register(r)
+		presentation.NewHealthHandler(pool, lagChecks).Register(r)
+		spec.Mount(r)
+	})
+	// SSE и websocket живут дольше любого таймаута, поэтому вне группы с middleware.Timeout
+	h.RegisterStreams(r)
+	presentation.NewSocketHandler(svc, lim, cfg.WS_MAX_SUBSCRIPTIONS, splitList(cfg.WS_ALLOWED_ORIGINS), mask).Register(r)
+
+	// роут без описания в openapi.json ловит TestCheckRoutes; здесь — страховка, если тесты не гоняли
+	if err := spec.CheckRoutes(r); err != nil {
+		logger.Warn("openapi check failed", "err", err)
+		os.Exit(1)
+	}
 
 	presentation.MountStatic(r)
 
+	// gRPC на своём порту, поверх тех же сервиса и продьюсера
+	grpcAddr := ":" + cfg.GRPC_PORT
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		logger.Warn("grpc listen failed", "err", err, "addr", grpcAddr)
+		os.Exit(1)
+	}
+	gs := grpcapi.NewGRPCServer(grpcapi.NewServer(svc, prods, mask), authn)
+	go func() {
+		logger.Info("starting grpc", "addr", grpcAddr)
+		if err := gs.Serve(lis); err != nil {
+			logger.Warn("grpc server crashed", "err", err)
+			os.Exit(1)
+		}
+	}()
+
 	addr := ":" + cfg.HTTP_PORT
 	logger.Info("starting http", "addr", addr)
 	if err := http.ListenAndServe(addr, r); err != nil {
@@ -105,3 +352,56 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// openPII — шифрование доставки из PII_KEYS_FILE; nil — файл не задан
+func openPII(cfg *config.Config) (*pii.Protector, error) {
+	if cfg.PII_KEYS_FILE == "" {
+		return nil, nil
+	}
+	keys, index, err := pii.LoadKeyFile(cfg.PII_KEYS_FILE)
+	if err != nil {
+		return nil, err
+	}
+	return pii.New(keys, index), nil
+}
+
+// warnBypassRLS — суперпользователь и BYPASSRLS не видят политик tenant_isolation,
+// изоляция тенантов тогда держится только на коде
+func warnBypassRLS(pool *pgxpool.Pool) {
+	var role string
+	var bypass bool
+	err := pool.QueryRow(context.Background(),
+		`SELECT rolname, rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&role, &bypass)
+	if err != nil {
+		logger.Warn("db role check failed", "err", err)
+		return
+	}
+	if bypass {
+		logger.Warn("DB_STRING role bypasses row level security, tenants are not isolated in the database", "role", role)
+	}
+}
+
+func openArchive(cfg *config.Config, orders *repository.OrderRepository, prot *pii.Protector, forget func(time.Time)) (*archive.Archiver, error) {
+	if cfg.ARCHIVE_BATCH <= 0 || cfg.ARCHIVE_OLDER_THAN <= 0 {
+		return nil, fmt.Errorf("ARCHIVE_BATCH and ARCHIVE_OLDER_THAN must be positive")
+	}
+	files, err := archive.OpenStorage(cfg.ARCHIVE_PATH)
+	if err != nil {
+		return nil, err
+	}
+	return archive.New(repository.NewArchiveRepository(orders), files, archive.Config{
+		Interval:  cfg.ARCHIVE_INTERVAL,
+		OlderThan: cfg.ARCHIVE_OLDER_THAN,
+		Batch:     cfg.ARCHIVE_BATCH,
+	}, forget).WithPII(prot), nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
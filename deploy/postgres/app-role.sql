@@ -0,0 +1,29 @@
+-- Роль сервиса wb_app: не суперпользователь и без BYPASSRLS, иначе политики tenant_isolation
+-- (миграция tenant_rls) на неё не действуют. Схемой владеет wb — под ним идут только миграции
+-- и DDL партиций (MIGRATE_DB_STRING). Пароль — только для локального стенда.
+--
+-- В docker-compose выполняется при первой инициализации тома. На уже инициализированном
+-- томе — руками, скрипт можно запускать повторно:
+--   docker compose exec -T postgres psql -U wb -d wborders < deploy/postgres/app-role.sql
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'wb_app') THEN
+    CREATE ROLE wb_app LOGIN PASSWORD 'wbapppass' NOSUPERUSER NOBYPASSRLS NOCREATEDB NOCREATEROLE;
+  END IF;
+END $$;
+
+-- всё, что миграции заведут потом
+ALTER DEFAULT PRIVILEGES FOR ROLE wb GRANT USAGE ON SCHEMAS TO wb_app;
+ALTER DEFAULT PRIVILEGES FOR ROLE wb GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO wb_app;
+ALTER DEFAULT PRIVILEGES FOR ROLE wb GRANT USAGE, SELECT ON SEQUENCES TO wb_app;
+
+-- и то, что уже есть
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = 'wb') THEN
+    GRANT USAGE ON SCHEMA wb TO wb_app;
+    GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA wb TO wb_app;
+    GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA wb TO wb_app;
+  END IF;
+END $$;
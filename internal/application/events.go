@@ -0,0 +1,156 @@
+package application
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+)
+
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+)
+
+// Event — то, что уходит подписчикам (SSE и т.п.) после успешного изменения заказа
+type Event struct {
+	ID    uint64
+	Type  string
+	At    time.Time
+	Order *domain.Order
+}
+
+type Subscription struct {
+	C chan Event
+
+	bus    *EventBus
+	filter func(Event) bool
+	// lagged закрывается, если подписчик не успевал читать и его отключили
+	lagged chan struct{}
+	once   sync.Once
+}
+
+// Lagged — канал закрыт, если подписку отключили из-за переполнения буфера
+func (s *Subscription) Lagged() <-chan struct{} {
+	return s.lagged
+}
+
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// EventBus — простая шина в памяти: рассылает события подписчикам и держит
+// кольцевой буфер последних событий, чтобы переподключившийся клиент мог догнать пропущенное.
+type EventBus struct {
+	mu     sync.RWMutex
+	seq    uint64
+	ring   []Event
+	next   int
+	filled bool
+	subs   map[*Subscription]struct{}
+}
+
+func NewEventBus(history int) *EventBus {
+	return &EventBus{
+		ring: make([]Event, history),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+func (b *EventBus) Publish(typ string, o *domain.Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	ev := Event{ID: b.seq, Type: typ, At: time.Now().UTC(), Order: o}
+
+	if len(b.ring) > 0 {
+		b.ring[b.next] = ev
+		b.next = (b.next + 1) % len(b.ring)
+		if b.next == 0 {
+			b.filled = true
+		}
+	}
+
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(ev) {
+			continue
+		}
+		select {
+		case s.C <- ev:
+		default:
+			// медленный клиент: не блокируем шину, а отключаем его.
+			// Он переподключится с Last-Event-ID и доберёт хвост из буфера.
+			delete(b.subs, s)
+			s.once.Do(func() { close(s.lagged) })
+		}
+	}
+}
+
+// Subscribe подписывает на новые события. При resume сначала возвращает события
+// после lastID из буфера; complete=false значит, что часть истории уже вытеснена.
+func (b *EventBus) Subscribe(lastID uint64, resume bool, buffer int, filter func(Event) bool) (sub *Subscription, backlog []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		C:      make(chan Event, buffer),
+		bus:    b,
+		filter: filter,
+		lagged: make(chan struct{}),
+	}
+	b.subs[sub] = struct{}{}
+
+	complete = true
+	if !resume {
+		return sub, nil, complete
+	}
+	if lastID > b.seq {
+		// id из прошлой жизни процесса — история недостоверна
+		return sub, nil, false
+	}
+
+	history := b.history()
+	if lastID < b.seq && (len(history) == 0 || history[0].ID > lastID+1) {
+		complete = false
+	}
+	for _, ev := range history {
+		if ev.ID > lastID && (filter == nil || filter(ev)) {
+			backlog = append(backlog, ev)
+		}
+	}
+	return sub, backlog, complete
+}
+
+func (b *EventBus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	delete(b.subs, s)
+	b.mu.Unlock()
+}
+
+// RedactCustomer обезличивает доставку в заказах клиента тенанта, которые ещё лежат в кольце:
+// иначе докачка по Last-Event-ID отдала бы данные, уже стёртые в базе. События остаются на месте,
+// чтобы не рвать нумерацию; заказ подменяется копией, исходный мог попасть в кэш
+func (b *EventBus) RedactCustomer(tenant, customerID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, ev := range b.ring {
+		o := ev.Order
+		if o == nil || o.Tenant != tenant || o.CustomerID != customerID {
+			continue
+		}
+		c := *o
+		c.Delivery = c.Delivery.Anonymized()
+		b.ring[i].Order = &c
+	}
+}
+
+// history — содержимое кольца от старых к новым, вызывать под локом
+func (b *EventBus) history() []Event {
+	if !b.filled {
+		return append([]Event(nil), b.ring[:b.next]...)
+	}
+	out := make([]Event, 0, len(b.ring))
+	out = append(out, b.ring[b.next:]...)
+	return append(out, b.ring[:b.next]...)
+}
@@ -2,25 +2,52 @@ package application
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"github.com/RaikyD/wb-orders-service/internal/audit"
 	"github.com/RaikyD/wb-orders-service/internal/domain"
 	"github.com/RaikyD/wb-orders-service/internal/logger"
 	"github.com/RaikyD/wb-orders-service/internal/repository"
 	"github.com/google/uuid"
 	"sync"
+	"time"
 )
 
 type OrdersService struct {
-	repo  repository.OrderRepo
-	mu    sync.RWMutex
-	byUID map[string]*domain.Order
+	repo    repository.OrderRepo
+	mu      sync.RWMutex
+	byUID   map[orderKey]*domain.Order
+	events  *EventBus
+	sinks   []EventSink
+	archive ArchiveReader
+	audit   *audit.Log
+}
+
+// orderKey — order_uid уникален только в пределах тенанта, кэш тоже делим по тенантам
+type orderKey struct {
+	tenant string
+	uid    string
+}
+
+func keyOf(o *domain.Order) orderKey {
+	return orderKey{tenant: o.Tenant, uid: o.OrderUID}
+}
+
+// EventSink — надёжный получатель событий (очередь вебхуков и т.п.).
+// В отличие от EventBus вызывается синхронно, ошибка только логируется: заказ уже сохранён.
+type EventSink interface {
+	Enqueue(ctx context.Context, typ string, o *domain.Order) error
+}
+
+// ArchiveReader — холодный архив заказов, ушедших из Postgres
+type ArchiveReader interface {
+	Lookup(ctx context.Context, tenant, uid string) (*domain.Order, error)
 }
 
 func NewOrdersService(r repository.OrderRepo) *OrdersService {
 	return &OrdersService{
-		repo:  r,
-		byUID: make(map[string]*domain.Order),
+		repo:   r,
+		byUID:  make(map[orderKey]*domain.Order),
+		events: NewEventBus(512),
 	}
 }
 
@@ -28,7 +55,74 @@ func (s *OrdersService) Repo() repository.OrderRepo {
 	return s.repo
 }
 
-var ErrOrderAlreadyExists = errors.New("order already exists")
+// AddSink подключает получателя событий; вызывать до старта консьюмера и HTTP
+func (s *OrdersService) AddSink(sink EventSink) {
+	s.sinks = append(s.sinks, sink)
+}
+
+// SetArchive подключает архив, в который GetbyUID смотрит, если в базе заказа нет
+func (s *OrdersService) SetArchive(a ArchiveReader) {
+	s.archive = a
+}
+
+// SetAudit подключает журнал доступа: чтения и изменения заказов через сервис пишутся в него
+func (s *OrdersService) SetAudit(l *audit.Log) {
+	s.audit = l
+}
+
+// Audit — журнал доступа; nil, если не подключён (Record у nil ничего не делает)
+func (s *OrdersService) Audit() *audit.Log {
+	return s.audit
+}
+
+// RecordStreamed — заказ ушёл клиенту по подписке (SSE, WebSocket, gRPC WatchOrders).
+// Для журнала доступа это то же чтение, что и по uid, поэтому пишем после каждой доставки
+func (s *OrdersService) RecordStreamed(ctx context.Context, tenant, uid string) {
+	s.audit.Record(ctx, audit.ActionStream, tenant, uid)
+}
+
+// Events — шина событий о сохранённых заказах (для SSE и прочих подписчиков)
+func (s *OrdersService) Events() *EventBus {
+	return s.events
+}
+
+var ErrOrderAlreadyExists = domain.ErrOrderAlreadyExists
+
+var ErrListNotSupported = errors.New("list not supported")
+
+type briefLister interface {
+	ListOrdersBrief(ctx context.Context, tenant string, limit, offset int) ([]repository.OrderBrief, error)
+}
+
+// ListBrief — короткий список заказов тенанта для UI/API; не все реализации репозитория его умеют
+func (s *OrdersService) ListBrief(ctx context.Context, tenant string, limit, offset int) ([]repository.OrderBrief, error) {
+	repo, ok := s.repo.(briefLister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	return repo.ListOrdersBrief(ctx, tenant, limit, offset)
+}
+
+type contactLister interface {
+	ListOrdersByContact(ctx context.Context, tenant, kind, value string, limit, offset int) ([]repository.OrderBrief, error)
+}
+
+// ListByContact — заказы тенанта по телефону или email доставки (kind — pii.IndexPhone | pii.IndexEmail)
+func (s *OrdersService) ListByContact(ctx context.Context, tenant, kind, value string, limit, offset int) ([]repository.OrderBrief, error) {
+	repo, ok := s.repo.(contactLister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	out, err := repo.ListOrdersByContact(ctx, tenant, kind, value, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	// поиск по контакту — это «посмотрели заказы клиента», даже если целиком их не открыли
+	for _, b := range out {
+		s.audit.Record(ctx, audit.ActionSearch, tenant, b.OrderUID)
+	}
+	return out, nil
+}
 
 func (s *OrdersService) AddOrder(ctx context.Context, order *domain.Order) error {
 	err := s.repo.AddOrder(ctx, order)
@@ -37,11 +131,11 @@ func (s *OrdersService) AddOrder(ctx context.Context, order *domain.Order) error
 			var o *domain.Order
 			var e error
 			if order.OrderID != uuid.Nil {
-				o, e = s.repo.GetOrderById(ctx, order.OrderID)
+				o, e = s.repo.GetOrderById(ctx, order.Tenant, order.OrderID)
 			}
 			if e == nil && o != nil {
 				s.mu.Lock()
-				s.byUID[o.OrderUID] = o
+				s.byUID[keyOf(o)] = o
 				s.mu.Unlock()
 			}
 			return nil
@@ -51,30 +145,51 @@ func (s *OrdersService) AddOrder(ctx context.Context, order *domain.Order) error
 	}
 
 	s.mu.Lock()
-	s.byUID[order.OrderUID] = order
+	s.byUID[keyOf(order)] = order
 	s.mu.Unlock()
+
+	s.audit.Record(ctx, audit.ActionCreate, order.Tenant, order.OrderUID)
+	s.emit(ctx, EventOrderCreated, order)
 	return nil
 }
 
-func (s *OrdersService) GetbyUID(ctx context.Context, id string) (*domain.Order, error) {
+// GetbyUID — заказ тенанта; чужой заказ с тем же uid для него не существует
+func (s *OrdersService) GetbyUID(ctx context.Context, tenant, id string) (*domain.Order, error) {
+	o, err := s.getByUID(ctx, tenant, id)
+	if err == nil && o != nil {
+		s.audit.Record(ctx, audit.ActionRead, tenant, id)
+	}
+	return o, err
+}
+
+func (s *OrdersService) getByUID(ctx context.Context, tenant, id string) (*domain.Order, error) {
 	s.mu.RLock()
-	if o, ok := s.byUID[id]; ok {
+	if o, ok := s.byUID[orderKey{tenant: tenant, uid: id}]; ok {
 		s.mu.RUnlock()
 		return o, nil
 	}
 	s.mu.RUnlock()
 
-	o, err := s.repo.GetOrderByUID(ctx, id)
+	o, err := s.repo.GetOrderByUID(ctx, tenant, id)
 	if err != nil {
 		logger.Warn("Order service getbyUID trouble")
 		return nil, err
 	}
 	if o == nil {
-		return nil, nil
+		// в базе нет — возможно, уехал в архив; в кэш архивные не кладём, они старые и читаются редко
+		if s.archive == nil {
+			return nil, nil
+		}
+		o, err = s.archive.Lookup(ctx, tenant, id)
+		if err != nil {
+			logger.Warn("archive lookup failed", "err", err, "order_uid", id, "tenant", tenant)
+			return nil, err
+		}
+		return o, nil
 	}
 
 	s.mu.Lock()
-	s.byUID[o.OrderUID] = o
+	s.byUID[keyOf(o)] = o
 	s.mu.Unlock()
 	return o, nil
 }
@@ -86,16 +201,19 @@ func (s *OrdersService) RestoreCache(ctx context.Context, limit int) error {
 		return err
 	}
 
-	tmp := make(map[string]*domain.Order, len(rows))
+	tmp := make(map[orderKey]*domain.Order, len(rows))
 	for _, r := range rows {
 		var o domain.Order
 		if len(r.Payload) > 0 {
-			if err := json.Unmarshal(r.Payload, &o); err != nil {
-				logger.Warn("failed to unmarshal payload; skip")
+			// старые payload поднимаем до текущей версии на лету, в БД их переписывает migrate-payloads
+			po, err := domain.DecodeOrder(r.Payload, domain.VersionUnknown, false)
+			if err != nil {
+				logger.Warn("failed to unmarshal payload; skip", "err", err)
 				continue
 			}
+			o = *po
 		} else {
-			oo, err := s.repo.GetOrderById(ctx, r.ID)
+			oo, err := s.repo.GetOrderById(ctx, r.Tenant, r.ID)
 			if err != nil || oo == nil {
 				logger.Warn("failed to load order by id; skip")
 				continue
@@ -104,7 +222,8 @@ func (s *OrdersService) RestoreCache(ctx context.Context, limit int) error {
 		}
 
 		o.OrderID = r.ID
-		tmp[o.OrderUID] = &o
+		o.Tenant = r.Tenant
+		tmp[keyOf(&o)] = &o
 	}
 
 	s.mu.Lock()
@@ -112,3 +231,127 @@ func (s *OrdersService) RestoreCache(ctx context.Context, limit int) error {
 	s.mu.Unlock()
 	return nil
 }
+
+type customerEraser interface {
+	EraseCustomer(ctx context.Context, tenant, customerID, actor, source string) (*repository.Erasure, error)
+}
+
+var ErrEraseNotSupported = errors.New("erasure not supported")
+
+// EraseCustomer стирает персональные данные клиента во всех его заказах тенанта и выкидывает
+// эти заказы из кэша — следующее чтение возьмёт обезличенную версию из базы; в буфере событий
+// для докачки SSE/WatchOrders они обезличиваются на месте
+func (s *OrdersService) EraseCustomer(ctx context.Context, tenant, customerID, actor, source string) (*repository.Erasure, error) {
+	repo, ok := s.repo.(customerEraser)
+	if !ok {
+		return nil, ErrEraseNotSupported
+	}
+	e, err := repo.EraseCustomer(ctx, tenant, customerID, actor, source)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for _, uid := range e.OrderUIDs {
+		delete(s.byUID, orderKey{tenant: tenant, uid: uid})
+	}
+	// на случай, если в кэше заказ клиента, которого база уже не отдала (например, уехал в архив)
+	for k, o := range s.byUID {
+		if k.tenant == tenant && o.CustomerID == customerID {
+			delete(s.byUID, k)
+		}
+	}
+	s.mu.Unlock()
+	s.events.RedactCustomer(tenant, customerID)
+
+	for _, uid := range e.OrderUIDs {
+		s.audit.Record(ctx, audit.ActionErase, tenant, uid, audit.ErasedFields...)
+	}
+	logger.Info("customer personal data erased",
+		"erasure_id", e.ID, "tenant", tenant, "customer_id", customerID, "orders", e.Orders, "actor", actor, "source", source)
+	return e, nil
+}
+
+type historyReader interface {
+	OrderHistory(ctx context.Context, tenant, uid string) ([]repository.OrderVersion, error)
+	OrderAsOf(ctx context.Context, tenant, uid string, at time.Time) (*domain.Order, error)
+}
+
+var ErrHistoryNotSupported = errors.New("order history not supported")
+
+// History — версии заказа тенанта от первой к последней; пусто — заказа нет или история уже удалена
+func (s *OrdersService) History(ctx context.Context, tenant, uid string) ([]repository.OrderVersion, error) {
+	repo, ok := s.repo.(historyReader)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+	out, err := repo.OrderHistory(ctx, tenant, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > 0 {
+		s.audit.Record(ctx, audit.ActionHistory, tenant, uid)
+	}
+	return out, nil
+}
+
+// GetAsOf — заказ в том виде, в каком он был в момент at; nil — тогда его не было. Мимо кэша:
+// в кэше только текущая версия
+func (s *OrdersService) GetAsOf(ctx context.Context, tenant, uid string, at time.Time) (*domain.Order, error) {
+	repo, ok := s.repo.(historyReader)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+	o, err := repo.OrderAsOf(ctx, tenant, uid, at)
+	if err != nil {
+		return nil, err
+	}
+	if o != nil {
+		s.audit.Record(ctx, audit.ActionRead, tenant, uid)
+	}
+	return o, nil
+}
+
+// Forget выкидывает из кэша заказы с date_created раньше before — их месяцы ушли из базы
+// по сроку хранения, и кэш не должен отдавать то, чего больше нет
+func (s *OrdersService) Forget(before time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, o := range s.byUID {
+		if o.DateCreated.Before(before) {
+			delete(s.byUID, k)
+		}
+	}
+}
+
+// UpdateStatus меняет статус всех позиций заказа и рассылает свежий снимок подписчикам
+func (s *OrdersService) UpdateStatus(ctx context.Context, tenant, uid string, status int) (*domain.Order, error) {
+	if err := s.repo.UpdateItemsStatus(ctx, tenant, uid, status); err != nil {
+		return nil, err
+	}
+
+	o, err := s.repo.GetOrderByUID(ctx, tenant, uid)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	s.mu.Lock()
+	s.byUID[keyOf(o)] = o
+	s.mu.Unlock()
+
+	s.audit.Record(ctx, audit.ActionStatusChange, tenant, uid, "items.status")
+	s.emit(ctx, EventOrderStatusChanged, o)
+	return o, nil
+}
+
+func (s *OrdersService) emit(ctx context.Context, typ string, o *domain.Order) {
+	s.events.Publish(typ, o)
+	for _, sink := range s.sinks {
+		if err := sink.Enqueue(ctx, typ, o); err != nil {
+			logger.Warn("event sink failed", "err", err, "type", typ, "order_uid", o.OrderUID)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/pii"
+	"github.com/google/uuid"
+)
+
+// Файл архива — NDJSON в gzip, одна строка Record на заказ; рядом <файл>.manifest.json
+// с sha256 сжатого файла. Манифест пишется последним: нет манифеста — файл недописан.
+const (
+	dataExt     = ".ndjson.gz"
+	manifestExt = ".manifest.json"
+)
+
+var ErrCorrupted = errors.New("archive file checksum mismatch")
+
+// Record — строка архива. Тенант и id у domain.Order в JSON не попадают, поэтому рядом
+type Record struct {
+	Tenant  string        `json:"tenant_id"`
+	OrderID uuid.UUID     `json:"order_id"`
+	Order   *domain.Order `json:"order"`
+}
+
+type Manifest struct {
+	File       string    `json:"file"`
+	SHA256     string    `json:"sha256"`
+	Bytes      int64     `json:"bytes"`
+	Orders     int       `json:"orders"`
+	MinCreated time.Time `json:"min_date_created"`
+	MaxCreated time.Time `json:"max_date_created"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Store interface {
+	OrdersBefore(ctx context.Context, before time.Time, limit int) ([]*domain.Order, error)
+	MarkArchived(ctx context.Context, file string, orders []*domain.Order) error
+	LocateArchived(ctx context.Context, tenant, uid string) (string, error)
+	CustomerErased(ctx context.Context, tenant, customerID string, created time.Time) (bool, error)
+}
+
+type Config struct {
+	Interval  time.Duration // как часто запускать; 0 — только вручную, командой archive-orders
+	OlderThan time.Duration // заказы с date_created старше — в архив
+	Batch     int           // заказов в одном файле
+}
+
+// Archiver переносит старые заказы из wb в файлы и достаёт их оттуда по uid
+type Archiver struct {
+	store Store
+	files Storage
+	cfg   Config
+	// forget зовётся после прогона: заказы раньше отсечки из базы ушли
+	forget func(before time.Time)
+	// pii — доставка в файлах лежит зашифрованной так же, как в базе; nil — открытым текстом
+	pii *pii.Protector
+}
+
+func New(store Store, files Storage, cfg Config, forget func(before time.Time)) *Archiver {
+	return &Archiver{store: store, files: files, cfg: cfg, forget: forget}
+}
+
+// WithPII включает шифрование персональных полей доставки в файлах архива
+func (a *Archiver) WithPII(prot *pii.Protector) *Archiver {
+	a.pii = prot
+	return a
+}
+
+// Run — RunOnce раз в Interval, пока жив ctx
+func (a *Archiver) Run(ctx context.Context) {
+	if a.cfg.Interval <= 0 {
+		return
+	}
+	logger.Info("order archiver started", "older_than", a.cfg.OlderThan, "batch", a.cfg.Batch)
+	t := time.NewTicker(a.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := a.RunOnce(ctx); err != nil && ctx.Err() == nil {
+				logger.Warn("order archive failed", "err", err)
+			}
+		}
+	}
+}
+
+// RunOnce архивирует всё, что старше OlderThan, пачками по Batch; возвращает число заказов
+func (a *Archiver) RunOnce(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-a.cfg.OlderThan)
+	total := 0
+	defer func() {
+		if total > 0 && a.forget != nil {
+			a.forget(cutoff)
+		}
+	}()
+	for ctx.Err() == nil {
+		orders, err := a.store.OrdersBefore(ctx, cutoff, a.cfg.Batch)
+		if err != nil {
+			return total, err
+		}
+		if len(orders) == 0 {
+			return total, nil
+		}
+		m, err := a.write(ctx, orders)
+		if err != nil {
+			return total, err
+		}
+		// файл и манифест уже на месте; упадём здесь — заказы уедут в новый файл на следующем прогоне
+		if err := a.store.MarkArchived(ctx, m.File, orders); err != nil {
+			return total, err
+		}
+		total += len(orders)
+		logger.Info("orders archived", "file", m.File, "orders", m.Orders, "bytes", m.Bytes)
+	}
+	return total, ctx.Err()
+}
+
+func (a *Archiver) write(ctx context.Context, orders []*domain.Order) (*Manifest, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	m := &Manifest{Orders: len(orders), CreatedAt: time.Now().UTC()}
+	for i, o := range orders {
+		stored := *o
+		d, err := a.pii.SealDelivery(ctx, o.Delivery)
+		if err != nil {
+			return nil, err
+		}
+		stored.Delivery = d
+		if err := enc.Encode(Record{Tenant: o.Tenant, OrderID: o.OrderID, Order: &stored}); err != nil {
+			return nil, err
+		}
+		if i == 0 || o.DateCreated.Before(m.MinCreated) {
+			m.MinCreated = o.DateCreated
+		}
+		if o.DateCreated.After(m.MaxCreated) {
+			m.MaxCreated = o.DateCreated
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	m.SHA256 = hex.EncodeToString(sum[:])
+	m.Bytes = int64(buf.Len())
+	// orders/2025/01/orders-20250103T101500Z-<uuid>.ndjson.gz — раскладка по месяцу самого старого заказа
+	m.File = fmt.Sprintf("orders/%s/orders-%s-%s%s",
+		m.MinCreated.UTC().Format("2006/01"), m.CreatedAt.Format("20060102T150405Z"), uuid.NewString(), dataExt)
+
+	if err := a.files.Put(ctx, m.File, &buf); err != nil {
+		return nil, fmt.Errorf("put %s: %w", m.File, err)
+	}
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := a.files.Put(ctx, manifestName(m.File), bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("put manifest: %w", err)
+	}
+	return m, nil
+}
+
+func manifestName(file string) string {
+	return strings.TrimSuffix(file, dataExt) + manifestExt
+}
+
+// Lookup — заказ тенанта из архива; nil — в архиве его нет.
+// Файл сверяется с контрольной суммой из манифеста, прежде чем из него что-то отдать.
+// Файлы неизменяемы, поэтому стёртые после архивации данные клиента обезличиваются здесь, при чтении
+func (a *Archiver) Lookup(ctx context.Context, tenant, uid string) (*domain.Order, error) {
+	file, err := a.store.LocateArchived(ctx, tenant, uid)
+	if err != nil || file == "" {
+		return nil, err
+	}
+	m, err := a.manifest(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := a.read(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != m.SHA256 {
+		return nil, fmt.Errorf("%s: %w", file, ErrCorrupted)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				// индекс ссылается на файл, а заказа в нём нет — так быть не должно
+				logger.Warn("archived order missing in file", "file", file, "order_uid", uid, "tenant", tenant)
+				return nil, nil
+			}
+			return nil, err
+		}
+		if rec.Tenant == tenant && rec.Order != nil && rec.Order.OrderUID == uid {
+			rec.Order.Tenant = rec.Tenant
+			rec.Order.OrderID = rec.OrderID
+			if rec.Order.Delivery, err = a.pii.OpenDelivery(ctx, rec.Order.Delivery); err != nil {
+				return nil, err
+			}
+			if rec.Order.CustomerID != "" {
+				erased, err := a.store.CustomerErased(ctx, tenant, rec.Order.CustomerID, rec.Order.DateCreated)
+				if err != nil {
+					return nil, err
+				}
+				if erased {
+					rec.Order.Delivery = rec.Order.Delivery.Anonymized()
+				}
+			}
+			return rec.Order, nil
+		}
+	}
+}
+
+func (a *Archiver) manifest(ctx context.Context, file string) (*Manifest, error) {
+	raw, err := a.read(ctx, manifestName(file))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("manifest of %s: %w", file, err)
+	}
+	return &m, nil
+}
+
+func (a *Archiver) read(ctx context.Context, name string) ([]byte, error) {
+	rc, err := a.files.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage — куда складываются файлы архива. Имена плоские, с '/' как разделителем,
+// чтобы то же самое ложилось на ключи объектного хранилища
+type Storage interface {
+	Put(ctx context.Context, name string, r io.Reader) error
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// OpenStorage разбирает ARCHIVE_PATH: /path или file:///path — локальный каталог.
+// Объектные хранилища подключаются своей реализацией Storage под свою схему.
+func OpenStorage(uri string) (Storage, error) {
+	dir := uri
+	if strings.Contains(uri, "://") {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("archive path: %w", err)
+		}
+		if u.Scheme != "file" {
+			return nil, fmt.Errorf("archive path: scheme %q is not supported", u.Scheme)
+		}
+		dir = u.Path
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("archive path: %w", err)
+	}
+	return &dirStorage{root: dir}, nil
+}
+
+type dirStorage struct {
+	root string
+}
+
+func (d *dirStorage) path(name string) (string, error) {
+	p := filepath.Join(d.root, filepath.FromSlash(name))
+	if !strings.HasPrefix(p, filepath.Clean(d.root)+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive: bad file name %q", name)
+	}
+	return p, nil
+}
+
+// Put пишет во временный файл и переименовывает: недописанный файл под настоящим именем не появится
+func (d *dirStorage) Put(_ context.Context, name string, r io.Reader) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (d *dirStorage) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	p, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+)
+
+// Откуда пришло обращение к заказу
+const (
+	SourceHTTP  = "http"
+	SourceGRPC  = "grpc"
+	SourceKafka = "kafka"
+	SourceAdmin = "admin" // команды cmd, мимо API
+)
+
+// Что сделали с заказом
+const (
+	ActionRead         = "order.read"          // заказ целиком: GET /orders/{uid}, gRPC GetOrder, snapshot в WebSocket
+	ActionSearch       = "order.search"        // заказ нашёлся поиском по телефону или email
+	ActionStream       = "order.stream"        // заказ доставлен подписчику: SSE, WebSocket, gRPC WatchOrders
+	ActionHistory      = "order.history"       // все версии заказа
+	ActionSubmit       = "order.submit"        // заказ принят API и отправлен в Kafka
+	ActionCreate       = "order.create"        // заказ сохранён в базу
+	ActionStatusChange = "order.status_change" // статус позиций
+	ActionErase        = "order.erase"         // стёрты персональные данные
+)
+
+// ErasedFields — что меняет стирание персональных данных, см. domain.DeliveryData.Anonymized
+var ErasedFields = []string{"delivery.name", "delivery.phone", "delivery.zip", "delivery.address", "delivery.email"}
+
+const (
+	flushEvery = time.Second
+	batchSize  = 500
+)
+
+// Meta — кто и откуда обращается; кладётся в ctx на входе (HTTP, gRPC, консьюмер, команды)
+type Meta struct {
+	Actor     string
+	Source    string
+	RequestID string
+}
+
+type ctxKey struct{}
+
+func WithMeta(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, ctxKey{}, m)
+}
+
+func MetaFrom(ctx context.Context) Meta {
+	m, _ := ctx.Value(ctxKey{}).(Meta)
+	return m
+}
+
+type Store interface {
+	InsertAudit(ctx context.Context, entries []repository.AuditEntry) error
+}
+
+// Log пишет журнал в фоне: запрос не ждёт базу. Буфер переполнен (база лежит дольше, чем
+// он успевает заполниться) — запись не теряется молча, а уходит в лог сервиса.
+type Log struct {
+	store Store
+	ch    chan repository.AuditEntry
+}
+
+func New(store Store, buffer int) *Log {
+	return &Log{
+		store: store,
+		ch:    make(chan repository.AuditEntry, buffer),
+	}
+}
+
+// Record ставит запись в очередь; nil-журнал ничего не делает
+func (l *Log) Record(ctx context.Context, action, tenant, orderUID string, fields ...string) {
+	if l == nil {
+		return
+	}
+	m := MetaFrom(ctx)
+	e := repository.AuditEntry{
+		Tenant:    tenant,
+		At:        time.Now().UTC(),
+		Actor:     m.Actor,
+		Action:    action,
+		OrderUID:  orderUID,
+		RequestID: m.RequestID,
+		Source:    m.Source,
+		Fields:    fields,
+	}
+	select {
+	case l.ch <- e:
+	default:
+		logDropped(e, "audit buffer is full")
+	}
+}
+
+// Run пишет очередь пачками до отмены ctx, затем дописывает то, что осталось
+func (l *Log) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]repository.AuditEntry, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := l.store.InsertAudit(ctx, batch); err != nil {
+			logger.Warn("audit write failed", "err", err, "entries", len(batch))
+			for _, e := range batch {
+				logDropped(e, "audit write failed")
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-l.ch:
+					batch = append(batch, e)
+					if len(batch) == batchSize {
+						flush(context.Background())
+					}
+				default:
+					flush(context.Background())
+					return
+				}
+			}
+		case e := <-l.ch:
+			batch = append(batch, e)
+			if len(batch) == batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+func logDropped(e repository.AuditEntry, reason string) {
+	logger.Warn(reason,
+		"tenant", e.Tenant,
+		"at", e.At,
+		"actor", e.Actor,
+		"action", e.Action,
+		"order_uid", e.OrderUID,
+		"request_id", e.RequestID,
+		"source", e.Source,
+		"fields", e.Fields,
+	)
+}
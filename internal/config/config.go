@@ -1,32 +1,145 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
 	HTTP_PORT      string
+	GRPC_PORT      string
 	DB_STRING      string
 	KAFKA_BROKERS  string // "localhost:9092,localhost:9093"
 	KAFKA_TOPIC    string // "orders"
 	KAFKA_GROUP_ID string // "orders-service"
 	KAFKA_DLT      string // "orders.dlq" (опционально)
+	KAFKA_EVENTS   string // "orders.events" — доменные события из outbox
+
+	MIGRATE_DB_STRING string // владелец схемы: миграции и DDL партиций; пусто — DB_STRING. Сам сервис ходит по DB_STRING ролью без BYPASSRLS
+
+	KAFKA_CONTENT_TYPE   string // формат, в котором пишем заказы: application/json | application/x-protobuf | application/avro
+	KAFKA_PIPELINES_FILE string // json со списком пайплайнов, см. Pipelines; пусто — один из KAFKA_TOPIC/KAFKA_GROUP_ID
+	SCHEMA_REGISTRY_URL  string // http(s)://... или file:///path.json; пусто — registry в памяти процесса
+
+	KAFKA_LAG_CHECK_INTERVAL time.Duration // как часто сверяем оффсеты группы с high watermark; 0 — не следим
+	KAFKA_LAG_MAX_MESSAGES   int64         // лаг в сообщениях, после которого инстанс degraded; 0 — без порога
+	KAFKA_LAG_MAX_DELAY      time.Duration // отставание по date_created заказа; 0 — без порога
+
+	AUTH_ENABLED          bool   // по умолчанию true
+	AUTH_API_KEYS_FILE    string // json со списком {id, key_sha256, scopes}
+	AUTH_JWT_HS256_SECRET string
+	AUTH_JWKS_FILE        string // локальный JWKS для RS256
+	AUTH_JWT_ISSUER       string
+	AUTH_JWT_AUDIENCE     string
+
+	RATE_LIMIT_ENABLED  bool   // по умолчанию true
+	RATE_LIMIT_DEFAULT  string // "rps:burst" для роутов без своего лимита
+	RATE_LIMIT_ROUTES   string // "orders.generate=0.2:2,orders.create=10:20"
+	HTTP_MAX_BODY_BYTES int64  // глобальный лимит тела запроса
+	HTTP_ROUTE_MAX_BODY string // "orders.create=2097152"
+
+	IDEMPOTENCY_TTL time.Duration // сколько храним ответы по Idempotency-Key
+
+	OPENAPI_VALIDATE bool // проверять входящие запросы по openapi.json
+
+	WS_MAX_SUBSCRIPTIONS int    // order_uid + track_number на одно соединение
+	WS_ALLOWED_ORIGINS   string // "dashboard.example.com,*.wb.local"; пусто — только свой хост
+
+	WEBHOOK_TIMEOUT       time.Duration // на один запрос к подписчику
+	WEBHOOK_MAX_AGE       time.Duration // сколько ретраим доставку, прежде чем сдаться
+	WEBHOOK_DISABLE_AFTER int           // ошибок подряд до автоматического выключения подписчика
+
+	PARTITION_CHECK_INTERVAL time.Duration // как часто job заводит будущие партиции и убирает старые
+	PARTITION_PREMAKE_MONTHS int           // на сколько месяцев вперёд держать партиции
+	ORDERS_RETENTION_MONTHS  int           // сколько прошлых месяцев хранить кроме текущего; 0 — всё
+	ORDERS_RETENTION_MODE    string        // archive — в схему wb_archive, drop — удалить
+
+	ARCHIVE_PATH       string        // каталог или file:///... для холодного архива; пусто — архива нет
+	ARCHIVE_OLDER_THAN time.Duration // заказы с date_created старше — в архив
+	ARCHIVE_INTERVAL   time.Duration // как часто архивировать; 0 — только командой archive-orders
+	ARCHIVE_BATCH      int           // заказов в одном файле
+
+	PII_KEYS_FILE       string        // json с ключами шифрования доставки, см. pii.KeyFile; пусто — без шифрования
+	PII_ROTATE_INTERVAL time.Duration // как часто перешифровывать старым ключом зашифрованное
+	PII_ROTATE_BATCH    int           // строк в одной транзакции перешифрования
+	PII_MASKING_FILE    string        // json с правилами маскирования по ролям, см. masking.Rules; пусто — правила по умолчанию
+	AUDIT_BUFFER        int           // записей журнала доступа в очереди на запись; переполнится — запись уйдёт только в лог
 }
 
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
 		HTTP_PORT:      os.Getenv("HTTP_PORT"),
+		GRPC_PORT:      os.Getenv("GRPC_PORT"),
 		DB_STRING:      os.Getenv("DB_STRING"),
 		KAFKA_BROKERS:  os.Getenv("KAFKA_BROKERS"),
 		KAFKA_TOPIC:    os.Getenv("KAFKA_TOPIC"),
 		KAFKA_GROUP_ID: os.Getenv("KAFKA_GROUP_ID"),
 		KAFKA_DLT:      os.Getenv("KAFKA_DLT"),
+		KAFKA_EVENTS:   os.Getenv("KAFKA_EVENTS"),
+
+		MIGRATE_DB_STRING: os.Getenv("MIGRATE_DB_STRING"),
+
+		KAFKA_CONTENT_TYPE:   os.Getenv("KAFKA_CONTENT_TYPE"),
+		KAFKA_PIPELINES_FILE: os.Getenv("KAFKA_PIPELINES_FILE"),
+		SCHEMA_REGISTRY_URL:  os.Getenv("SCHEMA_REGISTRY_URL"),
+
+		AUTH_ENABLED:          true,
+		AUTH_API_KEYS_FILE:    os.Getenv("AUTH_API_KEYS_FILE"),
+		AUTH_JWT_HS256_SECRET: os.Getenv("AUTH_JWT_HS256_SECRET"),
+		AUTH_JWKS_FILE:        os.Getenv("AUTH_JWKS_FILE"),
+		AUTH_JWT_ISSUER:       os.Getenv("AUTH_JWT_ISSUER"),
+		AUTH_JWT_AUDIENCE:     os.Getenv("AUTH_JWT_AUDIENCE"),
+
+		RATE_LIMIT_ENABLED:  true,
+		RATE_LIMIT_DEFAULT:  os.Getenv("RATE_LIMIT_DEFAULT"),
+		RATE_LIMIT_ROUTES:   os.Getenv("RATE_LIMIT_ROUTES"),
+		HTTP_MAX_BODY_BYTES: 4 << 20,
+		HTTP_ROUTE_MAX_BODY: os.Getenv("HTTP_ROUTE_MAX_BODY"),
+
+		IDEMPOTENCY_TTL: 24 * time.Hour,
+
+		OPENAPI_VALIDATE: false,
+
+		WS_MAX_SUBSCRIPTIONS: 100,
+		WS_ALLOWED_ORIGINS:   os.Getenv("WS_ALLOWED_ORIGINS"),
+
+		WEBHOOK_TIMEOUT:       10 * time.Second,
+		WEBHOOK_MAX_AGE:       24 * time.Hour,
+		WEBHOOK_DISABLE_AFTER: 20,
+
+		KAFKA_LAG_CHECK_INTERVAL: 15 * time.Second,
+		KAFKA_LAG_MAX_MESSAGES:   10000,
+		KAFKA_LAG_MAX_DELAY:      5 * time.Minute,
+
+		PARTITION_CHECK_INTERVAL: time.Hour,
+		PARTITION_PREMAKE_MONTHS: 3,
+		ORDERS_RETENTION_MONTHS:  0,
+		ORDERS_RETENTION_MODE:    os.Getenv("ORDERS_RETENTION_MODE"),
+
+		ARCHIVE_PATH:       os.Getenv("ARCHIVE_PATH"),
+		ARCHIVE_OLDER_THAN: 180 * 24 * time.Hour,
+		ARCHIVE_INTERVAL:   24 * time.Hour,
+		ARCHIVE_BATCH:      500,
+
+		PII_KEYS_FILE:       os.Getenv("PII_KEYS_FILE"),
+		PII_ROTATE_INTERVAL: time.Minute,
+		PII_ROTATE_BATCH:    200,
+		PII_MASKING_FILE:    os.Getenv("PII_MASKING_FILE"),
+		AUDIT_BUFFER:        10000,
 	}
 
 	// дефолты на случай, если .env пустой
 	if cfg.HTTP_PORT == "" {
 		cfg.HTTP_PORT = "8080"
 	}
+	if cfg.GRPC_PORT == "" {
+		cfg.GRPC_PORT = "9090"
+	}
+	if cfg.MIGRATE_DB_STRING == "" {
+		cfg.MIGRATE_DB_STRING = cfg.DB_STRING
+	}
 	if cfg.KAFKA_BROKERS == "" {
 		cfg.KAFKA_BROKERS = "localhost:9092"
 	}
@@ -39,5 +152,141 @@ func LoadConfig() (*Config, error) {
 	if cfg.KAFKA_DLT == "" {
 		cfg.KAFKA_DLT = "orders.dlq"
 	}
+	if cfg.KAFKA_EVENTS == "" {
+		cfg.KAFKA_EVENTS = "orders.events"
+	}
+	if cfg.KAFKA_CONTENT_TYPE == "" {
+		cfg.KAFKA_CONTENT_TYPE = "application/json"
+	}
+	if cfg.RATE_LIMIT_DEFAULT == "" {
+		cfg.RATE_LIMIT_DEFAULT = "20:40"
+	}
+	if cfg.RATE_LIMIT_ROUTES == "" {
+		cfg.RATE_LIMIT_ROUTES = "orders.generate=0.2:2"
+	}
+	if cfg.HTTP_ROUTE_MAX_BODY == "" {
+		cfg.HTTP_ROUTE_MAX_BODY = "orders.create=2097152"
+	}
+	if cfg.ORDERS_RETENTION_MODE == "" {
+		cfg.ORDERS_RETENTION_MODE = "archive"
+	}
+
+	// типизированные переменные: не задана — остаётся значение по умолчанию из литерала выше
+	if err := lookupBool("AUTH_ENABLED", &cfg.AUTH_ENABLED); err != nil {
+		return nil, err
+	}
+	if err := lookupBool("RATE_LIMIT_ENABLED", &cfg.RATE_LIMIT_ENABLED); err != nil {
+		return nil, err
+	}
+	if err := lookupInt64("HTTP_MAX_BODY_BYTES", &cfg.HTTP_MAX_BODY_BYTES); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("IDEMPOTENCY_TTL", &cfg.IDEMPOTENCY_TTL); err != nil {
+		return nil, err
+	}
+	if err := lookupBool("OPENAPI_VALIDATE", &cfg.OPENAPI_VALIDATE); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("WS_MAX_SUBSCRIPTIONS", &cfg.WS_MAX_SUBSCRIPTIONS); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("WEBHOOK_TIMEOUT", &cfg.WEBHOOK_TIMEOUT); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("WEBHOOK_MAX_AGE", &cfg.WEBHOOK_MAX_AGE); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("WEBHOOK_DISABLE_AFTER", &cfg.WEBHOOK_DISABLE_AFTER); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("KAFKA_LAG_CHECK_INTERVAL", &cfg.KAFKA_LAG_CHECK_INTERVAL); err != nil {
+		return nil, err
+	}
+	if err := lookupInt64("KAFKA_LAG_MAX_MESSAGES", &cfg.KAFKA_LAG_MAX_MESSAGES); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("KAFKA_LAG_MAX_DELAY", &cfg.KAFKA_LAG_MAX_DELAY); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("PARTITION_CHECK_INTERVAL", &cfg.PARTITION_CHECK_INTERVAL); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("PARTITION_PREMAKE_MONTHS", &cfg.PARTITION_PREMAKE_MONTHS); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("ORDERS_RETENTION_MONTHS", &cfg.ORDERS_RETENTION_MONTHS); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("ARCHIVE_OLDER_THAN", &cfg.ARCHIVE_OLDER_THAN); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("ARCHIVE_INTERVAL", &cfg.ARCHIVE_INTERVAL); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("ARCHIVE_BATCH", &cfg.ARCHIVE_BATCH); err != nil {
+		return nil, err
+	}
+	if err := lookupDuration("PII_ROTATE_INTERVAL", &cfg.PII_ROTATE_INTERVAL); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("PII_ROTATE_BATCH", &cfg.PII_ROTATE_BATCH); err != nil {
+		return nil, err
+	}
+	if err := lookupInt("AUDIT_BUFFER", &cfg.AUDIT_BUFFER); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+// lookupBool, lookupInt и т.д. перекрывают значение в dst, если переменная задана
+func lookupBool(name string, dst *bool) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = b
+	return nil
+}
+
+func lookupInt(name string, dst *int) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = n
+	return nil
+}
+
+func lookupInt64(name string, dst *int64) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = n
+	return nil
+}
+
+func lookupDuration(name string, dst *time.Duration) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+)
+
+// Pipeline — один консьюмер со своим топиком, группой, форматом, профилем проверки и тенантом.
+//
+// Формат KAFKA_PIPELINES_FILE (пример — deploy/pipelines.example.json):
+// [{"name": "wb", "topic": "orders.wb", "content_type": "application/json", "validation": "strict", "tenant_id": "wb"}]
+// group по умолчанию — KAFKA_GROUP_ID.<name>, content_type — KAFKA_CONTENT_TYPE, validation — basic.
+type Pipeline struct {
+	Name        string `json:"name"`
+	Topic       string `json:"topic"`
+	Group       string `json:"group"`
+	ContentType string `json:"content_type"`
+	Validation  string `json:"validation"`
+	Tenant      string `json:"tenant_id"`
+}
+
+// Pipelines читает KAFKA_PIPELINES_FILE. Без файла — один пайплайн тенанта default
+// из KAFKA_TOPIC/KAFKA_GROUP_ID, как было до пайплайнов.
+// Топики, группы и тенанты не должны повторяться: пайплайны изолированы друг от друга.
+func (c *Config) Pipelines() ([]Pipeline, error) {
+	if c.KAFKA_PIPELINES_FILE == "" {
+		return []Pipeline{{
+			Name:        domain.DefaultTenant,
+			Topic:       c.KAFKA_TOPIC,
+			Group:       c.KAFKA_GROUP_ID,
+			ContentType: c.KAFKA_CONTENT_TYPE,
+			Validation:  string(domain.ProfileBasic),
+			Tenant:      domain.DefaultTenant,
+		}}, nil
+	}
+
+	raw, err := os.ReadFile(c.KAFKA_PIPELINES_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("read pipelines file: %w", err)
+	}
+	var ps []Pipeline
+	if err := json.Unmarshal(raw, &ps); err != nil {
+		return nil, fmt.Errorf("parse pipelines file: %w", err)
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("pipelines file %s: no pipelines", c.KAFKA_PIPELINES_FILE)
+	}
+
+	seen := map[string]string{}
+	unique := func(kind, v, name string) error {
+		if other, ok := seen[kind+"\x00"+v]; ok {
+			return fmt.Errorf("pipeline %q: %s %q is already used by %q", name, kind, v, other)
+		}
+		seen[kind+"\x00"+v] = name
+		return nil
+	}
+	for i := range ps {
+		p := &ps[i]
+		if p.Name == "" || p.Topic == "" {
+			return nil, fmt.Errorf("pipeline #%d: name and topic are required", i)
+		}
+		if !domain.ValidTenant(p.Tenant) {
+			return nil, fmt.Errorf("pipeline %q: bad tenant_id %q", p.Name, p.Tenant)
+		}
+		if p.Group == "" {
+			p.Group = c.KAFKA_GROUP_ID + "." + p.Name
+		}
+		if p.ContentType == "" {
+			p.ContentType = c.KAFKA_CONTENT_TYPE
+		}
+		prof, err := domain.ParseValidationProfile(p.Validation)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: %w", p.Name, err)
+		}
+		p.Validation = string(prof)
+
+		for _, u := range [][2]string{{"name", p.Name}, {"topic", p.Topic}, {"group", p.Group}, {"tenant_id", p.Tenant}} {
+			if err := unique(u[0], u[1], p.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ps, nil
+}
@@ -9,3 +9,12 @@ type DeliveryData struct {
 	Region  string `json:"region"`
 	Email   string `json:"email"`
 }
+
+// ErasedMarker — чем заменяется имя получателя после стирания персональных данных
+const ErasedMarker = "[erased]"
+
+// Anonymized — доставка без персональных данных: остаются город и регион, по ним
+// человека не найти, а статистике они нужны
+func (d DeliveryData) Anonymized() DeliveryData {
+	return DeliveryData{Name: ErasedMarker, City: d.City, Region: d.Region}
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// FieldChange — поле, отличающееся у двух версий заказа. Field — путь по JSON-именам:
+// "delivery.phone", "items[0].status"; у появившегося поля From = nil, у пропавшего To = nil
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// Diff — чем to отличается от from, поля по алфавиту. schema_version не сравнивается: это форма
+// записи, а не содержание заказа, её меняет служебный migrate-payloads
+func Diff(from, to *Order) []FieldChange {
+	a, b := flattenOrder(from), flattenOrder(to)
+	delete(a, "schema_version")
+	delete(b, "schema_version")
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	out := []FieldChange{}
+	for _, k := range keys {
+		va, vb := a[k], b[k]
+		if va != vb {
+			out = append(out, FieldChange{Field: k, From: va, To: vb})
+		}
+	}
+	return out
+}
+
+// flattenOrder раскладывает заказ в путь → значение; значения — скаляры JSON, их можно сравнивать ==
+func flattenOrder(o *Order) map[string]any {
+	out := map[string]any{}
+	if o == nil {
+		return out
+	}
+	raw, err := json.Marshal(o)
+	if err != nil {
+		return out
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return out
+	}
+	flatten("", doc, out)
+	return out
+}
+
+func flatten(prefix string, v any, out map[string]any) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, vv := range t {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flatten(p, vv, out)
+		}
+	case []any:
+		for i, vv := range t {
+			flatten(prefix+"["+strconv.Itoa(i)+"]", vv, out)
+		}
+	default:
+		out[prefix] = t
+	}
+}
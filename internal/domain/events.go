@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Доменные события для топика orders.events. Меняется форма data — растёт версия,
+// старые версии не переиспользуются.
+const (
+	EventOrderCreated          = "OrderCreated"
+	EventOrderDuplicateIgnored = "OrderDuplicateIgnored"
+	EventOrderRejected         = "OrderRejected"
+	EventCustomerDataErased    = "CustomerDataErased"
+
+	EventVersion = 1
+)
+
+// Event — конверт события; в Kafka уходит как есть, ключ сообщения — OrderUID
+type Event struct {
+	ID         uuid.UUID       `json:"event_id"`
+	Type       string          `json:"event_type"`
+	Version    int             `json:"event_version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	OrderUID   string          `json:"order_uid"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// EventSource — откуда пришёл отклонённый заказ
+type EventSource struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// OrderCreatedData — заказ в том виде, в каком он лёг в payload: с PII_KEYS_FILE персональные
+// поля доставки зашифрованы, открыть их может только тот, у кого есть ключи
+type OrderCreatedData struct {
+	Order *Order `json:"order"`
+}
+
+type OrderDuplicateIgnoredData struct {
+	OrderID uuid.UUID `json:"order_id"`
+}
+
+type OrderRejectedData struct {
+	Reason string       `json:"reason"`
+	Fields []FieldError `json:"fields,omitempty"`
+	Source *EventSource `json:"source,omitempty"`
+}
+
+// CustomerDataErasedData — по одному событию на заказ клиента: нижестоящие копии
+// заказа должны стереть у себя то же, что стёрли мы (см. DeliveryData.Anonymized)
+type CustomerDataErasedData struct {
+	ErasureID  uuid.UUID `json:"erasure_id"`
+	CustomerID string    `json:"customer_id"`
+	Tenant     string    `json:"tenant_id"`
+}
+
+func NewEvent(typ, orderUID string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         uuid.New(),
+		Type:       typ,
+		Version:    EventVersion,
+		OccurredAt: time.Now().UTC(),
+		OrderUID:   orderUID,
+		Data:       raw,
+	}, nil
+}
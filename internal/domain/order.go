@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
@@ -21,4 +24,105 @@ type Order struct {
 	SMID              int          `json:"sm_id"`
 	DateCreated       time.Time    `json:"date_created"`
 	OofShard          string       `json:"oof_shard"`
+	SchemaVersion     int          `json:"schema_version,omitempty"`
+	Tenant            string       `json:"-"` // задаётся пайплайном или запросом, не телом
+}
+
+// Окно date_created. Под месяц заказа AddOrder при необходимости сам заводит партиции, так что
+// мусорная дата (0001-01-01, 2999 год) стоила бы четырёх пустых таблиц — такие заказы не принимаем
+const (
+	MaxOrderAge        = 10 * 365 * 24 * time.Hour // заказы старше — ошибка во входных данных, а не история
+	MaxDateCreatedSkew = 24 * time.Hour            // насколько date_created может опережать часы сервиса
+)
+
+// CheckDateCreated — "" если date_created задана и попадает в окно относительно now, иначе причина
+func CheckDateCreated(t, now time.Time) string {
+	switch {
+	case t.IsZero():
+		return "is required"
+	case t.Before(now.Add(-MaxOrderAge)):
+		return fmt.Sprintf("must not be older than %d years", int(MaxOrderAge/(365*24*time.Hour)))
+	case t.After(now.Add(MaxDateCreatedSkew)):
+		return fmt.Sprintf("must not be later than %s from now", MaxDateCreatedSkew)
+	}
+	return ""
+}
+
+// Validate проверяет поля, без которых заказ не ляжет в БД (NOT NULL в схеме), и date_created
+func (o *Order) Validate() error {
+	v := &ValidationError{}
+	if strings.TrimSpace(o.OrderUID) == "" {
+		v.Add("order_uid", "is required")
+	}
+	if strings.TrimSpace(o.TrackNumber) == "" {
+		v.Add("track_number", "is required")
+	}
+	if strings.TrimSpace(o.Payment.Transaction) == "" {
+		v.Add("payment.transaction", "is required")
+	}
+	if strings.TrimSpace(o.Payment.Currency) == "" {
+		v.Add("payment.currency", "is required")
+	}
+	if msg := CheckDateCreated(o.DateCreated, time.Now()); msg != "" {
+		v.Add("date_created", msg)
+	}
+	for i, it := range o.Items {
+		if it.Price < 0 {
+			v.Add(fmt.Sprintf("items[%d].price", i), "must not be negative")
+		}
+		if it.TotalPrice < 0 {
+			v.Add(fmt.Sprintf("items[%d].total_price", i), "must not be negative")
+		}
+	}
+	return v.Err()
+}
+
+// ValidationProfile — насколько строго проверяем заказы пайплайна
+type ValidationProfile string
+
+const (
+	// ProfileBasic — только то, без чего заказ не сохранить, см. Validate
+	ProfileBasic ValidationProfile = "basic"
+	// ProfileStrict — плюс то, без чего заказ не доставить и не сверить оплату
+	ProfileStrict ValidationProfile = "strict"
+)
+
+func ParseValidationProfile(s string) (ValidationProfile, error) {
+	switch p := ValidationProfile(s); p {
+	case "":
+		return ProfileBasic, nil
+	case ProfileBasic, ProfileStrict:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown validation profile %q, expected basic or strict", s)
+}
+
+func (p ValidationProfile) Validate(o *Order) error {
+	err := o.Validate()
+	if p != ProfileStrict {
+		return err
+	}
+	v := &ValidationError{}
+	if errors.As(err, &v) {
+		v = &ValidationError{Fields: append([]FieldError(nil), v.Fields...)}
+	}
+	if strings.TrimSpace(o.CustomerID) == "" {
+		v.Add("customer_id", "is required")
+	}
+	if strings.TrimSpace(o.Delivery.Name) == "" {
+		v.Add("delivery.name", "is required")
+	}
+	if strings.TrimSpace(o.Delivery.Phone) == "" {
+		v.Add("delivery.phone", "is required")
+	}
+	if strings.TrimSpace(o.Delivery.Address) == "" {
+		v.Add("delivery.address", "is required")
+	}
+	if len(o.Items) == 0 {
+		v.Add("items", "must not be empty")
+	}
+	if o.Payment.Amount < 0 {
+		v.Add("payment.amount", "must not be negative")
+	}
+	return v.Err()
 }
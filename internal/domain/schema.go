@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// OrderSchemaVersion — текущая версия JSON-формы заказа. Поднимается при любом
+// несовместимом изменении Order; вместе с ней в upcasters добавляется шаг с прошлой версии.
+const OrderSchemaVersion = 1
+
+// VersionUnknown — версию не передали отдельно (заголовком), берём из поля schema_version
+const VersionUnknown = -1
+
+var ErrUnsupportedSchemaVersion = errors.New("unsupported schema_version")
+
+// Upcaster переводит документ версии N в N+1, меняя его на месте
+type Upcaster func(doc map[string]any) error
+
+// upcasters[N] — шаг N -> N+1. Цепочка должна быть без дыр от 0 до OrderSchemaVersion-1.
+var upcasters = map[int]Upcaster{
+	// 0 — payload без schema_version, всё, что писали до версионирования.
+	// Форма совпадает с версией 1, шаг только проставляет версию.
+	0: func(map[string]any) error { return nil },
+}
+
+// DecodeOrder разбирает JSON заказа любой поддерживаемой версии и поднимает его до текущей.
+// version — из заголовка; VersionUnknown — смотрим schema_version в теле, нет и там — это 0.
+// strict запрещает поля, которых нет в текущей версии Order (после апкаста).
+func DecodeOrder(raw []byte, version int, strict bool) (*Order, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errors.New("order must be a JSON object")
+	}
+
+	bodyVersion, err := versionField(doc)
+	if err != nil {
+		return nil, err
+	}
+	if version == VersionUnknown {
+		version = bodyVersion
+	} else if _, ok := doc["schema_version"]; ok && bodyVersion != version {
+		return nil, fmt.Errorf("%w: header says %d, body says %d", ErrUnsupportedSchemaVersion, version, bodyVersion)
+	}
+
+	if err := Upcast(doc, version); err != nil {
+		return nil, err
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	dec = json.NewDecoder(bytes.NewReader(out))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	var o Order
+	if err := dec.Decode(&o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Upcast прогоняет документ по цепочке от version до текущей и проставляет schema_version
+func Upcast(doc map[string]any, version int) error {
+	if version < 0 || version > OrderSchemaVersion {
+		return fmt.Errorf("%w: %d (current is %d)", ErrUnsupportedSchemaVersion, version, OrderSchemaVersion)
+	}
+	for v := version; v < OrderSchemaVersion; v++ {
+		up, ok := upcasters[v]
+		if !ok {
+			return fmt.Errorf("%w: no upcaster from %d", ErrUnsupportedSchemaVersion, v)
+		}
+		if err := up(doc); err != nil {
+			return fmt.Errorf("upcast %d -> %d: %w", v, v+1, err)
+		}
+	}
+	doc["schema_version"] = OrderSchemaVersion
+	return nil
+}
+
+// ParseSchemaVersion — для заголовков; пустая строка — VersionUnknown
+func ParseSchemaVersion(s string) (int, error) {
+	if s == "" {
+		return VersionUnknown, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedSchemaVersion, s)
+	}
+	return v, nil
+}
+
+func versionField(doc map[string]any) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%w: must be an integer", ErrUnsupportedSchemaVersion)
+	}
+	v, err := strconv.Atoi(n.String())
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedSchemaVersion, n)
+	}
+	return v, nil
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "regexp"
+
+// DefaultTenant — тенант заказов, пришедших до появления пайплайнов, и единственного
+// пайплайна, собранного из KAFKA_TOPIC/KAFKA_GROUP_ID
+const DefaultTenant = "default"
+
+var tenantRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenant — id тенанта: строчные латинские буквы, цифры, '-' и '_', до 63 символов
+func ValidTenant(id string) bool {
+	return tenantRe.MatchString(id)
+}
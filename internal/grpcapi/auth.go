@@ -0,0 +1,105 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/RaikyD/wb-orders-service/internal/audit"
+	"github.com/RaikyD/wb-orders-service/internal/grpcapi/ordersv1"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// scope на каждый метод, как у соответствующих HTTP-роутов.
+// Методов, которых тут нет (health, reflection), авторизация не касается.
+var methodScopes = map[string]string{
+	ordersv1.OrdersService_CreateOrder_FullMethodName: auth.ScopeOrdersWrite,
+	ordersv1.OrdersService_GetOrder_FullMethodName:    auth.ScopeOrdersRead,
+	ordersv1.OrdersService_ListOrders_FullMethodName:  auth.ScopeOrdersRead,
+	ordersv1.OrdersService_WatchOrders_FullMethodName: auth.ScopeOrdersRead,
+}
+
+func authorize(ctx context.Context, authn *auth.Authenticator, method string) (context.Context, error) {
+	scope, ok := methodScopes[method]
+	if !ok {
+		return ctx, nil
+	}
+
+	// metadata приводим к http.Header, чтобы разбирать учётные данные тем же кодом
+	md, _ := metadata.FromIncomingContext(ctx)
+	h := http.Header{}
+	for k, vs := range md {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+
+	p, err := authn.Authenticate(h)
+	if err != nil {
+		logger.Warn("grpc auth rejected", "err", err, "method", method)
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	if p == nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if !p.Has(scope) {
+		return nil, status.Error(codes.PermissionDenied, "missing scope "+scope)
+	}
+	// тенант — по учётным данным, выбор через metadata x-tenant-id, как X-Tenant-ID у HTTP
+	tenant, err := auth.ResolveTenant(p, h, "")
+	if errors.Is(err, auth.ErrBadTenant) {
+		return nil, status.Error(codes.InvalidArgument, "bad "+auth.HeaderTenant)
+	}
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	ctx = auth.WithPrincipal(ctx, p)
+	if tenant != "" {
+		ctx = auth.WithTenant(ctx, tenant)
+	}
+	// request id — как у HTTP: свой x-request-id клиента или новый
+	reqID := h.Get("X-Request-Id")
+	if reqID == "" {
+		reqID = uuid.NewString()
+	}
+	ctx = audit.WithMeta(ctx, audit.Meta{Actor: p.ID, Source: audit.SourceGRPC, RequestID: reqID})
+	if scope != auth.ScopeOrdersRead {
+		logger.Info("audit write", "actor", p.ID, "auth_method", p.Method, "grpc_method", method, "tenant", auth.TenantFrom(ctx))
+	}
+	return ctx, nil
+}
+
+func unaryAuth(authn *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, authn, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamAuth(authn *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), authn, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+	}
+}
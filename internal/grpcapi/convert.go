@@ -0,0 +1,22 @@
+package grpcapi
+
+import (
+	"github.com/RaikyD/wb-orders-service/internal/grpcapi/ordersv1"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func briefFromRepo(b repository.OrderBrief) *ordersv1.OrderBrief {
+	out := &ordersv1.OrderBrief{
+		Id:          b.ID.String(),
+		OrderUid:    b.OrderUID,
+		TrackNumber: b.TrackNumber,
+		CustomerId:  b.CustomerID,
+		DateCreated: timestamppb.New(b.DateCreated),
+	}
+	if b.AmountCents != nil {
+		v := int64(*b.AmountCents)
+		out.AmountCents = &v
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/audit"
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/grpcapi/ordersv1"
+	"github.com/RaikyD/wb-orders-service/internal/kafka"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/masking"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+const watchBuffer = 64
+
+// Server — gRPC-обёртка над тем же OrdersService и Producer, что и OrdersHandler,
+// поэтому поведение (валидация, ошибки, события) совпадает с HTTP
+type Server struct {
+	ordersv1.UnimplementedOrdersServiceServer
+
+	svc   *application.OrdersService
+	prods kafka.Producers
+	mask  *masking.Rules
+}
+
+func NewServer(svc *application.OrdersService, prods kafka.Producers, mask *masking.Rules) *Server {
+	return &Server{svc: svc, prods: prods, mask: mask}
+}
+
+// NewGRPCServer собирает grpc.Server с авторизацией, health и reflection
+func NewGRPCServer(s *Server, authn *auth.Authenticator) *grpc.Server {
+	g := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryAuth(authn)),
+		grpc.ChainStreamInterceptor(streamAuth(authn)),
+	)
+	ordersv1.RegisterOrdersServiceServer(g, s)
+
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus(ordersv1.OrdersService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(g, hs)
+
+	reflection.Register(g)
+	return g
+}
+
+func (s *Server) CreateOrder(ctx context.Context, req *ordersv1.CreateOrderRequest) (*ordersv1.CreateOrderResponse, error) {
+	if req.GetOrder() == nil {
+		return nil, status.Error(codes.InvalidArgument, "order is required")
+	}
+	prod, err := s.prods.For(auth.TenantFrom(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	ord := ordersv1.OrderToDomain(req.GetOrder())
+	if err := ord.Validate(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	logger.Info("Uploading order on grpc", "order_uid", ord.OrderUID)
+	if err := prod.PublishOrder(ctx, ord); err != nil {
+		return nil, toStatus(err)
+	}
+	s.svc.Audit().Record(ctx, audit.ActionSubmit, auth.TenantFrom(ctx), ord.OrderUID)
+	return &ordersv1.CreateOrderResponse{Status: "accepted", OrderUid: ord.OrderUID}, nil
+}
+
+func (s *Server) GetOrder(ctx context.Context, req *ordersv1.GetOrderRequest) (*ordersv1.GetOrderResponse, error) {
+	uid := strings.TrimSpace(req.GetOrderUid())
+	if uid == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is required")
+	}
+	o, err := s.svc.GetbyUID(ctx, auth.TenantFrom(ctx), uid)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if o == nil {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+	return &ordersv1.GetOrderResponse{Order: ordersv1.OrderFromDomain(s.mask.Order(ctx, o))}, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, req *ordersv1.ListOrdersRequest) (*ordersv1.ListOrdersResponse, error) {
+	// те же границы, что и у GET /orders
+	limit := int(req.GetLimit())
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset := int(req.GetOffset())
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.svc.ListBrief(ctx, auth.TenantFrom(ctx), limit, offset)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	out := &ordersv1.ListOrdersResponse{Rows: make([]*ordersv1.OrderBrief, 0, len(rows))}
+	for _, r := range rows {
+		out.Rows = append(out.Rows, briefFromRepo(r))
+	}
+	return out, nil
+}
+
+func (s *Server) WatchOrders(req *ordersv1.WatchOrdersRequest, stream grpc.ServerStreamingServer[ordersv1.WatchOrdersResponse]) error {
+	tenant := auth.TenantFrom(stream.Context())
+	filter := func(ev application.Event) bool {
+		if ev.Order.Tenant != tenant {
+			return false
+		}
+		if req.GetCustomerId() != "" && ev.Order.CustomerID != req.GetCustomerId() {
+			return false
+		}
+		if req.GetDeliveryService() != "" && ev.Order.DeliveryService != req.GetDeliveryService() {
+			return false
+		}
+		return true
+	}
+
+	pol := s.mask.For(auth.FromContext(stream.Context()))
+	sub, backlog, complete := s.svc.Events().Subscribe(req.GetLastEventId(), req.LastEventId != nil, watchBuffer, filter)
+	defer sub.Close()
+
+	if !complete {
+		if err := stream.Send(&ordersv1.WatchOrdersResponse{Type: "resync"}); err != nil {
+			return err
+		}
+	}
+	push := func(ev application.Event) error {
+		if err := stream.Send(toEvent(ev, pol)); err != nil {
+			return err
+		}
+		s.svc.RecordStreamed(stream.Context(), tenant, ev.Order.OrderUID)
+		return nil
+	}
+	for _, ev := range backlog {
+		if err := push(ev); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.Lagged():
+			return status.Error(codes.ResourceExhausted, "client is too slow, resubscribe with last_event_id")
+		case ev := <-sub.C:
+			if err := push(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toEvent(ev application.Event, pol masking.Policy) *ordersv1.WatchOrdersResponse {
+	return &ordersv1.WatchOrdersResponse{EventId: ev.ID, Type: ev.Type, Order: ordersv1.OrderFromDomain(pol.Apply(ev.Order))}
+}
+
+// toStatus — те же правила, что helpers.WriteError для HTTP
+func toStatus(err error) error {
+	var verr *domain.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return status.Error(codes.InvalidArgument, verr.Error())
+	case errors.Is(err, domain.ErrOrderAlreadyExists):
+		return status.Error(codes.AlreadyExists, "order already exists")
+	case errors.Is(err, domain.ErrNotFound):
+		return status.Error(codes.NotFound, "resource not found")
+	case errors.Is(err, domain.ErrUpstreamUnavailable):
+		logger.Warn("grpc upstream unavailable", "err", err)
+		return status.Error(codes.Unavailable, "dependent service is unavailable, retry later")
+	case errors.Is(err, application.ErrListNotSupported):
+		return status.Error(codes.Unimplemented, "list not supported")
+	}
+	logger.Warn("grpc internal error", "err", err)
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,91 @@
+package codec
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"sync"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/hamba/avro/v2"
+)
+
+//go:embed order.avsc
+var orderAvsc string
+
+// у доменных структур только json-теги, имена полей в order.avsc совпадают с ними
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// Avro пишет по order.avsc, а читает по схеме писателя из registry —
+// так старые сообщения читаются и после эволюции схемы.
+type Avro struct {
+	reg    Registry
+	schema avro.Schema
+
+	mu      sync.RWMutex
+	writers map[int]avro.Schema
+}
+
+func NewAvro(reg Registry) (*Avro, error) {
+	s, err := avro.Parse(orderAvsc)
+	if err != nil {
+		return nil, fmt.Errorf("parse order.avsc: %w", err)
+	}
+	return &Avro{reg: reg, schema: s, writers: make(map[int]avro.Schema)}, nil
+}
+
+func (*Avro) ContentType() string { return ContentTypeAvro }
+
+func (c *Avro) Encode(ctx context.Context, subject string, o *domain.Order) ([]byte, error) {
+	id, err := c.reg.Register(ctx, subject, SchemaAvro, c.schema.String())
+	if err != nil {
+		return nil, fmt.Errorf("register avro schema: %w", err)
+	}
+	body, err := avroAPI.Marshal(c.schema, o)
+	if err != nil {
+		return nil, err
+	}
+	return append(appendHeader(nil, id), body...), nil
+}
+
+func (c *Avro) Decode(ctx context.Context, b []byte, _ int) (*domain.Order, error) {
+	id, rest, err := readHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := c.writerSchema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var o domain.Order
+	if err := avroAPI.Unmarshal(writer, rest, &o); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	o.SchemaVersion = domain.OrderSchemaVersion
+	return &o, nil
+}
+
+func (c *Avro) writerSchema(ctx context.Context, id int) (avro.Schema, error) {
+	c.mu.RLock()
+	s, ok := c.writers[id]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	if err := checkSchema(ctx, c.reg, id, SchemaAvro); err != nil {
+		return nil, err
+	}
+	raw, err := c.reg.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s, err = avro.Parse(raw.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: schema %d: %w", ErrMalformed, id, err)
+	}
+	c.mu.Lock()
+	c.writers[id] = s
+	c.mu.Unlock()
+	return s, nil
+}
@@ -0,0 +1,101 @@
+// Package codec — форматы сообщений с заказами в Kafka. Формат выбирается по заголовку
+// content-type; бинарные форматы идут в wire format Confluent: 0x00 + id схемы (4 байта BE) + тело.
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+
+	magicByte = 0x00
+)
+
+var (
+	// ErrUnknownContentType — такой формат мы не читаем, сообщение уходит в DLQ
+	ErrUnknownContentType = errors.New("unknown content type")
+	// ErrMalformed — тело не разбирается этим кодеком
+	ErrMalformed = errors.New("malformed message")
+)
+
+type Codec interface {
+	ContentType() string
+	// subject — куда регистрировать схему, по умолчанию "<topic>-value"
+	Encode(ctx context.Context, subject string, o *domain.Order) ([]byte, error)
+	// version — из заголовка schema-version, domain.VersionUnknown если его нет.
+	// Бинарные форматы версионируются схемой в registry и его не смотрят.
+	Decode(ctx context.Context, b []byte, version int) (*domain.Order, error)
+}
+
+// Set — кодеки по content-type
+type Set map[string]Codec
+
+// NewSet собирает все поддерживаемые кодеки поверх одного registry
+func NewSet(reg Registry) (Set, error) {
+	avro, err := NewAvro(reg)
+	if err != nil {
+		return nil, err
+	}
+	s := Set{}
+	for _, c := range []Codec{JSON{}, NewProtobuf(reg), avro} {
+		s[c.ContentType()] = c
+	}
+	return s, nil
+}
+
+// For — кодек по заголовку; пустой заголовок — JSON, как писали до появления кодеков
+func (s Set) For(contentType string) (Codec, error) {
+	if contentType == "" {
+		return s[ContentTypeJSON], nil
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownContentType, contentType)
+	}
+	c, ok := s[mt]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownContentType, contentType)
+	}
+	return c, nil
+}
+
+// JSON — прежний формат без registry и без wire-заголовка; версия — schema_version
+type JSON struct{}
+
+func (JSON) ContentType() string { return ContentTypeJSON }
+
+func (JSON) Encode(_ context.Context, _ string, o *domain.Order) ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// Decode поднимает старые версии до текущей; полей вне схемы не терпит — расширения формы
+// приходят новой schema_version, а не молча
+func (JSON) Decode(_ context.Context, b []byte, version int) (*domain.Order, error) {
+	o, err := domain.DecodeOrder(b, version, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return o, nil
+}
+
+func appendHeader(b []byte, schemaID int) []byte {
+	b = append(b, magicByte)
+	return binary.BigEndian.AppendUint32(b, uint32(schemaID))
+}
+
+func readHeader(b []byte) (int, []byte, error) {
+	if len(b) < 5 || b[0] != magicByte {
+		return 0, nil, fmt.Errorf("%w: no schema registry wire header", ErrMalformed)
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:], nil
+}
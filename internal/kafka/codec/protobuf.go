@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/RaikyD/wb-orders-service/api"
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/grpcapi/ordersv1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protobuf — orders.v1.Order из api/orders/v1/orders.proto.
+// После id схемы Confluent пишет путь до сообщения в файле (message indexes, zigzag varint).
+type Protobuf struct {
+	reg Registry
+	// индекс Order среди сообщений верхнего уровня в orders.proto
+	index int
+}
+
+func NewProtobuf(reg Registry) *Protobuf {
+	desc := (&ordersv1.Order{}).ProtoReflect().Descriptor()
+	return &Protobuf{reg: reg, index: desc.Index()}
+}
+
+func (*Protobuf) ContentType() string { return ContentTypeProtobuf }
+
+func (c *Protobuf) Encode(ctx context.Context, subject string, o *domain.Order) ([]byte, error) {
+	id, err := c.reg.Register(ctx, subject, SchemaProtobuf, api.OrdersProto)
+	if err != nil {
+		return nil, fmt.Errorf("register protobuf schema: %w", err)
+	}
+	b := appendHeader(nil, id)
+	if c.index == 0 {
+		// частный случай формата: первое сообщение файла — один нулевой байт
+		b = append(b, 0)
+	} else {
+		b = binary.AppendVarint(b, 1)
+		b = binary.AppendVarint(b, int64(c.index))
+	}
+	return proto.MarshalOptions{}.MarshalAppend(b, ordersv1.OrderFromDomain(o))
+}
+
+func (c *Protobuf) Decode(ctx context.Context, b []byte, _ int) (*domain.Order, error) {
+	id, rest, err := readHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(ctx, c.reg, id, SchemaProtobuf); err != nil {
+		return nil, err
+	}
+
+	path, rest, err := readIndexes(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) != 1 || path[0] != int64(c.index) {
+		return nil, fmt.Errorf("%w: message path %v is not orders.v1.Order", ErrMalformed, path)
+	}
+
+	var m ordersv1.Order
+	if err := proto.Unmarshal(rest, &m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	o := ordersv1.OrderToDomain(&m)
+	o.SchemaVersion = domain.OrderSchemaVersion
+	return &o, nil
+}
+
+func readIndexes(b []byte) ([]int64, []byte, error) {
+	n, size := binary.Varint(b)
+	if size <= 0 || n < 0 || n > 32 {
+		return nil, nil, fmt.Errorf("%w: bad message indexes", ErrMalformed)
+	}
+	b = b[size:]
+	if n == 0 {
+		return []int64{0}, b, nil
+	}
+	path := make([]int64, n)
+	for i := range path {
+		v, size := binary.Varint(b)
+		if size <= 0 {
+			return nil, nil, fmt.Errorf("%w: bad message indexes", ErrMalformed)
+		}
+		path[i], b = v, b[size:]
+	}
+	return path, b, nil
+}
+
+// checkSchema — id должен быть в registry и быть схемой нужного типа.
+// Недоступный registry — не повод выкидывать сообщение, такую ошибку отдаём как есть.
+func checkSchema(ctx context.Context, reg Registry, id int, typ string) error {
+	s, err := reg.SchemaByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSchemaNotFound) {
+			return fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+		return err
+	}
+	if s.Type != typ {
+		return fmt.Errorf("%w: schema %d is %s, want %s", ErrMalformed, id, s.Type, typ)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+)
+
+const (
+	SchemaAvro     = "AVRO"
+	SchemaProtobuf = "PROTOBUF"
+)
+
+var ErrSchemaNotFound = errors.New("schema not found")
+
+type Schema struct {
+	ID      int    `json:"id"`
+	Subject string `json:"subject"`
+	Type    string `json:"schema_type"`
+	Schema  string `json:"schema"`
+}
+
+// Registry — то подмножество API Confluent Schema Registry, которое нужно кодекам
+type Registry interface {
+	// Register возвращает id схемы; повторная регистрация той же схемы отдаёт тот же id
+	Register(ctx context.Context, subject, schemaType, schema string) (int, error)
+	SchemaByID(ctx context.Context, id int) (Schema, error)
+}
+
+// NewRegistry по адресу выбирает реализацию:
+//
+//	""                    — в памяти процесса (продьюсер и консьюмер в одном бинаре)
+//	"file:///path.json"   — локальный файл, подмена registry для тестов и стендов
+//	"http(s)://host:8081" — настоящий Schema Registry
+func NewRegistry(addr string) (Registry, error) {
+	var r Registry
+	switch {
+	case addr == "":
+		r = &FileRegistry{}
+	case strings.HasPrefix(addr, "http://"), strings.HasPrefix(addr, "https://"):
+		r = NewHTTPRegistry(addr)
+	case strings.HasPrefix(addr, "file://"):
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, fmt.Errorf("schema registry url: %w", err)
+		}
+		fr, err := OpenFileRegistry(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		r = fr
+	default:
+		return nil, fmt.Errorf("schema registry url %q: expected http(s):// or file://", addr)
+	}
+	return &cachedRegistry{next: r, ids: make(map[string]int), byID: make(map[int]Schema)}, nil
+}
+
+// cachedRegistry — схемы неизменяемы, так что кэшируем без TTL
+type cachedRegistry struct {
+	next Registry
+	mu   sync.RWMutex
+	ids  map[string]int
+	byID map[int]Schema
+}
+
+func (c *cachedRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	key := subject + "\x00" + schemaType + "\x00" + schema
+	c.mu.RLock()
+	id, ok := c.ids[key]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+	id, err := c.next.Register(ctx, subject, schemaType, schema)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.ids[key] = id
+	c.mu.Unlock()
+	return id, nil
+}
+
+func (c *cachedRegistry) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	c.mu.RLock()
+	s, ok := c.byID[id]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+	s, err := c.next.SchemaByID(ctx, id)
+	if err != nil {
+		return Schema{}, err
+	}
+	c.mu.Lock()
+	c.byID[id] = s
+	c.mu.Unlock()
+	return s, nil
+}
+
+// FileRegistry хранит схемы в JSON-файле; без пути — только в памяти
+type FileRegistry struct {
+	path    string
+	mu      sync.Mutex
+	Schemas []Schema `json:"schemas"`
+}
+
+func OpenFileRegistry(path string) (*FileRegistry, error) {
+	r := &FileRegistry{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schema registry file: %w", err)
+	}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("schema registry file %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *FileRegistry) Register(_ context.Context, subject, schemaType, schema string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	maxID := 0
+	for _, s := range r.Schemas {
+		if s.Subject == subject && s.Type == schemaType && s.Schema == schema {
+			return s.ID, nil
+		}
+		maxID = max(maxID, s.ID)
+	}
+	s := Schema{ID: maxID + 1, Subject: subject, Type: schemaType, Schema: schema}
+	r.Schemas = append(r.Schemas, s)
+
+	if r.path != "" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(r.path, b, 0o644); err != nil {
+			r.Schemas = r.Schemas[:len(r.Schemas)-1]
+			return 0, fmt.Errorf("schema registry file: %w", err)
+		}
+	}
+	return s.ID, nil
+}
+
+func (r *FileRegistry) SchemaByID(_ context.Context, id int) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.Schemas {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Schema{}, fmt.Errorf("schema id %d: %w", id, ErrSchemaNotFound)
+}
+
+// HTTPRegistry — клиент Confluent Schema Registry REST API
+type HTTPRegistry struct {
+	base   string
+	client *http.Client
+}
+
+func NewHTTPRegistry(base string) *HTTPRegistry {
+	return &HTTPRegistry{
+		base:   strings.TrimRight(base, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *HTTPRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	req := map[string]string{"schema": schema}
+	// AVRO — тип по умолчанию, старые версии registry другого поля не знают
+	if schemaType != SchemaAvro {
+		req["schemaType"] = schemaType
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+func (r *HTTPRegistry) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	var resp struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &resp); err != nil {
+		return Schema{}, err
+	}
+	if resp.SchemaType == "" {
+		resp.SchemaType = SchemaAvro
+	}
+	return Schema{ID: id, Type: resp.SchemaType, Schema: resp.Schema}, nil
+}
+
+func (r *HTTPRegistry) do(ctx context.Context, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.base+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: schema registry: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", path, ErrSchemaNotFound)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: schema registry: status %d", domain.ErrUpstreamUnavailable, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("schema registry: status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+	return json.Unmarshal(b, out)
+}
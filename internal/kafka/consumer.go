@@ -2,107 +2,362 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/audit"
 	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/kafka/codec"
 	"github.com/RaikyD/wb-orders-service/internal/logger"
 	"github.com/segmentio/kafka-go"
+	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 type ConsumerConfig struct {
+	Name    string // имя пайплайна, по нему консьюмер выбирают в админке
 	Brokers string
 	Topic   string
 	GroupID string
+	// Tenant проставляется всем заказам из топика; пусто — domain.DefaultTenant
+	Tenant string
+	// ContentType — единственный формат пайплайна, им же читаем сообщения без заголовка.
+	// Пусто — любой из Codecs, без заголовка JSON
+	ContentType string
+	Validation  domain.ValidationProfile
+	// куда писать OrderRejected; nil — отклонённые сообщения просто пропускаются
+	Outbox EventRecorder
+	// кодеки по content-type; nil — только JSON
+	Codecs codec.Set
+	// сюда уходят сообщения в формате, который мы не читаем; nil — пропускаем их
+	DeadLetter *DeadLetter
+	// пороги лага; Interval 0 — лаг не отслеживается
+	Lag LagThresholds
 }
 
-func StartConsumer(ctx context.Context, svc *application.OrdersService, cfg ConsumerConfig) (*kafka.Reader, error) {
-	brokers := strings.Split(cfg.Brokers, ",")
+type EventRecorder interface {
+	Add(ctx context.Context, ev domain.Event) error
+}
+
+// Consumer — цикл чтения топика заказов с управлением из админки: пауза, продолжение, перемотка
+type Consumer struct {
+	svc    *application.OrdersService
+	cfg    ConsumerConfig
+	codecs codec.Set
+	admin  *OffsetAdmin
+
+	mu          sync.Mutex
+	r           *kafka.Reader
+	paused      bool
+	idle        bool          // цикл стоит на паузе и не держит сообщение
+	resumed     chan struct{} // закрывается в Resume
+	cancelFetch context.CancelFunc
+
+	clientID string // по нему находим себя среди участников группы
+	stats    consumerStats
+	lag      lagState
+}
+
+func StartConsumer(ctx context.Context, svc *application.OrdersService, cfg ConsumerConfig) (*Consumer, error) {
+	codecs := cfg.Codecs
+	if codecs == nil {
+		codecs = codec.Set{codec.ContentTypeJSON: codec.JSON{}}
+	}
+	if cfg.ContentType != "" {
+		// чужой формат в топике пайплайна — как неизвестный, в DLQ
+		cd, err := codecs.For(cfg.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: %w", cfg.Name, err)
+		}
+		codecs = codec.Set{cd.ContentType(): cd}
+	}
+	if cfg.Tenant == "" {
+		cfg.Tenant = domain.DefaultTenant
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Tenant
+	}
+	host, _ := os.Hostname()
+	c := &Consumer{
+		svc:      svc,
+		cfg:      cfg,
+		codecs:   codecs,
+		admin:    NewOffsetAdmin(cfg.Brokers, cfg.Topic, cfg.GroupID),
+		clientID: "wb-orders-" + host,
+	}
+	c.r = c.newReader()
+	c.stats.init()
 
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:         brokers,
-		GroupID:         cfg.GroupID,
-		Topic:           cfg.Topic,
+	logger.Info("kafka consumer starting",
+		"pipeline", cfg.Name, "brokers", cfg.Brokers, "topic", cfg.Topic, "group", cfg.GroupID,
+		"tenant", cfg.Tenant, "content_type", cfg.ContentType, "validation", cfg.Validation)
+	go c.run(ctx)
+	if cfg.Lag.Interval > 0 {
+		go c.monitorLag(ctx)
+	}
+	return c, nil
+}
+
+// Name — имя пайплайна
+func (c *Consumer) Name() string {
+	return c.cfg.Name
+}
+
+func (c *Consumer) newReader() *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:         strings.Split(c.cfg.Brokers, ","),
+		GroupID:         c.cfg.GroupID,
+		Topic:           c.cfg.Topic,
+		Dialer:          &kafka.Dialer{ClientID: c.clientID, Timeout: 10 * time.Second, DualStack: true},
 		MinBytes:        1,
 		MaxBytes:        10e6,
 		CommitInterval:  0,
 		StartOffset:     kafka.FirstOffset,
-		ReadLagInterval: -1,
+		ReadLagInterval: -1, // для группы kafka-go лаг не считает, см. monitorLag
 	})
+}
 
-	logger.Info("kafka consumer starting", "brokers", cfg.Brokers, "topic", cfg.Topic, "group", cfg.GroupID)
-
-	go func() {
-		defer r.Close()
-
-		backoff := time.Millisecond * 300
-		for {
-			//m, err := r.FetchMessage(ctx)
-			//if err != nil {
-			//	if ctx.Err() != nil {
-			//		return
-			//	}
-			//	logger.Warn("kafka fetch error", "err", err)
-			//	time.Sleep(backoff)
-			//	continue
-			//}
-			//logger.Info("order fetched", "partition", m.Partition, "offset", m.Offset)
-			//var o domain.Order
-			//if err = json.Unmarshal(m.Value, &o); err != nil {
-			//	logger.Info("kafka invalid json. skip and commit")
-			//
-			//	_ = r.CommitMessages(ctx, m)
-			//	continue
-			//}
-			//logger.Info("order structure is correct || passed Unmarshal check")
-			//if err = svc.AddOrder(ctx, &o); err != nil {
-			//	logger.Warn("kafka add order fail, will retry")
-			//	time.Sleep(backoff)
-			//	continue
-			//}
-			//logger.Info("Order successfully added", "uid", o.OrderUID)
-			//
-			//if err := r.CommitMessages(ctx, m); err != nil {
-			//	logger.Warn("[kafka] commit failed", "err", err)
-			//} else {
-			//	logger.Info("[kafka] committed",
-			//		"topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "uid", o.OrderUID)
-			//}
-			m, err := r.FetchMessage(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					return
-				}
-				logger.Warn("kafka fetch error", "err", err) // было без err
-				time.Sleep(backoff)
-				continue
-			}
-			logger.Info("order fetched", "partition", m.Partition, "offset", m.Offset)
+// Pause останавливает чтение; reader остаётся в группе, партиции за нами.
+// Сообщение, которое уже обрабатывается, дорабатывается до конца.
+func (c *Consumer) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return
+	}
+	c.paused = true
+	c.resumed = make(chan struct{})
+	if c.cancelFetch != nil {
+		c.cancelFetch()
+	}
+	c.stats.setState(StatePausing)
+	logger.Info("kafka consumer paused", "topic", c.cfg.Topic)
+}
 
-			var o domain.Order
-			if err = json.Unmarshal(m.Value, &o); err != nil {
-				logger.Warn("kafka invalid json. skip and commit", "err", err)
-				_ = r.CommitMessages(ctx, m)
-				continue
-			}
+func (c *Consumer) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return
+	}
+	c.paused, c.idle = false, false
+	close(c.resumed)
+	c.stats.setState(StateRunning)
+	logger.Info("kafka consumer resumed", "topic", c.cfg.Topic)
+}
+
+func (c *Consumer) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
 
-			if err = svc.AddOrder(ctx, &o); err != nil {
-				logger.Warn("kafka add order fail, will retry", "err", err)
-				time.Sleep(backoff)
+// PlanRewind — dry-run перемотки группы
+func (c *Consumer) PlanRewind(ctx context.Context, t RewindTarget) (*RewindPlan, error) {
+	return c.admin.Plan(ctx, t)
+}
+
+// Rewind перематывает группу на паузе: reader закрывается (выходим из группы, иначе Kafka
+// не примет коммит), оффсеты коммитятся, reader создаётся заново. Консьюмер остаётся на паузе.
+func (c *Consumer) Rewind(ctx context.Context, t RewindTarget, token string) (*RewindPlan, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused || !c.idle {
+		return nil, ErrNotPaused
+	}
+	// токен проверяем до закрытия reader, чтобы не дёргать группу зря
+	plan, err := c.admin.Plan(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" || token != plan.Token {
+		return plan, ErrTokenMismatch
+	}
+
+	c.stats.setState(StateRewinding)
+	if err := c.r.Close(); err != nil {
+		logger.Warn("kafka reader close failed", "err", err)
+	}
+	defer func() {
+		c.r = c.newReader()
+		c.stats.rewound()
+	}()
+
+	plan, err = c.admin.Apply(ctx, t, token)
+	if err != nil {
+		return plan, err
+	}
+	logger.Info("kafka consumer group rewound",
+		"group", plan.Group, "topic", plan.Topic, "mode", t.Mode, "reprocess", plan.Reprocess, "skip", plan.Skip)
+	return plan, nil
+}
+
+// next ждёт снятия паузы и отдаёт reader вместе с ctx, который Pause может прервать
+func (c *Consumer) next(ctx context.Context) (*kafka.Reader, context.Context, context.CancelFunc, bool) {
+	for {
+		c.mu.Lock()
+		if !c.paused {
+			fctx, cancel := context.WithCancel(ctx)
+			c.cancelFetch = cancel
+			r := c.r
+			c.mu.Unlock()
+			return r, fctx, cancel, true
+		}
+		c.idle = true
+		c.stats.setState(StatePaused)
+		resumed := c.resumed
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, nil, false
+		case <-resumed:
+		}
+	}
+}
+
+func (c *Consumer) run(ctx context.Context) {
+	defer func() {
+		c.mu.Lock()
+		_ = c.r.Close()
+		c.mu.Unlock()
+		c.stats.setState(StateStopped)
+	}()
+
+	backoff := time.Millisecond * 300
+	for {
+		r, fctx, cancel, ok := c.next(ctx)
+		if !ok {
+			return
+		}
+		m, err := r.FetchMessage(fctx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// прервали паузой — уходим ждать в next
+			if c.Paused() {
 				continue
 			}
+			logger.Warn("kafka fetch error", "err", err) // было без err
+			c.stats.fail(err)
+			time.Sleep(backoff)
+			continue
+		}
+		logger.Info("order fetched", "partition", m.Partition, "offset", m.Offset)
+		c.stats.fetched(m)
 
-			logger.Info("Order successfully added", "uid", o.OrderUID)
+		if !c.handle(ctx, r, m) {
+			time.Sleep(backoff)
+		}
+	}
+}
 
-			if err := r.CommitMessages(ctx, m); err != nil {
-				logger.Warn("[kafka] commit failed", "err", err)
-			} else {
-				logger.Info("[kafka] committed", "topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "uid", o.OrderUID)
+// handle обрабатывает одно сообщение; false — не вышло, перед следующим выждать backoff
+func (c *Consumer) handle(ctx context.Context, r *kafka.Reader, m kafka.Message) bool {
+	po, err := decode(ctx, c.codecs, m, c.cfg.ContentType)
+	if errors.Is(err, codec.ErrUnknownContentType) {
+		logger.Warn("kafka unknown content type. to dlq and commit", "err", err)
+		if c.cfg.DeadLetter != nil {
+			if err := c.cfg.DeadLetter.Send(ctx, m, err.Error()); err != nil {
+				logger.Warn("dlq write failed, will retry", "err", err)
+				c.stats.fail(err)
+				return false
 			}
+		}
+		_ = r.CommitMessages(ctx, m)
+		return true
+	}
+	if err != nil {
+		// registry недоступен и т.п. — сообщение не виновато, повторяем
+		if !errors.Is(err, codec.ErrMalformed) {
+			logger.Warn("kafka decode failed, will retry", "err", err)
+			c.stats.fail(err)
+			return false
+		}
+		logger.Warn("kafka malformed message. skip and commit", "err", err)
+		c.stats.fail(err)
+		if !reject(ctx, c.cfg.Outbox, m, string(m.Key), domain.OrderRejectedData{Reason: err.Error()}) {
+			return false
+		}
+		_ = r.CommitMessages(ctx, m)
+		return true
+	}
+	o := *po
+	o.Tenant = c.cfg.Tenant
 
+	if err = c.cfg.Validation.Validate(&o); err != nil {
+		logger.Warn("kafka invalid order. skip and commit", "err", err, "uid", o.OrderUID)
+		c.stats.fail(err)
+		data := domain.OrderRejectedData{Reason: "validation failed"}
+		var verr *domain.ValidationError
+		if errors.As(err, &verr) {
+			data.Fields = verr.Fields
 		}
+		if !reject(ctx, c.cfg.Outbox, m, o.OrderUID, data) {
+			return false
+		}
+		_ = r.CommitMessages(ctx, m)
+		return true
+	}
 
-	}()
-	return r, nil
+	// в журнале доступа запись из топика видна как пайплайн и координаты сообщения
+	actx := audit.WithMeta(ctx, audit.Meta{
+		Actor:     "pipeline:" + c.cfg.Name,
+		Source:    audit.SourceKafka,
+		RequestID: fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset),
+	})
+	if err = c.svc.AddOrder(actx, &o); err != nil {
+		logger.Warn("kafka add order fail, will retry", "err", err)
+		c.stats.fail(err)
+		return false
+	}
+
+	logger.Info("Order successfully added", "uid", o.OrderUID)
+	c.stats.processed(m.Partition, &o)
+
+	if err := r.CommitMessages(ctx, m); err != nil {
+		logger.Warn("[kafka] commit failed", "err", err)
+	} else {
+		logger.Info("[kafka] committed", "topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "uid", o.OrderUID)
+	}
+	return true
+}
+
+// decode выбирает кодек по content-type (без заголовка — fallback) и версию по schema-version
+func decode(ctx context.Context, codecs codec.Set, m kafka.Message, fallback string) (*domain.Order, error) {
+	ct := header(m, "content-type")
+	if ct == "" {
+		ct = fallback
+	}
+	dec, err := codecs.For(ct)
+	if err != nil {
+		return nil, err
+	}
+	version, err := domain.ParseSchemaVersion(header(m, "schema-version"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", codec.ErrMalformed, err)
+	}
+	return dec.Decode(ctx, m.Value, version)
+}
+
+// reject пишет OrderRejected; false — записать не удалось, сообщение коммитить нельзя
+func reject(ctx context.Context, out EventRecorder, m kafka.Message, uid string, data domain.OrderRejectedData) bool {
+	if out == nil {
+		return true
+	}
+	data.Source = &domain.EventSource{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+	ev, err := domain.NewEvent(domain.EventOrderRejected, uid, data)
+	if err != nil {
+		logger.Warn("build rejected event failed", "err", err)
+		return true
+	}
+	if err := out.Add(ctx, ev); err != nil {
+		logger.Warn("outbox insert failed, will retry", "err", err, "type", ev.Type)
+		return false
+	}
+	return true
 }
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки, которые DeadLetter добавляет к исходному сообщению
+const (
+	HeaderDLQReason    = "dlq-reason"
+	HeaderDLQTopic     = "dlq-source-topic"
+	HeaderDLQPartition = "dlq-source-partition"
+	HeaderDLQOffset    = "dlq-source-offset"
+	HeaderDLQFailedAt  = "dlq-failed-at"
+)
+
+// DeadLetter складывает сообщения, которые мы не можем обработать, в отдельный топик —
+// без изменений, с ключом и заголовками оригинала, плюс причина и координаты источника.
+type DeadLetter struct {
+	w *kafka.Writer
+}
+
+func NewDeadLetter(brokersSTR, topic string) *DeadLetter {
+	return &DeadLetter{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokersSTR, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (d *DeadLetter) Close() error {
+	return d.w.Close()
+}
+
+func (d *DeadLetter) Send(ctx context.Context, m kafka.Message, reason string) error {
+	headers := make([]kafka.Header, 0, len(m.Headers)+5)
+	headers = append(headers, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+	return d.w.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers})
+}
+
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
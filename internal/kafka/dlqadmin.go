@@ -0,0 +1,433 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/kafka/codec"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	dlqPreviewBytes = 2048
+	dlqMaxList      = 500
+	dlqReadTimeout  = 5 * time.Second
+
+	// HeaderRedrivenFrom — координаты в DLQ у сообщения, которое оттуда вернули
+	HeaderRedrivenFrom = "dlq-redriven-from"
+)
+
+const (
+	RedriveDone    = "redriven"
+	RedriveSkipped = "already_redriven"
+	RedriveFailed  = "failed"
+)
+
+type RedriveStore interface {
+	Redrive(ctx context.Context, rec repository.DLQRedrive, force bool, publish func() error) (bool, error)
+	Redrives(ctx context.Context, topic string, keys []repository.DLQKey) (map[repository.DLQKey]repository.DLQRedrive, error)
+}
+
+// DLQMessage — сообщение из DLQ с причиной и тем, что из него удалось разобрать
+type DLQMessage struct {
+	Partition       int               `json:"partition"`
+	Offset          int64             `json:"offset"`
+	Time            time.Time         `json:"time"`
+	Key             string            `json:"key"`
+	Reason          string            `json:"reason"`
+	SourceTopic     string            `json:"source_topic,omitempty"`
+	SourcePartition *int              `json:"source_partition,omitempty"`
+	SourceOffset    *int64            `json:"source_offset,omitempty"`
+	FailedAt        string            `json:"failed_at,omitempty"`
+	ContentType     string            `json:"content_type,omitempty"`
+	Headers         map[string]string `json:"headers"`
+	// Order — если тело разобралось кодеком, иначе DecodeError и сырое начало тела в Preview
+	Order          *domain.Order          `json:"order,omitempty"`
+	DecodeError    string                 `json:"decode_error,omitempty"`
+	Preview        string                 `json:"preview,omitempty"`
+	PreviewEncoded string                 `json:"preview_encoding,omitempty"` // "base64", если тело не UTF-8
+	Redrive        *repository.DLQRedrive `json:"redrive,omitempty"`
+}
+
+type DLQQuery struct {
+	Partition *int // nil — все партиции
+	Offset    int64
+	Limit     int
+}
+
+type RedriveRequest struct {
+	All      bool
+	Messages []repository.DLQKey
+	// Patch — JSON Merge Patch (RFC 7396) поверх заказа; с ним сообщение уходит в JSON
+	Patch json.RawMessage
+	Force bool
+	Actor string
+}
+
+type RedriveResult struct {
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DLQAdmin читает DLQ без группы консьюмера и возвращает сообщения в топик, откуда они пришли
+type DLQAdmin struct {
+	brokers []string
+	topic   string
+	targets []string // топики пайплайнов; первый — для сообщений без известного источника
+	offsets *OffsetAdmin
+	codecs  codec.Set
+	store   RedriveStore
+	w       *kafka.Writer
+}
+
+func NewDLQAdmin(brokersSTR, dlqTopic string, targets []string, codecs codec.Set, store RedriveStore) *DLQAdmin {
+	if codecs == nil {
+		codecs = codec.Set{codec.ContentTypeJSON: codec.JSON{}}
+	}
+	return &DLQAdmin{
+		brokers: strings.Split(brokersSTR, ","),
+		topic:   dlqTopic,
+		targets: targets,
+		offsets: NewOffsetAdmin(brokersSTR, dlqTopic, ""),
+		codecs:  codecs,
+		store:   store,
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokersSTR, ",")...),
+			Balancer:     &kafka.Hash{}, // ключ оригинала — та же партиция, что и у соседей по заказу
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (a *DLQAdmin) Close() error {
+	return a.w.Close()
+}
+
+// List — до q.Limit сообщений начиная с q.Offset в каждой выбранной партиции
+func (a *DLQAdmin) List(ctx context.Context, q DLQQuery) ([]DLQMessage, error) {
+	if q.Limit <= 0 || q.Limit > dlqMaxList {
+		q.Limit = 100
+	}
+	var out []DLQMessage
+	err := a.scan(ctx, q.Partition, q.Offset, func(m kafka.Message) bool {
+		out = append(out, a.describe(ctx, m))
+		return len(out) < q.Limit
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]repository.DLQKey, len(out))
+	for i, m := range out {
+		keys[i] = repository.DLQKey{Partition: m.Partition, Offset: m.Offset}
+	}
+	done, err := a.store.Redrives(ctx, a.topic, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if r, ok := done[keys[i]]; ok {
+			out[i].Redrive = &r
+		}
+	}
+	if out == nil {
+		out = []DLQMessage{}
+	}
+	return out, nil
+}
+
+// Redrive отправляет выбранные (или все) сообщения обратно в топики пайплайнов.
+// Уже отправленные пропускаются, если не задан Force; ошибки по одному сообщению не прерывают остальные.
+func (a *DLQAdmin) Redrive(ctx context.Context, req RedriveRequest) ([]RedriveResult, error) {
+	if !req.All && len(req.Messages) == 0 {
+		return nil, &domain.ValidationError{Fields: []domain.FieldError{{Field: "messages", Message: "select messages or set all"}}}
+	}
+	if len(req.Patch) > 0 {
+		var p map[string]any
+		if err := json.Unmarshal(req.Patch, &p); err != nil || p == nil {
+			return nil, &domain.ValidationError{Fields: []domain.FieldError{{Field: "patch", Message: "must be a JSON object (merge patch)"}}}
+		}
+	}
+
+	var results []RedriveResult
+	handle := func(m kafka.Message) bool {
+		results = append(results, a.redriveOne(ctx, m, req))
+		return ctx.Err() == nil
+	}
+
+	if req.All {
+		if err := a.scan(ctx, nil, 0, handle); err != nil {
+			return results, err
+		}
+		return results, nil
+	}
+	for _, k := range req.Messages {
+		p := k.Partition
+		found := false
+		err := a.scan(ctx, &p, k.Offset, func(m kafka.Message) bool {
+			// offset мог быть удалён по retention — тогда reader отдаст следующее
+			if m.Offset == k.Offset {
+				found = true
+				handle(m)
+			}
+			return false
+		})
+		if err != nil {
+			return results, err
+		}
+		if !found {
+			results = append(results, RedriveResult{Partition: k.Partition, Offset: k.Offset, Status: RedriveFailed, Error: "message not found"})
+		}
+	}
+	return results, nil
+}
+
+func (a *DLQAdmin) redriveOne(ctx context.Context, m kafka.Message, req RedriveRequest) RedriveResult {
+	res := RedriveResult{Partition: m.Partition, Offset: m.Offset}
+	out, err := a.prepare(ctx, m, req.Patch)
+	if err != nil {
+		res.Status, res.Error = RedriveFailed, err.Error()
+		return res
+	}
+
+	rec := repository.DLQRedrive{
+		DLQTopic:    a.topic,
+		Partition:   m.Partition,
+		Offset:      m.Offset,
+		TargetTopic: out.Topic,
+		Patched:     len(req.Patch) > 0,
+		Actor:       req.Actor,
+	}
+	ok, err := a.store.Redrive(ctx, rec, req.Force, func() error {
+		return a.w.WriteMessages(ctx, out)
+	})
+	switch {
+	case err != nil:
+		res.Status, res.Error = RedriveFailed, err.Error()
+	case !ok:
+		res.Status = RedriveSkipped
+	default:
+		res.Status = RedriveDone
+	}
+	return res
+}
+
+// prepare — сообщение для основного топика: без dlq-заголовков, с пометкой, откуда пришло
+func (a *DLQAdmin) prepare(ctx context.Context, m kafka.Message, patch json.RawMessage) (kafka.Message, error) {
+	out := kafka.Message{Topic: a.target(m), Key: m.Key, Value: m.Value}
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(strings.ToLower(h.Key), "dlq-") {
+			out.Headers = append(out.Headers, h)
+		}
+	}
+	out.Headers = append(out.Headers, kafka.Header{
+		Key:   HeaderRedrivenFrom,
+		Value: []byte(a.topic + "/" + strconv.Itoa(m.Partition) + "/" + strconv.FormatInt(m.Offset, 10)),
+	})
+	if len(patch) == 0 {
+		return out, nil
+	}
+
+	// с патчем всё приводим к JSON текущей версии: так его правили, так и отправляем
+	doc, err := a.document(ctx, m)
+	if err != nil {
+		return out, err
+	}
+	patched, err := mergePatch(doc, patch)
+	if err != nil {
+		return out, err
+	}
+	o, err := domain.DecodeOrder(patched, domain.VersionUnknown, true)
+	if err != nil {
+		return out, fmt.Errorf("patched order: %w", err)
+	}
+	if err := o.Validate(); err != nil {
+		return out, fmt.Errorf("patched order: %w", err)
+	}
+	if out.Value, err = json.Marshal(o); err != nil {
+		return out, err
+	}
+	out.Key = []byte(o.OrderUID)
+
+	headers := out.Headers[:0]
+	for _, h := range out.Headers {
+		if !strings.EqualFold(h.Key, "content-type") && !strings.EqualFold(h.Key, "schema-version") {
+			headers = append(headers, h)
+		}
+	}
+	out.Headers = append(headers,
+		kafka.Header{Key: "content-type", Value: []byte(codec.ContentTypeJSON)},
+		kafka.Header{Key: "schema-version", Value: []byte(strconv.Itoa(domain.OrderSchemaVersion))},
+	)
+	return out, nil
+}
+
+// target — исходный топик сообщения, если это топик одного из пайплайнов
+func (a *DLQAdmin) target(m kafka.Message) string {
+	if src := header(m, HeaderDLQTopic); slices.Contains(a.targets, src) {
+		return src
+	}
+	return a.targets[0]
+}
+
+// document — JSON-форма тела: через кодек, а если он не справился — как есть, когда это JSON
+func (a *DLQAdmin) document(ctx context.Context, m kafka.Message) ([]byte, error) {
+	if o, err := decode(ctx, a.codecs, m, ""); err == nil {
+		return json.Marshal(o)
+	}
+	if json.Valid(m.Value) {
+		return m.Value, nil
+	}
+	return nil, errors.New("payload is neither decodable nor JSON, cannot patch")
+}
+
+func (a *DLQAdmin) describe(ctx context.Context, m kafka.Message) DLQMessage {
+	d := DLQMessage{
+		Partition:   m.Partition,
+		Offset:      m.Offset,
+		Time:        m.Time,
+		Key:         string(m.Key),
+		Reason:      header(m, HeaderDLQReason),
+		SourceTopic: header(m, HeaderDLQTopic),
+		FailedAt:    header(m, HeaderDLQFailedAt),
+		ContentType: header(m, "content-type"),
+		Headers:     make(map[string]string, len(m.Headers)),
+	}
+	for _, h := range m.Headers {
+		d.Headers[h.Key] = string(h.Value)
+	}
+	if p, err := strconv.Atoi(header(m, HeaderDLQPartition)); err == nil {
+		d.SourcePartition = &p
+	}
+	if off, err := strconv.ParseInt(header(m, HeaderDLQOffset), 10, 64); err == nil {
+		d.SourceOffset = &off
+	}
+
+	o, err := decode(ctx, a.codecs, m, "")
+	if err == nil {
+		d.Order = o
+		return d
+	}
+	d.DecodeError = err.Error()
+	b := m.Value[:min(len(m.Value), dlqPreviewBytes)]
+	if utf8.Valid(b) {
+		d.Preview = string(b)
+	} else {
+		d.Preview, d.PreviewEncoded = base64.StdEncoding.EncodeToString(b), "base64"
+	}
+	return d
+}
+
+// scan читает партиции DLQ от from до текущего конца; fn возвращает false, чтобы остановиться
+func (a *DLQAdmin) scan(ctx context.Context, partition *int, from int64, fn func(kafka.Message) bool) error {
+	parts, err := a.offsets.partitions(ctx)
+	if err != nil {
+		return err
+	}
+	if partition != nil {
+		if !slices.Contains(parts, *partition) {
+			return &domain.ValidationError{Fields: []domain.FieldError{{Field: "partition", Message: "no such partition in " + a.topic}}}
+		}
+		parts = []int{*partition}
+	}
+	first, err := a.offsets.listOffsets(ctx, parts, kafka.FirstOffset)
+	if err != nil {
+		return err
+	}
+	last, err := a.offsets.listOffsets(ctx, parts, kafka.LastOffset)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range parts {
+		start := max(from, first[p])
+		if start >= last[p] {
+			continue
+		}
+		more, err := a.readPartition(ctx, p, start, last[p], fn)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (a *DLQAdmin) readPartition(ctx context.Context, p int, start, end int64, fn func(kafka.Message) bool) (bool, error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   a.brokers,
+		Topic:     a.topic,
+		Partition: p,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+		MaxWait:   500 * time.Millisecond,
+	})
+	defer r.Close()
+	if err := r.SetOffset(start); err != nil {
+		return false, err
+	}
+	for {
+		rctx, cancel := context.WithTimeout(ctx, dlqReadTimeout)
+		m, err := r.FetchMessage(rctx)
+		cancel()
+		if err != nil {
+			return false, fmt.Errorf("%w: read %s/%d: %w", domain.ErrUpstreamUnavailable, a.topic, p, err)
+		}
+		if !fn(m) {
+			return false, nil
+		}
+		if m.Offset+1 >= end {
+			return true, nil
+		}
+	}
+}
+
+// mergePatch — JSON Merge Patch (RFC 7396): null удаляет поле, объекты сливаются, остальное заменяется
+func mergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&target); err != nil {
+		return nil, err
+	}
+	dec = json.NewDecoder(bytes.NewReader(patch))
+	dec.UseNumber()
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	pm, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]any)
+	if !ok {
+		tm = map[string]any{}
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+			continue
+		}
+		tm[k] = mergeValue(tm[k], v)
+	}
+	return tm
+}
@@ -0,0 +1,189 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	lagMessages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wb_orders_consumer_lag_messages",
+		Help: "High watermark minus committed offset of the consumer group, per assigned partition.",
+	}, []string{"topic", "partition"})
+	lagDelay = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wb_orders_consumer_event_delay_seconds",
+		Help: "Now minus date_created of the last processed order while the partition lags; 0 when caught up.",
+	}, []string{"topic", "partition"})
+	committedOffset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wb_orders_consumer_committed_offset",
+		Help: "Committed offset of the consumer group.",
+	}, []string{"topic", "partition"})
+	highWatermark = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wb_orders_consumer_high_watermark",
+		Help: "High watermark of the partition.",
+	}, []string{"topic", "partition"})
+	lagDegraded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wb_orders_consumer_degraded",
+		Help: "1 when lag exceeds KAFKA_LAG_MAX_MESSAGES or KAFKA_LAG_MAX_DELAY.",
+	}, []string{"topic"})
+)
+
+// LagThresholds — когда инстанс считается отстающим; нулевой порог не проверяется
+type LagThresholds struct {
+	Interval    time.Duration
+	MaxMessages int64
+	MaxDelay    time.Duration
+}
+
+type PartitionLag struct {
+	Partition    int     `json:"partition"`
+	Lag          int64   `json:"lag"`
+	DelaySeconds float64 `json:"delay_seconds"`
+}
+
+// LagReport — результат последней проверки; её делает фоновый цикл, /readyz только читает
+type LagReport struct {
+	CheckedAt       time.Time      `json:"checked_at"`
+	Lag             int64          `json:"lag"`
+	MaxDelaySeconds float64        `json:"max_delay_seconds"`
+	Partitions      []PartitionLag `json:"partitions"`
+	Degraded        bool           `json:"degraded"`
+	Reason          string         `json:"reason,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+type lagState struct {
+	mu     sync.Mutex
+	report *LagReport
+	labels map[int]struct{} // партиции, по которым выставлены метрики
+}
+
+// Lag — последняя проверка лага; nil — ещё не проверяли или мониторинг выключен
+func (c *Consumer) Lag() *LagReport {
+	c.lag.mu.Lock()
+	defer c.lag.mu.Unlock()
+	if c.lag.report == nil {
+		return nil
+	}
+	r := *c.lag.report
+	return &r
+}
+
+// monitorLag раз в Interval сверяет оффсеты группы с high watermark назначенных партиций.
+// ReaderConfig.ReadLagInterval тут не помощник: kafka-go не считает лаг для consumer group.
+func (c *Consumer) monitorLag(ctx context.Context) {
+	t := c.cfg.Lag
+	tick := time.NewTicker(t.Interval)
+	defer tick.Stop()
+	for {
+		c.checkLag(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (c *Consumer) checkLag(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, max(c.cfg.Lag.Interval/2, time.Second))
+	defer cancel()
+
+	rep := &LagReport{CheckedAt: time.Now(), Partitions: []PartitionLag{}}
+	g, err := c.admin.Describe(ctx, c.clientID)
+	if err != nil {
+		// прошлую картину не затираем: лаг неизвестен, но и не стал нулём
+		logger.Warn("kafka lag check failed", "err", err, "topic", c.cfg.Topic)
+		c.lag.mu.Lock()
+		if c.lag.report != nil {
+			c.lag.report.Error = err.Error()
+		} else {
+			rep.Error = err.Error()
+			c.lag.report = rep
+		}
+		c.lag.mu.Unlock()
+		return
+	}
+
+	c.stats.mu.Lock()
+	eventTimes := make(map[int]time.Time, len(c.stats.eventTimes))
+	for p, ts := range c.stats.eventTimes {
+		eventTimes[p] = ts
+	}
+	c.stats.mu.Unlock()
+
+	assigned := make(map[int]struct{}, len(g.Assigned))
+	for _, p := range g.Assigned {
+		assigned[p] = struct{}{}
+		from := g.Committed[p]
+		if from < 0 {
+			from = g.LowWatermarks[p]
+		}
+		pl := PartitionLag{Partition: p, Lag: max(g.HighWatermarks[p]-from, 0)}
+		// отставание по времени имеет смысл, только пока есть хвост
+		if ts, ok := eventTimes[p]; ok && pl.Lag > 0 && !ts.IsZero() {
+			pl.DelaySeconds = max(rep.CheckedAt.Sub(ts).Seconds(), 0)
+		}
+		rep.Lag += pl.Lag
+		rep.MaxDelaySeconds = max(rep.MaxDelaySeconds, pl.DelaySeconds)
+		rep.Partitions = append(rep.Partitions, pl)
+
+		part := strconv.Itoa(p)
+		lagMessages.WithLabelValues(c.cfg.Topic, part).Set(float64(pl.Lag))
+		lagDelay.WithLabelValues(c.cfg.Topic, part).Set(pl.DelaySeconds)
+		committedOffset.WithLabelValues(c.cfg.Topic, part).Set(float64(g.Committed[p]))
+		highWatermark.WithLabelValues(c.cfg.Topic, part).Set(float64(g.HighWatermarks[p]))
+	}
+
+	t := c.cfg.Lag
+	switch {
+	case t.MaxMessages > 0 && rep.Lag > t.MaxMessages:
+		rep.Degraded, rep.Reason = true, "lag "+strconv.FormatInt(rep.Lag, 10)+" messages exceeds "+strconv.FormatInt(t.MaxMessages, 10)
+	case t.MaxDelay > 0 && rep.MaxDelaySeconds > t.MaxDelay.Seconds():
+		rep.Degraded, rep.Reason = true, "event-time delay "+time.Duration(rep.MaxDelaySeconds*float64(time.Second)).Round(time.Second).String()+" exceeds "+t.MaxDelay.String()
+	}
+	if rep.Degraded {
+		lagDegraded.WithLabelValues(c.cfg.Topic).Set(1)
+	} else {
+		lagDegraded.WithLabelValues(c.cfg.Topic).Set(0)
+	}
+
+	c.lag.mu.Lock()
+	defer c.lag.mu.Unlock()
+	// после ребаланса уехавшие партиции не должны висеть в метриках со старым значением
+	for p := range c.lag.labels {
+		if _, ok := assigned[p]; !ok {
+			part := strconv.Itoa(p)
+			lagMessages.DeleteLabelValues(c.cfg.Topic, part)
+			lagDelay.DeleteLabelValues(c.cfg.Topic, part)
+			committedOffset.DeleteLabelValues(c.cfg.Topic, part)
+			highWatermark.DeleteLabelValues(c.cfg.Topic, part)
+		}
+	}
+	c.lag.labels = assigned
+
+	was := c.lag.report != nil && c.lag.report.Degraded
+	switch {
+	case rep.Degraded:
+		// пока отстаём — предупреждение на каждой проверке, чтобы алерт по логам не гас
+		logger.Warn("kafka consumer lag above threshold",
+			"pipeline", c.cfg.Name,
+			"topic", c.cfg.Topic,
+			"group", c.cfg.GroupID,
+			"lag", rep.Lag,
+			"max_delay_seconds", rep.MaxDelaySeconds,
+			"threshold_messages", t.MaxMessages,
+			"threshold_delay", t.MaxDelay.String(),
+			"reason", rep.Reason,
+		)
+	case was:
+		logger.Info("kafka consumer lag back to normal", "pipeline", c.cfg.Name, "topic", c.cfg.Topic, "group", c.cfg.GroupID, "lag", rep.Lag)
+	}
+	c.lag.report = rep
+}
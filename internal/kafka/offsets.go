@@ -0,0 +1,314 @@
+package kafka
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	RewindEarliest  = "earliest"
+	RewindTimestamp = "timestamp"
+	RewindOffsets   = "offsets"
+)
+
+var (
+	// ErrNotPaused — перематывать можно только остановленного консьюмера
+	ErrNotPaused = errors.New("consumer is not paused")
+	// ErrTokenMismatch — токен не от этого плана или состояние группы успело измениться
+	ErrTokenMismatch = errors.New("confirmation token does not match the current plan")
+	// ErrGroupActive — в группе есть участники (например, другие инстансы), Kafka не даст закоммитить
+	ErrGroupActive = errors.New("consumer group has active members")
+)
+
+// RewindTarget — куда перемотать группу
+type RewindTarget struct {
+	Mode      string        `json:"mode"`
+	Timestamp time.Time     `json:"timestamp,omitzero"`
+	Offsets   map[int]int64 `json:"offsets,omitempty"`
+}
+
+func (t RewindTarget) Validate() error {
+	verr := &domain.ValidationError{}
+	switch t.Mode {
+	case RewindEarliest:
+	case RewindTimestamp:
+		if t.Timestamp.IsZero() {
+			verr.Add("timestamp", "is required for mode=timestamp")
+		}
+	case RewindOffsets:
+		if len(t.Offsets) == 0 {
+			verr.Add("offsets", "is required for mode=offsets")
+		}
+		for p, off := range t.Offsets {
+			if p < 0 || off < 0 {
+				verr.Add("offsets."+strconv.Itoa(p), "must be non-negative")
+			}
+		}
+	default:
+		verr.Add("mode", "must be earliest, timestamp or offsets")
+	}
+	return verr.Err()
+}
+
+type PartitionRewind struct {
+	Partition int `json:"partition"`
+	// Committed — откуда группа читает сейчас (без коммита — с начала партиции)
+	Committed     int64 `json:"committed"`
+	Target        int64 `json:"target"`
+	LowWatermark  int64 `json:"low_watermark"`
+	HighWatermark int64 `json:"high_watermark"`
+	// Reprocess — сколько уже обработанных сообщений прочитаем ещё раз, Skip — сколько перепрыгнем
+	Reprocess int64 `json:"reprocess"`
+	Skip      int64 `json:"skip"`
+}
+
+// RewindPlan — что произойдёт с группой; Token подтверждает применение именно этого плана
+type RewindPlan struct {
+	Topic      string            `json:"topic"`
+	Group      string            `json:"group"`
+	Target     RewindTarget      `json:"target"`
+	Partitions []PartitionRewind `json:"partitions"`
+	Reprocess  int64             `json:"reprocess"`
+	Skip       int64             `json:"skip"`
+	Token      string            `json:"confirm_token"`
+	Applied    bool              `json:"applied"`
+}
+
+// OffsetAdmin двигает закоммиченные оффсеты группы консьюмера.
+// Повторное чтение безопасно: AddOrder идемпотентен, дубль даёт OrderDuplicateIgnored.
+type OffsetAdmin struct {
+	client *kafka.Client
+	topic  string
+	group  string
+}
+
+func NewOffsetAdmin(brokersSTR, topic, group string) *OffsetAdmin {
+	return &OffsetAdmin{
+		client: &kafka.Client{
+			Addr:    kafka.TCP(strings.Split(brokersSTR, ",")...),
+			Timeout: 10 * time.Second,
+		},
+		topic: topic,
+		group: group,
+	}
+}
+
+// Plan считает перемотку, ничего не меняя
+func (a *OffsetAdmin) Plan(ctx context.Context, t RewindTarget) (*RewindPlan, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	parts, err := a.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	verr := &domain.ValidationError{}
+	for p := range t.Offsets {
+		if !slices.Contains(parts, p) {
+			verr.Add("offsets."+strconv.Itoa(p), "no such partition in "+a.topic)
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	first, err := a.listOffsets(ctx, parts, kafka.FirstOffset)
+	if err != nil {
+		return nil, err
+	}
+	last, err := a.listOffsets(ctx, parts, kafka.LastOffset)
+	if err != nil {
+		return nil, err
+	}
+	var byTime map[int]int64
+	if t.Mode == RewindTimestamp {
+		if byTime, err = a.listOffsets(ctx, parts, t.Timestamp.UnixMilli()); err != nil {
+			return nil, err
+		}
+	}
+	committed, err := a.committed(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &RewindPlan{Topic: a.topic, Group: a.group, Target: t}
+	for _, p := range parts {
+		pr := PartitionRewind{Partition: p, LowWatermark: first[p], HighWatermark: last[p]}
+		pr.Committed = committed[p]
+		// без коммита StartConsumer читает с FirstOffset
+		if pr.Committed < 0 {
+			pr.Committed = pr.LowWatermark
+		}
+
+		switch t.Mode {
+		case RewindEarliest:
+			pr.Target = pr.LowWatermark
+		case RewindTimestamp:
+			// -1 — сообщений после timestamp нет, встаём в конец
+			pr.Target = byTime[p]
+			if pr.Target < 0 {
+				pr.Target = pr.HighWatermark
+			}
+		case RewindOffsets:
+			off, ok := t.Offsets[p]
+			if !ok {
+				off = pr.Committed
+			}
+			pr.Target = off
+		}
+		pr.Target = min(max(pr.Target, pr.LowWatermark), pr.HighWatermark)
+
+		if pr.Target < pr.Committed {
+			pr.Reprocess = pr.Committed - pr.Target
+		} else {
+			pr.Skip = pr.Target - pr.Committed
+		}
+		plan.Reprocess += pr.Reprocess
+		plan.Skip += pr.Skip
+		plan.Partitions = append(plan.Partitions, pr)
+	}
+	plan.Token = plan.token()
+	return plan, nil
+}
+
+// Apply пересчитывает план и коммитит его, если token совпал.
+// Группа должна быть пуста: наш консьюмер к этому моменту закрыт, чужих участников быть не должно.
+func (a *OffsetAdmin) Apply(ctx context.Context, t RewindTarget, token string) (*RewindPlan, error) {
+	plan, err := a.Plan(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" || token != plan.Token {
+		return plan, ErrTokenMismatch
+	}
+
+	gr, err := a.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{a.group}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: describe group: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	for _, g := range gr.Groups {
+		if g.Error != nil {
+			return nil, fmt.Errorf("describe group: %w", g.Error)
+		}
+		if len(g.Members) > 0 {
+			return plan, fmt.Errorf("%w: %d member(s), state %s", ErrGroupActive, len(g.Members), g.GroupState)
+		}
+	}
+
+	commits := make([]kafka.OffsetCommit, len(plan.Partitions))
+	for i, p := range plan.Partitions {
+		commits[i] = kafka.OffsetCommit{Partition: p.Partition, Offset: p.Target, Metadata: "rewind " + plan.Token}
+	}
+	// generation -1 и пустой member — коммит администратора в пустую группу
+	resp, err := a.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      a.group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{a.topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: offset commit: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	for _, p := range resp.Topics[a.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("offset commit partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+func (a *OffsetAdmin) partitions(ctx context.Context) ([]int, error) {
+	md, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{a.topic}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	for _, t := range md.Topics {
+		if t.Name != a.topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("metadata %s: %w", a.topic, t.Error)
+		}
+		ids := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			ids[i] = p.ID
+		}
+		slices.Sort(ids)
+		return ids, nil
+	}
+	return nil, fmt.Errorf("metadata: topic %s not found", a.topic)
+}
+
+// listOffsets — оффсет по timestamp (или FirstOffset/LastOffset) для каждой партиции
+func (a *OffsetAdmin) listOffsets(ctx context.Context, parts []int, ts int64) (map[int]int64, error) {
+	reqs := make([]kafka.OffsetRequest, len(parts))
+	for i, p := range parts {
+		reqs[i] = kafka.OffsetRequest{Partition: p, Timestamp: ts}
+	}
+	resp, err := a.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{a.topic: reqs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: list offsets: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	out := make(map[int]int64, len(parts))
+	for _, p := range resp.Topics[a.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("list offsets partition %d: %w", p.Partition, p.Error)
+		}
+		switch ts {
+		case kafka.FirstOffset:
+			out[p.Partition] = p.FirstOffset
+		case kafka.LastOffset:
+			out[p.Partition] = p.LastOffset
+		default:
+			out[p.Partition] = -1
+			for off := range p.Offsets {
+				out[p.Partition] = off
+			}
+		}
+	}
+	return out, nil
+}
+
+// committed — текущие оффсеты группы; -1 — группа в партицию ещё не коммитила
+func (a *OffsetAdmin) committed(ctx context.Context, parts []int) (map[int]int64, error) {
+	resp, err := a.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: a.group,
+		Topics:  map[string][]int{a.topic: parts},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: offset fetch: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("offset fetch: %w", resp.Error)
+	}
+	out := make(map[int]int64, len(parts))
+	for _, p := range resp.Topics[a.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("offset fetch partition %d: %w", p.Partition, p.Error)
+		}
+		out[p.Partition] = p.CommittedOffset
+	}
+	return out, nil
+}
+
+// token зависит от цели и текущих оффсетов: если группа сдвинулась после dry-run, токен протухает
+func (p *RewindPlan) token() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", p.Topic, p.Group, p.Target.Mode)
+	for _, pr := range p.Partitions {
+		fmt.Fprintf(h, "\x00%d:%d:%d", pr.Partition, pr.Committed, pr.Target)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	outboxBatch    = 100
+	outboxPoll     = 500 * time.Millisecond
+	outboxBackoff  = 3 * time.Second
+	outboxCleanup  = time.Hour
+	outboxRetained = 7 * 24 * time.Hour
+)
+
+type OutboxStore interface {
+	PublishBatch(ctx context.Context, limit int, publish func([]repository.OutboxRecord) error) (int, error)
+	DeletePublished(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// OutboxRelay переносит события из wb.outbox в топик orders.events.
+// Доставка at-least-once: потребители дедуплицируют по event_id (он же в заголовке).
+type OutboxRelay struct {
+	store OutboxStore
+	w     *kafka.Writer
+}
+
+func NewOutboxRelay(store OutboxStore, brokersSTR, topic string) *OutboxRelay {
+	return &OutboxRelay{
+		store: store,
+		w: &kafka.Writer{
+			Addr:  kafka.TCP(strings.Split(brokersSTR, ",")...),
+			Topic: topic,
+			// по ключу order_uid — события одного заказа попадают в одну партицию по порядку
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (r *OutboxRelay) Close() error {
+	return r.w.Close()
+}
+
+// Run крутится, пока жив ctx
+func (r *OutboxRelay) Run(ctx context.Context) {
+	logger.Info("outbox relay started", "topic", r.w.Topic)
+	poll := time.NewTicker(outboxPoll)
+	defer poll.Stop()
+	cleanup := time.NewTicker(outboxCleanup)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			n, err := r.store.DeletePublished(ctx, outboxRetained)
+			if err != nil {
+				logger.Warn("outbox cleanup failed", "err", err)
+			} else if n > 0 {
+				logger.Info("outbox cleaned", "count", n)
+			}
+		case <-poll.C:
+			// пока есть хвост — публикуем без пауз
+			for ctx.Err() == nil {
+				n, err := r.store.PublishBatch(ctx, outboxBatch, r.publish)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Warn("outbox publish failed, will retry", "err", err)
+						time.Sleep(outboxBackoff)
+					}
+					break
+				}
+				if n < outboxBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (r *OutboxRelay) publish(batch []repository.OutboxRecord) error {
+	msgs := make([]kafka.Message, len(batch))
+	for i, rec := range batch {
+		msgs[i] = kafka.Message{
+			Key:   []byte(rec.OrderUID),
+			Value: rec.Payload,
+			Headers: []kafka.Header{
+				{Key: "content-type", Value: []byte("application/json")},
+				{Key: "event-id", Value: []byte(rec.EventID)},
+				{Key: "event-type", Value: []byte(rec.Type)},
+				{Key: "event-version", Value: []byte(strconv.Itoa(rec.Version))},
+			},
+		}
+	}
+	// свой таймаут: ctx relay живёт вечно, а строки держатся под блокировкой
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return r.w.WriteMessages(ctx, msgs...)
+}
@@ -2,20 +2,28 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/kafka/codec"
 	"github.com/segmentio/kafka-go"
+	"strconv"
 	"strings"
 )
 
 type Producer struct {
-	w *kafka.Writer
+	w     *kafka.Writer
+	codec codec.Codec
 }
 
-func NewProducer(brokersSTR, topic string) *Producer {
+// NewProducer — c == nil значит JSON, как было до появления кодеков
+func NewProducer(brokersSTR, topic string, c codec.Codec) *Producer {
 	brokers := strings.Split(brokersSTR, ",")
+	if c == nil {
+		c = codec.JSON{}
+	}
 
 	return &Producer{
+		codec: c,
 		w: &kafka.Writer{
 			Addr:         kafka.TCP(brokers...),
 			Topic:        topic,
@@ -31,17 +39,40 @@ func (p *Producer) Close() error {
 }
 
 func (p *Producer) PublishOrder(ctx context.Context, o domain.Order) error {
-	b, err := json.Marshal(o)
+	// subject по TopicNameStrategy, как у Confluent-клиентов
+	b, err := p.codec.Encode(ctx, p.w.Topic+"-value", &o)
 	if err != nil {
 		return err
 	}
 
 	key := []byte(o.OrderUID)
-	return p.w.WriteMessages(ctx, kafka.Message{
+	err = p.w.WriteMessages(ctx, kafka.Message{
 		Key:   key,
 		Value: b,
 		Headers: []kafka.Header{
-			{Key: "content-type", Value: []byte("application/json")},
+			{Key: "content-type", Value: []byte(p.codec.ContentType())},
+			{Key: "schema-version", Value: []byte(strconv.Itoa(domain.OrderSchemaVersion))},
 		},
 	})
+	if err != nil {
+		return fmt.Errorf("%w: kafka write: %w", domain.ErrUpstreamUnavailable, err)
+	}
+	return nil
+}
+
+// Producers — продьюсеры пайплайнов по тенанту: заказ пишется в топик пайплайна своего тенанта
+type Producers map[string]*Producer
+
+func (ps Producers) For(tenant string) (*Producer, error) {
+	p, ok := ps[tenant]
+	if !ok {
+		return nil, &domain.ValidationError{Fields: []domain.FieldError{{Field: "tenant_id", Message: "no pipeline for tenant " + tenant}}}
+	}
+	return p, nil
+}
+
+func (ps Producers) Close() {
+	for _, p := range ps {
+		_ = p.Close()
+	}
 }
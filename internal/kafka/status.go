@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	StateRunning   = "running"
+	StatePausing   = "pausing" // пауза запрошена, дорабатываем текущее сообщение
+	StatePaused    = "paused"
+	StateRewinding = "rewinding"
+	StateStopped   = "stopped"
+)
+
+type ConsumerError struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+type PartitionStatus struct {
+	Partition int `json:"partition"`
+	// Committed — закоммиченный группой оффсет, с него продолжит чтение; -1 — коммитов не было
+	Committed     int64 `json:"committed"`
+	HighWatermark int64 `json:"high_watermark"`
+	Lag           int64 `json:"lag"`
+	// LastFetched — последний прочитанный этим инстансом оффсет, nil — ещё ничего не читали
+	LastFetched *int64 `json:"last_fetched,omitempty"`
+}
+
+// ConsumerStatus — снимок для GET /admin/consumer
+type ConsumerStatus struct {
+	Pipeline string `json:"pipeline"`
+	Tenant   string `json:"tenant_id"`
+	State    string `json:"state"`
+	Topic    string `json:"topic"`
+	Group    string `json:"group"`
+	ClientID string `json:"client_id"`
+	// Partitions — назначенные этому инстансу; без связи с Kafka — те, что он успел прочитать
+	Partitions      []PartitionStatus `json:"partitions"`
+	Lag             int64             `json:"lag"`
+	GroupMembers    int               `json:"group_members"`
+	Degraded        bool              `json:"degraded"` // по последней проверке лага, см. LagThresholds
+	LastError       *ConsumerError    `json:"last_error,omitempty"`
+	LastOrderUID    string            `json:"last_order_uid,omitempty"`
+	LastProcessedAt *time.Time        `json:"last_processed_at,omitempty"`
+	// KafkaError — не удалось спросить у Kafka назначение и оффсеты, остальное из памяти
+	KafkaError string `json:"kafka_error,omitempty"`
+}
+
+// consumerStats — то, что цикл чтения знает о себе сам, без походов в Kafka
+type consumerStats struct {
+	mu          sync.Mutex
+	state       string
+	positions   map[int]int64
+	eventTimes  map[int]time.Time // date_created последнего обработанного заказа по партиции
+	lastError   *ConsumerError
+	lastUID     string
+	processedAt time.Time
+}
+
+func (s *consumerStats) init() {
+	s.state = StateRunning
+	s.positions = make(map[int]int64)
+	s.eventTimes = make(map[int]time.Time)
+}
+
+func (s *consumerStats) setState(state string) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+func (s *consumerStats) fetched(m kafka.Message) {
+	s.mu.Lock()
+	s.positions[m.Partition] = m.Offset
+	s.mu.Unlock()
+}
+
+func (s *consumerStats) fail(err error) {
+	s.mu.Lock()
+	s.lastError = &ConsumerError{Message: err.Error(), At: time.Now()}
+	s.mu.Unlock()
+}
+
+func (s *consumerStats) processed(partition int, o *domain.Order) {
+	s.mu.Lock()
+	s.lastUID, s.processedAt = o.OrderUID, time.Now()
+	s.eventTimes[partition] = o.DateCreated
+	s.mu.Unlock()
+}
+
+// rewound — после перемотки прочитанные оффсеты больше ни о чём не говорят
+func (s *consumerStats) rewound() {
+	s.mu.Lock()
+	s.state = StatePaused
+	s.positions = make(map[int]int64)
+	s.eventTimes = make(map[int]time.Time)
+	s.mu.Unlock()
+}
+
+// Status собирает состояние цикла и картину группы в Kafka.
+// Если Kafka не отвечает, отдаём то, что есть в памяти, и причину в KafkaError.
+func (c *Consumer) Status(ctx context.Context) ConsumerStatus {
+	c.stats.mu.Lock()
+	st := ConsumerStatus{
+		Pipeline:     c.cfg.Name,
+		Tenant:       c.cfg.Tenant,
+		State:        c.stats.state,
+		Topic:        c.cfg.Topic,
+		Group:        c.cfg.GroupID,
+		ClientID:     c.clientID,
+		LastError:    c.stats.lastError,
+		LastOrderUID: c.stats.lastUID,
+		Partitions:   []PartitionStatus{},
+	}
+	if !c.stats.processedAt.IsZero() {
+		at := c.stats.processedAt
+		st.LastProcessedAt = &at
+	}
+	fetched := make(map[int]int64, len(c.stats.positions))
+	for p, off := range c.stats.positions {
+		fetched[p] = off
+	}
+	c.stats.mu.Unlock()
+	if rep := c.Lag(); rep != nil {
+		st.Degraded = rep.Degraded
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	g, err := c.admin.Describe(ctx, c.clientID)
+	if err != nil {
+		st.KafkaError = err.Error()
+		for p, off := range fetched {
+			st.Partitions = append(st.Partitions, PartitionStatus{Partition: p, Committed: -1, HighWatermark: -1, Lag: -1, LastFetched: &off})
+		}
+		slices.SortFunc(st.Partitions, func(a, b PartitionStatus) int { return a.Partition - b.Partition })
+		return st
+	}
+
+	st.GroupMembers = g.Members
+	for _, p := range g.Assigned {
+		ps := PartitionStatus{Partition: p, Committed: g.Committed[p], HighWatermark: g.HighWatermarks[p]}
+		// без коммита группа начнёт с начала, весь хвост — лаг
+		from := ps.Committed
+		if from < 0 {
+			from = g.LowWatermarks[p]
+		}
+		ps.Lag = max(ps.HighWatermark-from, 0)
+		if off, ok := fetched[p]; ok {
+			ps.LastFetched = &off
+		}
+		st.Lag += ps.Lag
+		st.Partitions = append(st.Partitions, ps)
+	}
+	return st
+}
+
+// GroupView — назначение партиций участнику и оффсеты по ним
+type GroupView struct {
+	Members        int
+	Assigned       []int
+	Committed      map[int]int64
+	LowWatermarks  map[int]int64
+	HighWatermarks map[int]int64
+}
+
+// Describe — партиции, назначенные участнику с clientID, с закоммиченными оффсетами и границами
+func (a *OffsetAdmin) Describe(ctx context.Context, clientID string) (*GroupView, error) {
+	gr, err := a.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{a.group}})
+	if err != nil {
+		return nil, err
+	}
+	v := &GroupView{}
+	for _, g := range gr.Groups {
+		if g.Error != nil {
+			return nil, g.Error
+		}
+		v.Members += len(g.Members)
+		for _, m := range g.Members {
+			if m.ClientID != clientID {
+				continue
+			}
+			for _, t := range m.MemberAssignments.Topics {
+				if t.Topic == a.topic {
+					v.Assigned = append(v.Assigned, t.Partitions...)
+				}
+			}
+		}
+	}
+	slices.Sort(v.Assigned)
+	v.Assigned = slices.Compact(v.Assigned)
+	if len(v.Assigned) == 0 {
+		return v, nil
+	}
+
+	if v.Committed, err = a.committed(ctx, v.Assigned); err != nil {
+		return nil, err
+	}
+	if v.LowWatermarks, err = a.listOffsets(ctx, v.Assigned, kafka.FirstOffset); err != nil {
+		return nil, err
+	}
+	if v.HighWatermarks, err = a.listOffsets(ctx, v.Assigned, kafka.LastOffset); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- ответы на запросы с Idempotency-Key; scope = кто спрашивал + какой роут
+CREATE TABLE wb.idempotency_keys (
+    scope            text        NOT NULL,
+    idem_key         text        NOT NULL,
+    request_hash     text        NOT NULL,
+    state            text        NOT NULL DEFAULT 'in_progress', -- in_progress | completed
+    status_code      integer,
+    content_type     text,
+    response_body    bytea,
+    created_at       timestamptz NOT NULL DEFAULT now(),
+    expires_at       timestamptz NOT NULL,
+    PRIMARY KEY (scope, idem_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON wb.idempotency_keys(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.idempotency_keys;
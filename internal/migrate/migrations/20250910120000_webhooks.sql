@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- подписчики вебхуков; events пустой — значит все типы событий
+CREATE TABLE wb.webhook_subscriptions (
+    id                   uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+    url                  text        NOT NULL,
+    events               text[]      NOT NULL DEFAULT '{}',
+    secret               text        NOT NULL,
+    description          text        NOT NULL DEFAULT '',
+    enabled              boolean     NOT NULL DEFAULT true,
+    disabled_reason      text,
+    consecutive_failures integer     NOT NULL DEFAULT 0,
+    created_at           timestamptz NOT NULL DEFAULT now(),
+    updated_at           timestamptz NOT NULL DEFAULT now()
+);
+
+-- очередь доставок, она же журнал: строка на пару (событие, подписчик)
+CREATE TABLE wb.webhook_deliveries (
+    id               bigserial   PRIMARY KEY,
+    subscription_id  uuid        NOT NULL REFERENCES wb.webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id         uuid        NOT NULL,
+    event_type       text        NOT NULL,
+    payload          jsonb       NOT NULL,
+    state            text        NOT NULL DEFAULT 'pending', -- pending | delivered | failed
+    attempts         integer     NOT NULL DEFAULT 0,
+    next_attempt_at  timestamptz NOT NULL DEFAULT now(),
+    last_status_code integer,
+    last_error       text,
+    created_at       timestamptz NOT NULL DEFAULT now(),
+    delivered_at     timestamptz
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON wb.webhook_deliveries(next_attempt_at) WHERE state = 'pending';
+CREATE INDEX idx_webhook_deliveries_subscription ON wb.webhook_deliveries(subscription_id, id DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.webhook_deliveries;
+DROP TABLE IF EXISTS wb.webhook_subscriptions;
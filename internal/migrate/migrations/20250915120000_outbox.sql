@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- transactional outbox: событие пишется в той же транзакции, что и заказ,
+-- relay потом публикует его в orders.events
+CREATE TABLE wb.outbox (
+    id            bigserial   PRIMARY KEY,
+    event_id      uuid        NOT NULL UNIQUE,
+    event_type    text        NOT NULL,
+    event_version integer     NOT NULL,
+    order_uid     text        NOT NULL,
+    payload       jsonb       NOT NULL, -- конверт domain.Event целиком
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    published_at  timestamptz
+);
+
+CREATE INDEX idx_outbox_unpublished ON wb.outbox(id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_published_at ON wb.outbox(published_at) WHERE published_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.outbox;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- версия JSON-формы в payload (domain.OrderSchemaVersion); 0 — записано до версионирования
+ALTER TABLE wb.orders ADD COLUMN payload_version integer NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_orders_payload_version ON wb.orders(payload_version);
+
+-- +goose Down
+DROP INDEX IF EXISTS wb.idx_orders_payload_version;
+ALTER TABLE wb.orders DROP COLUMN IF EXISTS payload_version;
@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- журнал повторных отправок из DLQ: одно сообщение не уходит в основной топик дважды по ошибке
+CREATE TABLE wb.dlq_redrives (
+    id            bigserial   PRIMARY KEY,
+    dlq_topic     text        NOT NULL,
+    dlq_partition integer     NOT NULL,
+    dlq_offset    bigint      NOT NULL,
+    target_topic  text        NOT NULL,
+    patched       boolean     NOT NULL DEFAULT false,
+    actor         text        NOT NULL DEFAULT '',
+    redrive_count integer     NOT NULL DEFAULT 1, -- >1 — отправляли повторно с force
+    redriven_at   timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (dlq_topic, dlq_partition, dlq_offset)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.dlq_redrives;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- чей заказ: задаётся пайплайном, по нему ограничиваются чтения; старые заказы — тенанта default
+ALTER TABLE wb.orders ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+
+CREATE INDEX idx_orders_tenant_created_at ON wb.orders(tenant_id, created_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS wb.idx_orders_tenant_created_at;
+ALTER TABLE wb.orders DROP COLUMN IF EXISTS tenant_id;
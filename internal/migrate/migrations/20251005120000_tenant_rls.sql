@@ -0,0 +1,87 @@
+-- +goose Up
+
+-- тенант на каждой таблице заказа: политике RLS хватает своей строки, без join с wb.orders
+ALTER TABLE wb.delivery ADD COLUMN tenant_id text;
+ALTER TABLE wb.payment  ADD COLUMN tenant_id text;
+ALTER TABLE wb.items    ADD COLUMN tenant_id text;
+
+UPDATE wb.delivery d SET tenant_id = o.tenant_id FROM wb.orders o WHERE o.id = d.order_id;
+UPDATE wb.payment  p SET tenant_id = o.tenant_id FROM wb.orders o WHERE o.id = p.order_id;
+UPDATE wb.items    i SET tenant_id = o.tenant_id FROM wb.orders o WHERE o.id = i.order_id;
+
+ALTER TABLE wb.delivery ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE wb.payment  ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE wb.items    ALTER COLUMN tenant_id SET NOT NULL;
+-- забытый тенант должен падать на вставке, а не молча уезжать в default
+ALTER TABLE wb.orders   ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- order_uid уникален в пределах тенанта
+ALTER TABLE wb.orders DROP CONSTRAINT orders_order_uid_key;
+ALTER TABLE wb.orders ADD CONSTRAINT orders_tenant_order_uid_key UNIQUE (tenant_id, order_uid);
+
+-- доставка, оплата и позиции — того же тенанта, что и заказ
+ALTER TABLE wb.orders ADD CONSTRAINT orders_id_tenant_key UNIQUE (id, tenant_id);
+ALTER TABLE wb.delivery ADD CONSTRAINT delivery_order_tenant_fkey
+    FOREIGN KEY (order_id, tenant_id) REFERENCES wb.orders(id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE wb.payment ADD CONSTRAINT payment_order_tenant_fkey
+    FOREIGN KEY (order_id, tenant_id) REFERENCES wb.orders(id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE wb.items ADD CONSTRAINT items_order_tenant_fkey
+    FOREIGN KEY (order_id, tenant_id) REFERENCES wb.orders(id, tenant_id) ON DELETE CASCADE;
+
+-- Строки видны, только если транзакция выставила wb.tenant_id (set_config(..., true)) в их тенант;
+-- '*' — служебные проходы по всем тенантам. Не выставила — не видно ничего.
+-- FORCE — чтобы политики действовали и на владельца таблиц. Суперпользователь и роли
+-- с BYPASSRLS их не видят: сервис должен ходить в базу обычной ролью.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wb.tenant_visible(t text)
+RETURNS boolean AS $$
+  SELECT coalesce(current_setting('wb.tenant_id', true), '') IN (t, '*');
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+ALTER TABLE wb.orders   ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment  ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.items    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.orders   FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment  FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.items    FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON wb.orders
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.delivery
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.payment
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.items
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation ON wb.items;
+DROP POLICY IF EXISTS tenant_isolation ON wb.payment;
+DROP POLICY IF EXISTS tenant_isolation ON wb.delivery;
+DROP POLICY IF EXISTS tenant_isolation ON wb.orders;
+ALTER TABLE wb.items    NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment  NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.orders   NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.items    DISABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment  DISABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery DISABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.orders   DISABLE ROW LEVEL SECURITY;
+DROP FUNCTION IF EXISTS wb.tenant_visible(text);
+
+ALTER TABLE wb.items    DROP CONSTRAINT IF EXISTS items_order_tenant_fkey;
+ALTER TABLE wb.payment  DROP CONSTRAINT IF EXISTS payment_order_tenant_fkey;
+ALTER TABLE wb.delivery DROP CONSTRAINT IF EXISTS delivery_order_tenant_fkey;
+ALTER TABLE wb.orders   DROP CONSTRAINT IF EXISTS orders_id_tenant_key;
+
+-- назад к глобальной уникальности: упадёт, если uid уже повторяется между тенантами
+ALTER TABLE wb.orders DROP CONSTRAINT IF EXISTS orders_tenant_order_uid_key;
+ALTER TABLE wb.orders ADD CONSTRAINT orders_order_uid_key UNIQUE (order_uid);
+ALTER TABLE wb.orders ALTER COLUMN tenant_id SET DEFAULT 'default';
+
+ALTER TABLE wb.items    DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE wb.payment  DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE wb.delivery DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,390 @@
+-- +goose Up
+
+-- Заказы режутся помесячно по date_created (UTC). Доставка, оплата и позиции несут копию
+-- date_created и режутся по тем же границам: месяц уходит из всех четырёх таблиц разом,
+-- detach/drop одной партиции каждой таблицы, без DELETE по миллионам строк.
+--
+-- Уникальный ключ партиционированной таблицы обязан включать ключ партиционирования, поэтому
+-- (tenant_id, order_uid) теперь держит отдельная непартиционированная wb.order_keys.
+
+-- вся миграция — служебный проход по всем тенантам
+SELECT set_config('wb.tenant_id', '*', true);
+
+-- старые таблицы отъезжают в сторону вместе с индексами и политиками, имена в wb освобождаются
+CREATE SCHEMA wb_unpartitioned;
+ALTER TABLE wb.items    SET SCHEMA wb_unpartitioned;
+ALTER TABLE wb.payment  SET SCHEMA wb_unpartitioned;
+ALTER TABLE wb.delivery SET SCHEMA wb_unpartitioned;
+ALTER TABLE wb.orders   SET SCHEMA wb_unpartitioned;
+
+CREATE TABLE wb.orders (
+    id                 uuid NOT NULL DEFAULT gen_random_uuid(),
+    order_uid          text NOT NULL,
+    track_number       text NOT NULL,
+    entry              text,
+    locale             text,
+    internal_signature text,
+    customer_id        text,
+    delivery_service   text,
+    shardkey           text,
+    sm_id              integer,
+    date_created       timestamptz NOT NULL,
+    oof_shard          text,
+    payload            jsonb,
+    created_at         timestamptz NOT NULL DEFAULT now(),
+    updated_at         timestamptz NOT NULL DEFAULT now(),
+    payload_version    integer NOT NULL DEFAULT 0,
+    tenant_id          text NOT NULL,
+    PRIMARY KEY (id, date_created),
+    CONSTRAINT orders_id_tenant_key UNIQUE (id, tenant_id, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TRIGGER trg_orders_updated
+BEFORE UPDATE ON wb.orders
+FOR EACH ROW EXECUTE FUNCTION wb.set_updated_at();
+
+CREATE INDEX idx_orders_track_number ON wb.orders(track_number);
+CREATE INDEX idx_orders_date_created ON wb.orders(date_created);
+CREATE INDEX idx_orders_customer_id ON wb.orders(customer_id);
+CREATE INDEX idx_orders_payload_version ON wb.orders(payload_version);
+CREATE INDEX idx_orders_tenant_created_at ON wb.orders(tenant_id, created_at DESC);
+CREATE INDEX idx_orders_tenant_order_uid ON wb.orders(tenant_id, order_uid);
+
+CREATE TABLE wb.delivery (
+  id           uuid NOT NULL DEFAULT gen_random_uuid(),
+  order_id     uuid NOT NULL,
+  name         text,
+  phone        text,
+  zip          text,
+  city         text,
+  address      text,
+  region       text,
+  email        text,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  updated_at   timestamptz NOT NULL DEFAULT now(),
+  tenant_id    text NOT NULL,
+  date_created timestamptz NOT NULL,
+  PRIMARY KEY (id, date_created),
+  CONSTRAINT delivery_order_id_key UNIQUE (order_id, date_created),
+  CONSTRAINT delivery_order_tenant_fkey FOREIGN KEY (order_id, tenant_id, date_created)
+      REFERENCES wb.orders(id, tenant_id, date_created) ON DELETE CASCADE
+) PARTITION BY RANGE (date_created);
+
+CREATE TRIGGER trg_delivery_updated
+BEFORE UPDATE ON wb.delivery
+FOR EACH ROW EXECUTE FUNCTION wb.set_updated_at();
+
+CREATE TABLE wb.payment (
+  id                   uuid NOT NULL DEFAULT gen_random_uuid(),
+  order_id             uuid NOT NULL,
+  transaction          text NOT NULL,
+  request_id           text,
+  currency             text NOT NULL,
+  provider             text,
+  amount_cents         integer NOT NULL,
+  payment_dt           bigint NOT NULL,
+  payment_at           timestamptz GENERATED ALWAYS AS (to_timestamp(payment_dt)) STORED,
+  bank                 text,
+  delivery_cost_cents  integer,
+  goods_total_cents    integer,
+  custom_fee_cents     integer,
+  created_at           timestamptz NOT NULL DEFAULT now(),
+  updated_at           timestamptz NOT NULL DEFAULT now(),
+  tenant_id            text NOT NULL,
+  date_created         timestamptz NOT NULL,
+  PRIMARY KEY (id, date_created),
+  CONSTRAINT payment_order_id_key UNIQUE (order_id, date_created),
+  CONSTRAINT payment_order_tenant_fkey FOREIGN KEY (order_id, tenant_id, date_created)
+      REFERENCES wb.orders(id, tenant_id, date_created) ON DELETE CASCADE
+) PARTITION BY RANGE (date_created);
+
+CREATE TRIGGER trg_payment_updated
+BEFORE UPDATE ON wb.payment
+FOR EACH ROW EXECUTE FUNCTION wb.set_updated_at();
+
+CREATE INDEX idx_payment_payment_at ON wb.payment(payment_at);
+
+CREATE TABLE wb.items (
+  id                 uuid NOT NULL DEFAULT gen_random_uuid(),
+  order_id           uuid NOT NULL,
+  chrt_id            bigint,
+  track_number       text,
+  price_cents        integer NOT NULL,
+  rid                text,
+  name               text,
+  sale               integer,
+  size               text,
+  total_price_cents  integer NOT NULL,
+  nm_id              bigint,
+  brand              text,
+  status             integer,
+  created_at         timestamptz NOT NULL DEFAULT now(),
+  tenant_id          text NOT NULL,
+  date_created       timestamptz NOT NULL,
+  PRIMARY KEY (id, date_created),
+  CONSTRAINT items_order_tenant_fkey FOREIGN KEY (order_id, tenant_id, date_created)
+      REFERENCES wb.orders(id, tenant_id, date_created) ON DELETE CASCADE
+) PARTITION BY RANGE (date_created);
+
+CREATE INDEX idx_items_order_id ON wb.items(order_id);
+CREATE INDEX idx_items_nm_id   ON wb.items(nm_id);
+CREATE INDEX idx_items_status  ON wb.items(status);
+
+-- order_uid уникален в пределах тенанта; заодно по ключу сразу видно месяц заказа
+CREATE TABLE wb.order_keys (
+    tenant_id    text NOT NULL,
+    order_uid    text NOT NULL,
+    order_id     uuid NOT NULL,
+    date_created timestamptz NOT NULL,
+    PRIMARY KEY (tenant_id, order_uid)
+);
+
+CREATE INDEX idx_order_keys_date_created ON wb.order_keys(date_created);
+
+-- Партиции месяца ts во всех четырёх таблицах: wb.orders_2025_10 и т.д., границы по UTC.
+-- Уже есть — ничего не делает. Зовут миграция, фоновый job и вставка заказа за месяц без партиции.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wb.ensure_order_partitions(ts timestamptz)
+RETURNS void AS $$
+DECLARE
+  lo timestamp := date_trunc('month', ts AT TIME ZONE 'UTC');
+  t  text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY['orders', 'delivery', 'payment', 'items'] LOOP
+    EXECUTE format(
+      'CREATE TABLE IF NOT EXISTS wb.%I PARTITION OF wb.%I FOR VALUES FROM (%L) TO (%L)',
+      t || '_' || to_char(lo, 'YYYY_MM'), t,
+      lo AT TIME ZONE 'UTC', (lo + interval '1 month') AT TIME ZONE 'UTC');
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- партиции под все имеющиеся заказы и на три месяца вперёд, дальше их ведёт job
+SELECT wb.ensure_order_partitions(m AT TIME ZONE 'UTC')
+FROM generate_series(
+    date_trunc('month', coalesce((SELECT min(date_created) FROM wb_unpartitioned.orders), now()) AT TIME ZONE 'UTC'),
+    date_trunc('month', now() AT TIME ZONE 'UTC') + interval '3 months',
+    interval '1 month') m;
+
+INSERT INTO wb.orders
+    (id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+     shardkey, sm_id, date_created, oof_shard, payload, created_at, updated_at, payload_version, tenant_id)
+SELECT id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+       shardkey, sm_id, date_created, oof_shard, payload, created_at, updated_at, payload_version, tenant_id
+FROM wb_unpartitioned.orders;
+
+INSERT INTO wb.order_keys (tenant_id, order_uid, order_id, date_created)
+SELECT tenant_id, order_uid, id, date_created FROM wb_unpartitioned.orders;
+
+INSERT INTO wb.delivery
+    (id, order_id, name, phone, zip, city, address, region, email, created_at, updated_at, tenant_id, date_created)
+SELECT d.id, d.order_id, d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+       d.created_at, d.updated_at, d.tenant_id, o.date_created
+FROM wb_unpartitioned.delivery d JOIN wb_unpartitioned.orders o ON o.id = d.order_id;
+
+INSERT INTO wb.payment
+    (id, order_id, transaction, request_id, currency, provider, amount_cents, payment_dt, bank,
+     delivery_cost_cents, goods_total_cents, custom_fee_cents, created_at, updated_at, tenant_id, date_created)
+SELECT p.id, p.order_id, p.transaction, p.request_id, p.currency, p.provider, p.amount_cents, p.payment_dt, p.bank,
+       p.delivery_cost_cents, p.goods_total_cents, p.custom_fee_cents, p.created_at, p.updated_at, p.tenant_id, o.date_created
+FROM wb_unpartitioned.payment p JOIN wb_unpartitioned.orders o ON o.id = p.order_id;
+
+INSERT INTO wb.items
+    (id, order_id, chrt_id, track_number, price_cents, rid, name, sale, size, total_price_cents,
+     nm_id, brand, status, created_at, tenant_id, date_created)
+SELECT i.id, i.order_id, i.chrt_id, i.track_number, i.price_cents, i.rid, i.name, i.sale, i.size, i.total_price_cents,
+       i.nm_id, i.brand, i.status, i.created_at, i.tenant_id, o.date_created
+FROM wb_unpartitioned.items i JOIN wb_unpartitioned.orders o ON o.id = i.order_id;
+
+DROP SCHEMA wb_unpartitioned CASCADE;
+
+-- Политики на родителях: запросы идут через wb.orders и т.п., партиции напрямую никто не читает
+ALTER TABLE wb.orders     ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery   ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.items      ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.order_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.orders     FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery   FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment    FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.items      FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.order_keys FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON wb.orders
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.delivery
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.payment
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.items
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.order_keys
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- сюда retention в режиме archive переносит отцепленные партиции
+CREATE SCHEMA IF NOT EXISTS wb_archive;
+
+-- +goose Down
+SELECT set_config('wb.tenant_id', '*', true);
+
+-- назад в обычные таблицы; отцепленное в wb_archive остаётся как есть
+CREATE SCHEMA wb_partitioned;
+ALTER TABLE wb.items      SET SCHEMA wb_partitioned;
+ALTER TABLE wb.payment    SET SCHEMA wb_partitioned;
+ALTER TABLE wb.delivery   SET SCHEMA wb_partitioned;
+ALTER TABLE wb.orders     SET SCHEMA wb_partitioned;
+DROP TABLE wb.order_keys;
+DROP FUNCTION IF EXISTS wb.ensure_order_partitions(timestamptz);
+
+CREATE TABLE wb.orders (
+    id                 uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_uid          text NOT NULL,
+    track_number       text NOT NULL,
+    entry              text,
+    locale             text,
+    internal_signature text,
+    customer_id        text,
+    delivery_service   text,
+    shardkey           text,
+    sm_id              integer,
+    date_created       timestamptz NOT NULL,
+    oof_shard          text,
+    payload            jsonb,
+    created_at         timestamptz NOT NULL DEFAULT now(),
+    updated_at         timestamptz NOT NULL DEFAULT now(),
+    payload_version    integer NOT NULL DEFAULT 0,
+    tenant_id          text NOT NULL,
+    CONSTRAINT orders_tenant_order_uid_key UNIQUE (tenant_id, order_uid),
+    CONSTRAINT orders_id_tenant_key UNIQUE (id, tenant_id)
+);
+
+CREATE TRIGGER trg_orders_updated
+BEFORE UPDATE ON wb.orders
+FOR EACH ROW EXECUTE FUNCTION wb.set_updated_at();
+
+CREATE INDEX idx_orders_track_number ON wb.orders(track_number);
+CREATE INDEX idx_orders_date_created ON wb.orders(date_created);
+CREATE INDEX idx_orders_customer_id ON wb.orders(customer_id);
+CREATE INDEX idx_orders_payload_version ON wb.orders(payload_version);
+CREATE INDEX idx_orders_tenant_created_at ON wb.orders(tenant_id, created_at DESC);
+
+CREATE TABLE wb.delivery (
+  id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id   uuid NOT NULL UNIQUE,
+  name       text,
+  phone      text,
+  zip        text,
+  city       text,
+  address    text,
+  region     text,
+  email      text,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  tenant_id  text NOT NULL,
+  CONSTRAINT delivery_order_tenant_fkey FOREIGN KEY (order_id, tenant_id)
+      REFERENCES wb.orders(id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER trg_delivery_updated
+BEFORE UPDATE ON wb.delivery
+FOR EACH ROW EXECUTE FUNCTION wb.set_updated_at();
+
+CREATE TABLE wb.payment (
+  id                   uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id             uuid NOT NULL UNIQUE,
+  transaction          text NOT NULL,
+  request_id           text,
+  currency             text NOT NULL,
+  provider             text,
+  amount_cents         integer NOT NULL,
+  payment_dt           bigint NOT NULL,
+  payment_at           timestamptz GENERATED ALWAYS AS (to_timestamp(payment_dt)) STORED,
+  bank                 text,
+  delivery_cost_cents  integer,
+  goods_total_cents    integer,
+  custom_fee_cents     integer,
+  created_at           timestamptz NOT NULL DEFAULT now(),
+  updated_at           timestamptz NOT NULL DEFAULT now(),
+  tenant_id            text NOT NULL,
+  CONSTRAINT payment_order_tenant_fkey FOREIGN KEY (order_id, tenant_id)
+      REFERENCES wb.orders(id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER trg_payment_updated
+BEFORE UPDATE ON wb.payment
+FOR EACH ROW EXECUTE FUNCTION wb.set_updated_at();
+
+CREATE INDEX idx_payment_payment_at ON wb.payment(payment_at);
+
+CREATE TABLE wb.items (
+  id                 uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id           uuid NOT NULL,
+  chrt_id            bigint,
+  track_number       text,
+  price_cents        integer NOT NULL,
+  rid                text,
+  name               text,
+  sale               integer,
+  size               text,
+  total_price_cents  integer NOT NULL,
+  nm_id              bigint,
+  brand              text,
+  status             integer,
+  created_at         timestamptz NOT NULL DEFAULT now(),
+  tenant_id          text NOT NULL,
+  CONSTRAINT items_order_tenant_fkey FOREIGN KEY (order_id, tenant_id)
+      REFERENCES wb.orders(id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_items_order_id ON wb.items(order_id);
+CREATE INDEX idx_items_nm_id   ON wb.items(nm_id);
+CREATE INDEX idx_items_status  ON wb.items(status);
+
+INSERT INTO wb.orders
+    (id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+     shardkey, sm_id, date_created, oof_shard, payload, created_at, updated_at, payload_version, tenant_id)
+SELECT id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+       shardkey, sm_id, date_created, oof_shard, payload, created_at, updated_at, payload_version, tenant_id
+FROM wb_partitioned.orders;
+
+INSERT INTO wb.delivery
+    (id, order_id, name, phone, zip, city, address, region, email, created_at, updated_at, tenant_id)
+SELECT id, order_id, name, phone, zip, city, address, region, email, created_at, updated_at, tenant_id
+FROM wb_partitioned.delivery;
+
+INSERT INTO wb.payment
+    (id, order_id, transaction, request_id, currency, provider, amount_cents, payment_dt, bank,
+     delivery_cost_cents, goods_total_cents, custom_fee_cents, created_at, updated_at, tenant_id)
+SELECT id, order_id, transaction, request_id, currency, provider, amount_cents, payment_dt, bank,
+       delivery_cost_cents, goods_total_cents, custom_fee_cents, created_at, updated_at, tenant_id
+FROM wb_partitioned.payment;
+
+INSERT INTO wb.items
+    (id, order_id, chrt_id, track_number, price_cents, rid, name, sale, size, total_price_cents,
+     nm_id, brand, status, created_at, tenant_id)
+SELECT id, order_id, chrt_id, track_number, price_cents, rid, name, sale, size, total_price_cents,
+       nm_id, brand, status, created_at, tenant_id
+FROM wb_partitioned.items;
+
+DROP SCHEMA wb_partitioned CASCADE;
+
+ALTER TABLE wb.orders   ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment  ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.items    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.orders   FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.delivery FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.payment  FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.items    FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON wb.orders
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.delivery
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.payment
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.items
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- wb_archive не трогаем: там могут лежать архивные партиции
@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- Индекс холодного архива: заказы уехали из wb в сжатые файлы, здесь — в каком файле искать.
+-- Сами данные в Postgres больше не лежат.
+CREATE TABLE wb.archived_orders (
+    tenant_id    text        NOT NULL,
+    order_uid    text        NOT NULL,
+    order_id     uuid        NOT NULL,
+    date_created timestamptz NOT NULL,
+    file         text        NOT NULL,
+    archived_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant_id, order_uid)
+);
+
+CREATE INDEX idx_archived_orders_file ON wb.archived_orders(file);
+
+ALTER TABLE wb.archived_orders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.archived_orders FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON wb.archived_orders
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.archived_orders;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- журнал стираний персональных данных: кто, когда, чьи и сколько заказов. Сами данные не храним
+CREATE TABLE wb.erasures (
+    id          uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id   text        NOT NULL,
+    customer_id text        NOT NULL,
+    orders      integer     NOT NULL,
+    actor       text        NOT NULL DEFAULT '',
+    source      text        NOT NULL,
+    erased_at   timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_erasures_tenant_customer ON wb.erasures(tenant_id, customer_id);
+
+ALTER TABLE wb.erasures ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.erasures FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON wb.erasures
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.erasures;
@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Телефон, email и адрес доставки хранятся зашифрованными (internal/pii), key id — внутри значения.
+-- pii_key_id — каким ключом зашифрована строка, по нему фоновая ротация находит, что перешифровать;
+-- NULL — строка записана открытым текстом, до включения шифрования.
+-- *_bidx — слепые индексы (HMAC нормализованного значения) для поиска по телефону и email.
+ALTER TABLE wb.delivery ADD COLUMN pii_key_id text;
+ALTER TABLE wb.delivery ADD COLUMN phone_bidx text;
+ALTER TABLE wb.delivery ADD COLUMN email_bidx text;
+
+CREATE INDEX idx_delivery_pii_key_id ON wb.delivery(pii_key_id);
+CREATE INDEX idx_delivery_tenant_phone_bidx ON wb.delivery(tenant_id, phone_bidx);
+CREATE INDEX idx_delivery_tenant_email_bidx ON wb.delivery(tenant_id, email_bidx);
+
+-- +goose Down
+DROP INDEX IF EXISTS wb.idx_delivery_tenant_email_bidx;
+DROP INDEX IF EXISTS wb.idx_delivery_tenant_phone_bidx;
+DROP INDEX IF EXISTS wb.idx_delivery_pii_key_id;
+ALTER TABLE wb.delivery DROP COLUMN IF EXISTS email_bidx;
+ALTER TABLE wb.delivery DROP COLUMN IF EXISTS phone_bidx;
+ALTER TABLE wb.delivery DROP COLUMN IF EXISTS pii_key_id;
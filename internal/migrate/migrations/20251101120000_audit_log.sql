@@ -0,0 +1,42 @@
+-- +goose Up
+
+-- журнал доступа к заказам: кто, когда, откуда и что сделал с заказом. Только дописывается
+CREATE TABLE wb.audit_log (
+    id         bigserial   PRIMARY KEY,
+    tenant_id  text        NOT NULL,
+    at         timestamptz NOT NULL DEFAULT now(),
+    actor      text        NOT NULL DEFAULT '',
+    action     text        NOT NULL,
+    order_uid  text        NOT NULL DEFAULT '',
+    request_id text        NOT NULL DEFAULT '',
+    source     text        NOT NULL,
+    fields     text[]      NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX idx_audit_log_tenant_at    ON wb.audit_log(tenant_id, at DESC);
+CREATE INDEX idx_audit_log_tenant_order ON wb.audit_log(tenant_id, order_uid, at DESC);
+CREATE INDEX idx_audit_log_tenant_actor ON wb.audit_log(tenant_id, actor, at DESC);
+
+-- append-only для всех ролей, включая владельца таблицы: GRANT/REVOKE его не остановили бы
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wb.audit_log_append_only()
+RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'wb.audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON wb.audit_log
+    FOR EACH ROW EXECUTE FUNCTION wb.audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON wb.audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION wb.audit_log_append_only();
+
+ALTER TABLE wb.audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.audit_log FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON wb.audit_log
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.audit_log;
+DROP FUNCTION IF EXISTS wb.audit_log_append_only();
@@ -0,0 +1,34 @@
+-- +goose Up
+
+-- версии заказа: полный снимок (payload, доставка зашифрована так же) на каждое изменение.
+-- Версия действует с valid_from до valid_from следующей. Живёт, пока заказ в базе:
+-- уход в холодный архив и по сроку хранения удаляет и историю
+CREATE TABLE wb.order_history (
+    tenant_id    text        NOT NULL,
+    order_uid    text        NOT NULL,
+    version      integer     NOT NULL,
+    order_id     uuid        NOT NULL,
+    date_created timestamptz NOT NULL,
+    change       text        NOT NULL,
+    valid_from   timestamptz NOT NULL DEFAULT now(),
+    snapshot     jsonb       NOT NULL,
+    PRIMARY KEY (tenant_id, order_uid, version)
+);
+
+CREATE INDEX idx_order_history_order_id     ON wb.order_history(order_id);
+CREATE INDEX idx_order_history_date_created ON wb.order_history(date_created);
+
+ALTER TABLE wb.order_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.order_history FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON wb.order_history
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- у существующих заказов история начинается с текущего состояния
+SELECT set_config('wb.tenant_id', '*', true);
+INSERT INTO wb.order_history (tenant_id, order_uid, version, order_id, date_created, change, valid_from, snapshot)
+SELECT tenant_id, order_uid, 1, id, date_created, 'create', created_at, payload
+FROM wb.orders
+WHERE payload IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS wb.order_history;
@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- подписки и доставки принадлежат тенанту: подписчик получает только заказы своего тенанта.
+-- Подписки, заведённые до тенантов, считаются подписками тенанта по умолчанию
+ALTER TABLE wb.webhook_subscriptions ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+ALTER TABLE wb.webhook_subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE wb.webhook_deliveries ADD COLUMN tenant_id text;
+UPDATE wb.webhook_deliveries d SET tenant_id = s.tenant_id
+FROM wb.webhook_subscriptions s WHERE s.id = d.subscription_id;
+ALTER TABLE wb.webhook_deliveries ALTER COLUMN tenant_id SET NOT NULL;
+
+CREATE INDEX idx_webhook_subscriptions_tenant ON wb.webhook_subscriptions(tenant_id, created_at);
+
+ALTER TABLE wb.webhook_subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.webhook_deliveries    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.webhook_subscriptions FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.webhook_deliveries    FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON wb.webhook_subscriptions
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+CREATE POLICY tenant_isolation ON wb.webhook_deliveries
+    USING (wb.tenant_visible(tenant_id)) WITH CHECK (wb.tenant_visible(tenant_id));
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation ON wb.webhook_deliveries;
+DROP POLICY IF EXISTS tenant_isolation ON wb.webhook_subscriptions;
+ALTER TABLE wb.webhook_deliveries    NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.webhook_subscriptions NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE wb.webhook_deliveries    DISABLE ROW LEVEL SECURITY;
+ALTER TABLE wb.webhook_subscriptions DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS wb.idx_webhook_subscriptions_tenant;
+ALTER TABLE wb.webhook_deliveries    DROP COLUMN tenant_id;
+ALTER TABLE wb.webhook_subscriptions DROP COLUMN tenant_id;
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- сервис ходит в базу ролью без прав на DDL (см. deploy/postgres/app-role.sql), а партицию
+-- под заказ нового месяца заводит сам, из AddOrder. Функция создаёт её с правами владельца схемы
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wb.ensure_order_partitions(ts timestamptz)
+RETURNS void AS $$
+DECLARE
+  lo timestamp := date_trunc('month', ts AT TIME ZONE 'UTC');
+  t  text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY['orders', 'delivery', 'payment', 'items'] LOOP
+    EXECUTE format(
+      'CREATE TABLE IF NOT EXISTS wb.%I PARTITION OF wb.%I FOR VALUES FROM (%L) TO (%L)',
+      t || '_' || to_char(lo, 'YYYY_MM'), t,
+      lo AT TIME ZONE 'UTC', (lo + interval '1 month') AT TIME ZONE 'UTC');
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = pg_catalog;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wb.ensure_order_partitions(ts timestamptz)
+RETURNS void AS $$
+DECLARE
+  lo timestamp := date_trunc('month', ts AT TIME ZONE 'UTC');
+  t  text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY['orders', 'delivery', 'payment', 'items'] LOOP
+    EXECUTE format(
+      'CREATE TABLE IF NOT EXISTS wb.%I PARTITION OF wb.%I FOR VALUES FROM (%L) TO (%L)',
+      t || '_' || to_char(lo, 'YYYY_MM'), t,
+      lo AT TIME ZONE 'UTC', (lo + interval '1 month') AT TIME ZONE 'UTC');
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
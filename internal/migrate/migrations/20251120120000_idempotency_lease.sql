@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- аренда ключа на время обработки запроса: упавший без Release процесс держит ключ
+-- до locked_until, а не до expires_at (тот — срок хранения готового ответа)
+ALTER TABLE wb.idempotency_keys ADD COLUMN locked_until timestamptz;
+UPDATE wb.idempotency_keys SET locked_until = now() WHERE state = 'in_progress';
+
+-- +goose Down
+ALTER TABLE wb.idempotency_keys DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,107 @@
+package partitions
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+)
+
+const (
+	ModeArchive = "archive" // отцепить и перенести в схему wb_archive
+	ModeDrop    = "drop"    // отцепить и удалить
+)
+
+type Store interface {
+	EnsureMonths(ctx context.Context, from, to time.Time) error
+	Months(ctx context.Context) ([]time.Time, error)
+	RetireMonth(ctx context.Context, month time.Time, archive bool) error
+}
+
+type Config struct {
+	Interval        time.Duration // как часто проверять; 0 — только один проход на старте
+	PremakeMonths   int           // сколько будущих месяцев держать заготовленными
+	RetentionMonths int           // сколько прошлых месяцев хранить кроме текущего; 0 — хранить всё
+	RetentionMode   string        // ModeArchive | ModeDrop
+}
+
+func (c Config) Validate() error {
+	if c.PremakeMonths < 0 || c.RetentionMonths < 0 {
+		return fmt.Errorf("partition months must not be negative")
+	}
+	if c.RetentionMode != ModeArchive && c.RetentionMode != ModeDrop {
+		return fmt.Errorf("unknown retention mode %q, want %s or %s", c.RetentionMode, ModeArchive, ModeDrop)
+	}
+	return nil
+}
+
+// Maintainer заранее создаёт партиции будущих месяцев и убирает месяцы старше срока хранения
+type Maintainer struct {
+	store Store
+	cfg   Config
+	// forget зовётся после ухода месяцев: всё, что создано раньше отсечки, в базе больше не найти
+	forget func(before time.Time)
+}
+
+func NewMaintainer(store Store, cfg Config, forget func(before time.Time)) *Maintainer {
+	return &Maintainer{store: store, cfg: cfg, forget: forget}
+}
+
+// Run делает проход сразу и дальше раз в Interval, пока жив ctx
+func (m *Maintainer) Run(ctx context.Context) {
+	logger.Info("partition maintainer started",
+		"premake_months", m.cfg.PremakeMonths, "retention_months", m.cfg.RetentionMonths, "mode", m.cfg.RetentionMode)
+	m.tick(ctx, time.Now())
+	if m.cfg.Interval <= 0 {
+		return
+	}
+	t := time.NewTicker(m.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			m.tick(ctx, now)
+		}
+	}
+}
+
+func (m *Maintainer) tick(ctx context.Context, now time.Time) {
+	cur := monthStart(now)
+	if err := m.store.EnsureMonths(ctx, cur, cur.AddDate(0, m.cfg.PremakeMonths, 0)); err != nil {
+		logger.Warn("partition premake failed", "err", err)
+	}
+	if m.cfg.RetentionMonths == 0 {
+		return
+	}
+
+	cutoff := cur.AddDate(0, -m.cfg.RetentionMonths, 0)
+	months, err := m.store.Months(ctx)
+	if err != nil {
+		logger.Warn("partition list failed", "err", err)
+		return
+	}
+	retired := 0
+	for _, month := range months {
+		if !month.Before(cutoff) {
+			break
+		}
+		if err := m.store.RetireMonth(ctx, month, m.cfg.RetentionMode == ModeArchive); err != nil {
+			// следующий месяц не трогаем: месяцы уходят строго по порядку
+			logger.Warn("partition retire failed", "err", err, "month", month.Format("2006-01"))
+			break
+		}
+		logger.Info("partition retired", "month", month.Format("2006-01"), "mode", m.cfg.RetentionMode)
+		retired++
+	}
+	if retired > 0 && m.forget != nil {
+		m.forget(cutoff)
+	}
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,127 @@
+package pii
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrUnknownKey = errors.New("unknown pii key id")
+
+// KeyStore — ключи шифрования ключей (KEK). Ключ данных каждого значения заворачивается
+// ключом CurrentKeyID и хранится рядом с шифротекстом. Интерфейс повторяет Encrypt/Decrypt
+// облачных KMS, так что вместо файла можно подставить их клиента.
+type KeyStore interface {
+	CurrentKeyID() string
+	Wrap(ctx context.Context, keyID string, dek []byte) ([]byte, error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KeyFile — формат PII_KEYS_FILE (пример — deploy/pii-keys.example.json):
+//
+//	{"current": "2025-10", "keys": {"2025-10": "<base64, 32 байта>"}, "index_key": "<base64, 32 байта>"}
+//
+// Старые ключи из keys не удаляем, пока ротация не перешифрует всё под current.
+// index_key не ротируется: по нему считаются слепые индексы, сменить его — перестроить их все.
+type KeyFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// LoadKeyFile читает ключи из файла; возвращает KEK-и и ключ слепых индексов
+func LoadKeyFile(path string) (*FileKeys, []byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read pii keys file: %w", err)
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, nil, fmt.Errorf("parse pii keys file: %w", err)
+	}
+
+	fk := &FileKeys{current: kf.Current, keys: make(map[string]cipher.AEAD, len(kf.Keys))}
+	for id, b64 := range kf.Keys {
+		// id уходит в формат шифротекста через ':'
+		if id == "" || strings.Contains(id, ":") {
+			return nil, nil, fmt.Errorf("pii key id %q: must be non-empty and without ':'", id)
+		}
+		key, err := decodeKey(b64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pii key %q: %w", id, err)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		fk.keys[id] = aead
+	}
+	if _, ok := fk.keys[kf.Current]; !ok {
+		return nil, nil, fmt.Errorf("pii current key %q is not in keys", kf.Current)
+	}
+	index, err := decodeKey(kf.IndexKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pii index_key: %w", err)
+	}
+	return fk, index, nil
+}
+
+func decodeKey(b64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("want 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// FileKeys — KeyStore поверх локального файла: заворачивание — тот же AES-GCM ключом KEK
+type FileKeys struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+func (f *FileKeys) CurrentKeyID() string {
+	return f.current
+}
+
+func (f *FileKeys) Wrap(_ context.Context, keyID string, dek []byte) ([]byte, error) {
+	aead, ok := f.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dek, []byte(keyID)), nil
+}
+
+func (f *FileKeys) Unwrap(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := f.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped pii key too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, wrapped[:n], wrapped[n:], []byte(keyID))
+}
@@ -0,0 +1,215 @@
+package pii
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+)
+
+// Зашифрованное значение — строка prefix<key id>:<завёрнутый ключ данных>:<nonce+шифротекст>,
+// части в base64 без паддинга. Так key id лежит рядом с шифротекстом и в колонке, и в payload.
+const prefix = "pii:v1:"
+
+var (
+	ErrNoKeys    = errors.New("value is encrypted but pii keys are not configured")
+	ErrMalformed = errors.New("malformed encrypted pii value")
+)
+
+// Protector шифрует персональные поля доставки конвертом: у каждого значения свой ключ данных
+// AES-256-GCM, завёрнутый ключом из KeyStore. nil-Protector — шифрования нет, значения как есть.
+type Protector struct {
+	keys  KeyStore
+	index []byte
+}
+
+func New(keys KeyStore, indexKey []byte) *Protector {
+	return &Protector{keys: keys, index: indexKey}
+}
+
+// Sealed — зашифровано ли значение (нашим форматом)
+func Sealed(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// KeyID — каким ключом завёрнуто значение; "" — не зашифровано
+func KeyID(s string) string {
+	if !Sealed(s) {
+		return ""
+	}
+	id, _, _ := strings.Cut(s[len(prefix):], ":")
+	return id
+}
+
+func (p *Protector) CurrentKeyID() string {
+	if p == nil {
+		return ""
+	}
+	return p.keys.CurrentKeyID()
+}
+
+// Seal шифрует s текущим ключом. Пустые строки не шифруются: там нечего прятать,
+// а пустое поле должно оставаться пустым и для стирания данных, и для валидации
+func (p *Protector) Seal(ctx context.Context, s string) (string, error) {
+	if p == nil || s == "" {
+		return s, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	keyID := p.keys.CurrentKeyID()
+	wrapped, err := p.keys.Wrap(ctx, keyID, dek)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ct := aead.Seal(nonce, nonce, []byte(s), []byte(keyID))
+	enc := base64.RawStdEncoding
+	return prefix + keyID + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ct), nil
+}
+
+// Open расшифровывает значение; не зашифрованное (записано до включения шифрования) — как есть
+func (p *Protector) Open(ctx context.Context, s string) (string, error) {
+	if !Sealed(s) {
+		return s, nil
+	}
+	if p == nil {
+		return "", ErrNoKeys
+	}
+	parts := strings.Split(s[len(prefix):], ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ct, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	dek, err := p.keys.Unwrap(ctx, parts[0], wrapped)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	if len(ct) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	n := aead.NonceSize()
+	pt, err := aead.Open(nil, ct[:n], ct[n:], []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// SealDelivery шифрует телефон, email и адрес; остальные поля доставки остаются открытыми
+func (p *Protector) SealDelivery(ctx context.Context, d domain.DeliveryData) (domain.DeliveryData, error) {
+	return p.mapDelivery(d, func(s string) (string, error) { return p.Seal(ctx, s) })
+}
+
+func (p *Protector) OpenDelivery(ctx context.Context, d domain.DeliveryData) (domain.DeliveryData, error) {
+	return p.mapDelivery(d, func(s string) (string, error) { return p.Open(ctx, s) })
+}
+
+func (p *Protector) mapDelivery(d domain.DeliveryData, fn func(string) (string, error)) (domain.DeliveryData, error) {
+	var err error
+	for _, f := range []*string{&d.Phone, &d.Email, &d.Address} {
+		if *f, err = fn(*f); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+const (
+	IndexPhone = "phone"
+	IndexEmail = "email"
+)
+
+// BlindIndex — HMAC-SHA256 нормализованного значения: равные телефоны/email дают равный индекс,
+// а по индексу значение не восстановить. "" — индекса нет (нет ключей или пустое значение)
+func (p *Protector) BlindIndex(kind, value string) string {
+	if p == nil {
+		return ""
+	}
+	v := Normalize(kind, value)
+	if v == "" {
+		return ""
+	}
+	m := hmac.New(sha256.New, p.index)
+	m.Write([]byte(kind + ":" + v))
+	return hex.EncodeToString(m.Sum(nil)[:16])
+}
+
+// Normalize — форма, в которой значения сравниваются: телефон — только цифры, email — в нижнем регистре
+func Normalize(kind, value string) string {
+	switch kind {
+	case IndexPhone:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, value)
+	case IndexEmail:
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	return value
+}
+
+// Rotator — хранилище, умеющее перешифровать пачку значений текущим ключом
+type Rotator interface {
+	RotatePII(ctx context.Context, batch int) (int, error)
+}
+
+// RunRotation раз в every перешифровывает всё, что зашифровано не текущим ключом
+// (или записано до включения шифрования), пачками по batch, пока жив ctx
+func RunRotation(ctx context.Context, r Rotator, every time.Duration, batch int) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			total := 0
+			for ctx.Err() == nil {
+				n, err := r.RotatePII(ctx, batch)
+				if err != nil {
+					logger.Warn("pii rotation failed", "err", err, "rotated", total)
+					break
+				}
+				total += n
+				if n < batch {
+					break
+				}
+			}
+			if total > 0 {
+				logger.Info("pii re-encrypted", "rows", total)
+			}
+		}
+	}
+}
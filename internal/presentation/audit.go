@@ -0,0 +1,86 @@
+package presentation
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+type AuditLog interface {
+	ListAudit(ctx context.Context, tenant string, q repository.AuditQuery) ([]repository.AuditEntry, error)
+}
+
+type AuditHandler struct {
+	log    AuditLog
+	limits *limits.Limits
+}
+
+func NewAuditHandler(log AuditLog, lim *limits.Limits) *AuditHandler {
+	return &AuditHandler{log: log, limits: lim}
+}
+
+// журнал говорит, кто смотрел чьи заказы, — только админам
+func (h *AuditHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersAdmin), h.limits.Route("admin"))
+		r.Get("/admin/audit", h.List)
+	})
+}
+
+// List — ?actor=&order_uid=&from=&to=&limit=&offset=; from и to в RFC 3339, to не включительно
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := repository.AuditQuery{Actor: q.Get("actor"), OrderUID: q.Get("order_uid"), Limit: 100}
+	verr := &domain.ValidationError{}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			verr.Add(p.name, "must be an RFC 3339 timestamp")
+			continue
+		}
+		*p.dst = &t
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		verr.Add("to", "must be after from")
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			verr.Add("limit", "must be between 1 and 1000")
+		}
+		query.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			verr.Add("offset", "must be a non-negative integer")
+		}
+		query.Offset = n
+	}
+	if err := verr.Err(); err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+
+	rows, err := h.log.ListAudit(r.Context(), auth.TenantFrom(r.Context()), query)
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, map[string]any{"rows": rows})
+}
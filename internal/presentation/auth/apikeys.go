@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+)
+
+var (
+	errNoAPIKeys     = errors.New("api keys are not configured")
+	errUnknownAPIKey = errors.New("unknown api key")
+)
+
+// Формат файла:
+// [{"id": "demo-ui", "key_sha256": "<hex sha256 от ключа>", "scopes": ["orders:read"], "tenant_id": "wb"}]
+// В конфиге держим только хэши, сами ключи раздаём клиентам отдельно.
+type apiKeyEntry struct {
+	ID        string   `json:"id"`
+	KeySHA256 string   `json:"key_sha256"`
+	Scopes    []string `json:"scopes"`
+	Tenant    string   `json:"tenant_id"`
+}
+
+type apiKeyStore struct {
+	byHash map[string]*Principal
+}
+
+func loadAPIKeys(path string) (*apiKeyStore, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read api keys file: %w", err)
+	}
+
+	var entries []apiKeyEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("parse api keys file: %w", err)
+	}
+
+	ks := &apiKeyStore{byHash: make(map[string]*Principal, len(entries))}
+	for _, e := range entries {
+		h := strings.ToLower(strings.TrimSpace(e.KeySHA256))
+		if e.ID == "" || len(h) != sha256.Size*2 {
+			return nil, fmt.Errorf("api key %q: id and 64-char key_sha256 are required", e.ID)
+		}
+		if e.Tenant != "" && !domain.ValidTenant(e.Tenant) {
+			return nil, fmt.Errorf("api key %q: bad tenant_id %q", e.ID, e.Tenant)
+		}
+		ks.byHash[h] = &Principal{ID: e.ID, Method: "api_key", Scopes: toScopeSet(e.Scopes), Tenant: e.Tenant}
+	}
+	return ks, nil
+}
+
+func (ks *apiKeyStore) lookup(key string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(key))
+	p, ok := ks.byHash[hex.EncodeToString(sum[:])]
+	if !ok {
+		return nil, errUnknownAPIKey
+	}
+	return p, nil
+}
+
+func toScopeSet(scopes []string) map[string]struct{} {
+	out := make(map[string]struct{}, len(scopes))
+	for _, s := range scopes {
+		if s = strings.TrimSpace(s); s != "" {
+			out[s] = struct{}{}
+		}
+	}
+	return out
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/RaikyD/wb-orders-service/internal/audit"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeOrdersAdmin = "orders:admin"
+	// ScopeOrdersPII — видеть контакты доставки и номер транзакции без маскирования, см. presentation/masking
+	ScopeOrdersPII = "orders:pii"
+)
+
+// Principal — тот, кто пришёл с запросом (ключ или субъект из JWT)
+type Principal struct {
+	ID     string
+	Method string // "api_key" | "jwt" | "anonymous"
+	Scopes map[string]struct{}
+	// Tenant — к чьим заказам привязаны учётные данные; пусто — см. ResolveTenant
+	Tenant string
+}
+
+// orders:admin покрывает все остальные scope'ы
+func (p *Principal) Has(scope string) bool {
+	if p == nil {
+		return false
+	}
+	if _, ok := p.Scopes[ScopeOrdersAdmin]; ok {
+		return true
+	}
+	_, ok := p.Scopes[scope]
+	return ok
+}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+type Config struct {
+	Enabled     bool
+	APIKeysFile string
+	HS256Secret string
+	JWKSFile    string
+	JWTIssuer   string
+	JWTAudience string
+}
+
+type Authenticator struct {
+	enabled bool
+	keys    *apiKeyStore
+	jwt     *jwtVerifier
+}
+
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	a := &Authenticator{enabled: cfg.Enabled}
+	if !cfg.Enabled {
+		return a, nil
+	}
+
+	if cfg.APIKeysFile != "" {
+		ks, err := loadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = ks
+	}
+
+	if cfg.HS256Secret != "" || cfg.JWKSFile != "" {
+		v, err := newJWTVerifier(cfg.HS256Secret, cfg.JWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+
+	if a.keys == nil && a.jwt == nil {
+		logger.Warn("auth enabled but no api keys or jwt keys configured; every protected route will answer 401")
+	}
+	return a, nil
+}
+
+// Middleware только определяет, кто пришёл. Запросы без учётных данных пропускаем дальше
+// (статика открыта), а вот битые/неизвестные креды сразу режем 401.
+// Права проверяет RequireScope на конкретных роутах.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r.Header)
+		if err != nil {
+			logger.Warn("auth rejected", "err", err, "path", r.URL.Path, "request_id", middleware.GetReqID(r.Context()))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wb-orders"`)
+			helpers.HttpError(w, r, http.StatusUnauthorized, helpers.CodeUnauthorized, "invalid credentials")
+			return
+		}
+		if p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Authenticate разбирает учётные данные из заголовков (HTTP или gRPC metadata).
+// Нет учётных данных — (nil, nil); при выключенной авторизации — анонимный админ.
+func (a *Authenticator) Authenticate(h http.Header) (*Principal, error) {
+	if !a.enabled {
+		return &Principal{
+			ID:     "anonymous",
+			Method: "anonymous",
+			Scopes: map[string]struct{}{ScopeOrdersAdmin: {}},
+		}, nil
+	}
+
+	switch {
+	case h.Get("X-API-Key") != "":
+		return a.fromAPIKey(h.Get("X-API-Key"))
+	case hasScheme(h, "ApiKey"):
+		return a.fromAPIKey(credentials(h))
+	case hasScheme(h, "Bearer"):
+		return a.fromBearer(credentials(h))
+	}
+	return nil, nil
+}
+
+func (a *Authenticator) fromAPIKey(key string) (*Principal, error) {
+	if a.keys == nil {
+		return nil, errNoAPIKeys
+	}
+	return a.keys.lookup(key)
+}
+
+func (a *Authenticator) fromBearer(token string) (*Principal, error) {
+	if a.jwt == nil {
+		return nil, errNoJWT
+	}
+	return a.jwt.verify(token)
+}
+
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := FromContext(r.Context())
+			if p == nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="wb-orders"`)
+				helpers.HttpError(w, r, http.StatusUnauthorized, helpers.CodeUnauthorized, "authentication required")
+				return
+			}
+			if !p.Has(scope) {
+				helpers.HttpError(w, r, http.StatusForbidden, helpers.CodeForbidden, "missing scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePlatform пускает только учётные данные без tenant_id — операторов площадки.
+// Ставится после RequireScope на роуты, которые трогают общее для всех тенантов (DLQ, консьюмеры)
+func RequirePlatform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := FromContext(r.Context()); p == nil || p.Tenant != "" {
+			helpers.HttpError(w, r, http.StatusForbidden, helpers.CodeForbidden, "credentials bound to a tenant cannot manage shared resources")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuditContext кладёт в контекст, кто делает запрос, для журнала доступа к заказам (audit.Log);
+// ставится после Authenticator.Middleware и middleware.RequestID
+func AuditContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := audit.Meta{Source: audit.SourceHTTP, RequestID: middleware.GetReqID(r.Context())}
+		if p := FromContext(r.Context()); p != nil {
+			m.Actor = p.ID
+		}
+		next.ServeHTTP(w, r.WithContext(audit.WithMeta(r.Context(), m)))
+	})
+}
+
+// AuditWrites пишет в лог, кто и что менял. Вешается на пишущие роуты после RequireScope.
+func AuditWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		actor, method := "", ""
+		if p := FromContext(r.Context()); p != nil {
+			actor, method = p.ID, p.Method
+		}
+		logger.Info("audit write",
+			"actor", actor,
+			"auth_method", method,
+			"tenant", TenantFrom(r.Context()),
+			"http_method", r.Method,
+			"path", r.URL.Path,
+			"status", ww.Status(),
+			"request_id", middleware.GetReqID(r.Context()),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+func hasScheme(hdr http.Header, scheme string) bool {
+	h := hdr.Get("Authorization")
+	return len(h) > len(scheme) && strings.EqualFold(h[:len(scheme)], scheme) && h[len(scheme)] == ' '
+}
+
+func credentials(hdr http.Header) string {
+	h := hdr.Get("Authorization")
+	if i := strings.IndexByte(h, ' '); i >= 0 {
+		return strings.TrimSpace(h[i+1:])
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var errNoJWT = errors.New("jwt auth is not configured")
+
+type jwtVerifier struct {
+	hsSecret []byte
+	rsKeys   map[string]*rsa.PublicKey // kid -> key
+	parser   *jwt.Parser
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Scope  string   `json:"scope"` // "orders:read orders:write"
+	Scp    []string `json:"scp"`
+	Tenant string   `json:"tenant_id"`
+}
+
+func newJWTVerifier(hsSecret, jwksFile, issuer, audience string) (*jwtVerifier, error) {
+	v := &jwtVerifier{hsSecret: []byte(hsSecret)}
+
+	methods := make([]string, 0, 2)
+	if hsSecret != "" {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if jwksFile != "" {
+		keys, err := loadJWKS(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		v.rsKeys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+func (v *jwtVerifier) verify(raw string) (*Principal, error) {
+	var c claims
+	_, err := v.parser.ParseWithClaims(raw, &c, v.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if c.Subject == "" {
+		return nil, errors.New("jwt: sub claim is required")
+	}
+
+	if c.Tenant != "" && !domain.ValidTenant(c.Tenant) {
+		return nil, errors.New("jwt: bad tenant_id claim")
+	}
+
+	scopes := append(strings.Fields(c.Scope), c.Scp...)
+	return &Principal{ID: c.Subject, Method: "jwt", Scopes: toScopeSet(scopes), Tenant: c.Tenant}, nil
+}
+
+func (v *jwtVerifier) keyFunc(t *jwt.Token) (any, error) {
+	switch t.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.hsSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := t.Header["kid"].(string)
+		if k, ok := v.rsKeys[kid]; ok {
+			return k, nil
+		}
+		// без kid допускаем только если ключ в JWKS единственный
+		if kid == "" && len(v.rsKeys) == 1 {
+			for _, k := range v.rsKeys {
+				return k, nil
+			}
+		}
+		return nil, fmt.Errorf("jwt: unknown kid %q", kid)
+	}
+	return nil, fmt.Errorf("jwt: unexpected alg %s", t.Method.Alg())
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// loadJWKS читает локальный JWKS-файл, берём только RSA-ключи для подписи
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks file: %w", err)
+	}
+	var set jwks
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks file: %w", err)
+	}
+
+	out := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwks kid %q: bad n: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwks kid %q: bad e: %w", k.Kid, err)
+		}
+		out[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("jwks file contains no RSA signing keys")
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+)
+
+// HeaderTenant — какого тенанта запрос хочет видеть. EventSource и WebSocket из браузера
+// заголовков не ставят, им то же самое можно передать в ?tenant=
+const HeaderTenant = "X-Tenant-ID"
+
+var (
+	ErrBadTenant       = errors.New("bad tenant id")
+	ErrTenantForbidden = errors.New("tenant is not allowed for these credentials")
+)
+
+type tenantKey struct{}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom — тенант запроса; не выставлен — domain.DefaultTenant
+func TenantFrom(ctx context.Context) string {
+	if t, _ := ctx.Value(tenantKey{}).(string); t != "" {
+		return t
+	}
+	return domain.DefaultTenant
+}
+
+// ResolveTenant решает, чьи заказы видит запрос. Тенант берётся из учётных данных:
+//   - ключ или токен с tenant_id видят только его, X-Tenant-ID может лишь совпадать с ним;
+//   - orders:admin без tenant_id (оператор площадки, выключенная авторизация) выбирает тенант заголовком;
+//   - остальные без tenant_id — старые ключи — привязаны к domain.DefaultTenant.
+//
+// "" — не указан, см. TenantFrom.
+func ResolveTenant(p *Principal, h http.Header, query string) (string, error) {
+	want := h.Get(HeaderTenant)
+	if want == "" {
+		want = query
+	}
+	if want != "" && !domain.ValidTenant(want) {
+		return "", ErrBadTenant
+	}
+
+	switch {
+	case p == nil:
+		// без учётных данных до заказов не дойти, RequireScope не пустит
+		return want, nil
+	case p.Tenant != "":
+		if want != "" && want != p.Tenant {
+			return "", ErrTenantForbidden
+		}
+		return p.Tenant, nil
+	case p.Has(ScopeOrdersAdmin):
+		return want, nil
+	case want != "" && want != domain.DefaultTenant:
+		return "", ErrTenantForbidden
+	}
+	return domain.DefaultTenant, nil
+}
+
+// Tenants кладёт тенант запроса в контекст; ставится после Authenticator.Middleware
+func Tenants(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, err := ResolveTenant(FromContext(r.Context()), r.Header, r.URL.Query().Get("tenant"))
+		switch {
+		case errors.Is(err, ErrBadTenant):
+			helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{
+				Field: HeaderTenant, Message: "must be lowercase letters, digits, '-' or '_', up to 63 chars",
+			}}})
+			return
+		case err != nil:
+			helpers.HttpError(w, r, http.StatusForbidden, helpers.CodeForbidden, err.Error())
+			return
+		case t == "":
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), t)))
+	})
+}
@@ -0,0 +1,146 @@
+package presentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/kafka"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/go-chi/chi/v5"
+)
+
+type ConsumerControl interface {
+	Name() string
+	Pause()
+	Resume()
+	Status(ctx context.Context) kafka.ConsumerStatus
+	PlanRewind(ctx context.Context, t kafka.RewindTarget) (*kafka.RewindPlan, error)
+	Rewind(ctx context.Context, t kafka.RewindTarget, token string) (*kafka.RewindPlan, error)
+}
+
+type ConsumerHandler struct {
+	consumers []ConsumerControl // по одному на пайплайн
+	limits    *limits.Limits
+}
+
+func NewConsumerHandler(cs []ConsumerControl, lim *limits.Limits) *ConsumerHandler {
+	return &ConsumerHandler{consumers: cs, limits: lim}
+}
+
+// управление консьюмером — только админам, изменения с аудитом площадки: пайплайны и DLQ общие для всех тенантов
+func (h *ConsumerHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersAdmin), auth.RequirePlatform, h.limits.Route("admin"))
+		r.Get("/admin/consumer", h.Status)
+		r.Group(func(r chi.Router) {
+			r.Use(auth.AuditWrites)
+			r.Post("/admin/consumer/pause", h.Pause)
+			r.Post("/admin/consumer/resume", h.Resume)
+			r.Post("/admin/consumer/rewind", h.Rewind)
+		})
+	})
+}
+
+// pick — консьюмер пайплайна из ?pipeline=; если пайплайн один, можно не указывать
+func (h *ConsumerHandler) pick(w http.ResponseWriter, r *http.Request) (ConsumerControl, bool) {
+	name := r.URL.Query().Get("pipeline")
+	if name == "" && len(h.consumers) == 1 {
+		return h.consumers[0], true
+	}
+	names := make([]string, 0, len(h.consumers))
+	for _, c := range h.consumers {
+		if c.Name() == name {
+			return c, true
+		}
+		names = append(names, c.Name())
+	}
+	if name == "" {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{
+			Field: "pipeline", Message: "is required, one of: " + strings.Join(names, ", "),
+		}}})
+		return nil, false
+	}
+	helpers.WriteError(w, r, fmt.Errorf("pipeline %q: %w", name, domain.ErrNotFound))
+	return nil, false
+}
+
+// Status — состояние, назначенные партиции, оффсеты, лаг, последняя ошибка и заказ
+func (h *ConsumerHandler) Status(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.pick(w, r)
+	if !ok {
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, c.Status(r.Context()))
+}
+
+// Pause — чтение встаёт, но консьюмер остаётся в группе: партиции не уезжают на другие инстансы
+func (h *ConsumerHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.pick(w, r)
+	if !ok {
+		return
+	}
+	c.Pause()
+	helpers.WriteJSON(w, http.StatusOK, c.Status(r.Context()))
+}
+
+func (h *ConsumerHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.pick(w, r)
+	if !ok {
+		return
+	}
+	c.Resume()
+	helpers.WriteJSON(w, http.StatusOK, c.Status(r.Context()))
+}
+
+type rewindRequest struct {
+	kafka.RewindTarget
+	DryRun       bool   `json:"dry_run"`
+	ConfirmToken string `json:"confirm_token"`
+}
+
+// Rewind — в два шага: dry_run=true возвращает план с confirm_token, затем тот же запрос
+// с токеном на остановленном консьюмере применяет его
+func (h *ConsumerHandler) Rewind(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.pick(w, r)
+	if !ok {
+		return
+	}
+	var req rewindRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if !req.DryRun && req.ConfirmToken == "" {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{
+			Field: "confirm_token", Message: "is required; get one with dry_run=true",
+		}}})
+		return
+	}
+
+	var (
+		plan *kafka.RewindPlan
+		err  error
+	)
+	if req.DryRun {
+		plan, err = c.PlanRewind(r.Context(), req.RewindTarget)
+	} else {
+		plan, err = c.Rewind(r.Context(), req.RewindTarget, req.ConfirmToken)
+	}
+	switch {
+	case errors.Is(err, kafka.ErrNotPaused):
+		helpers.HttpError(w, r, http.StatusConflict, helpers.CodeConsumerNotPaused, "pause the consumer first: POST /admin/consumer/pause")
+	case errors.Is(err, kafka.ErrTokenMismatch):
+		helpers.HttpError(w, r, http.StatusConflict, helpers.CodeConfirmationMismatch, "confirm_token does not match the current plan, run dry_run again")
+	case errors.Is(err, kafka.ErrGroupActive):
+		helpers.HttpError(w, r, http.StatusConflict, helpers.CodeConsumerGroupActive, err.Error())
+	case err != nil:
+		helpers.WriteError(w, r, err)
+	default:
+		helpers.WriteJSON(w, http.StatusOK, plan)
+	}
+}
@@ -0,0 +1,131 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/kafka"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+type DLQ interface {
+	List(ctx context.Context, q kafka.DLQQuery) ([]kafka.DLQMessage, error)
+	Redrive(ctx context.Context, req kafka.RedriveRequest) ([]kafka.RedriveResult, error)
+}
+
+type DLQHandler struct {
+	dlq    DLQ
+	limits *limits.Limits
+}
+
+func NewDLQHandler(dlq DLQ, lim *limits.Limits) *DLQHandler {
+	return &DLQHandler{dlq: dlq, limits: lim}
+}
+
+// в DLQ лежат заказы целиком — только админам площадки: пайплайны и DLQ общие для всех тенантов
+func (h *DLQHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersAdmin), auth.RequirePlatform, h.limits.Route("admin"))
+		r.Get("/admin/dlq", h.List)
+		r.With(auth.AuditWrites).Post("/admin/dlq/redrive", h.Redrive)
+	})
+}
+
+// List — ?partition=&offset=&limit=; у уже отправленных обратно сообщений есть redrive
+func (h *DLQHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var query kafka.DLQQuery
+	verr := &domain.ValidationError{}
+	if v := q.Get("partition"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 0 {
+			verr.Add("partition", "must be a non-negative integer")
+		}
+		query.Partition = &p
+	}
+	if v := q.Get("offset"); v != "" {
+		off, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || off < 0 {
+			verr.Add("offset", "must be a non-negative integer")
+		}
+		query.Offset = off
+	}
+	query.Limit, _ = strconv.Atoi(q.Get("limit"))
+	if err := verr.Err(); err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+
+	msgs, err := h.dlq.List(r.Context(), query)
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, msgs)
+}
+
+type redriveRequest struct {
+	All      bool                `json:"all"`
+	Messages []repository.DLQKey `json:"messages"`
+	Patch    json.RawMessage     `json:"patch"`
+	Force    bool                `json:"force"`
+}
+
+type redriveResponse struct {
+	Redriven int                   `json:"redriven"`
+	Skipped  int                   `json:"skipped"`
+	Failed   int                   `json:"failed"`
+	Results  []kafka.RedriveResult `json:"results"`
+	// Error — обход DLQ оборвался на середине, results — то, что успели
+	Error string `json:"error,omitempty"`
+}
+
+// Redrive — выбранные или все сообщения обратно в топики пайплайнов, patch — JSON Merge Patch заказа.
+// Повторно одно сообщение уходит только с force=true.
+func (h *DLQHandler) Redrive(w http.ResponseWriter, r *http.Request) {
+	var req redriveRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	actor := ""
+	if p := auth.FromContext(r.Context()); p != nil {
+		actor = p.ID
+	}
+	results, err := h.dlq.Redrive(r.Context(), kafka.RedriveRequest{
+		All:      req.All,
+		Messages: req.Messages,
+		Patch:    req.Patch,
+		Force:    req.Force,
+		Actor:    actor,
+	})
+	if err != nil && len(results) == 0 {
+		helpers.WriteError(w, r, err)
+		return
+	}
+
+	resp := redriveResponse{Results: results}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if resp.Results == nil {
+		resp.Results = []kafka.RedriveResult{}
+	}
+	for _, res := range results {
+		switch res.Status {
+		case kafka.RedriveDone:
+			resp.Redriven++
+		case kafka.RedriveSkipped:
+			resp.Skipped++
+		default:
+			resp.Failed++
+		}
+	}
+	helpers.WriteJSON(w, http.StatusOK, resp)
+}
@@ -1,14 +1,19 @@
 package presentation
 
 import (
-	"bufio"
-	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/audit"
 	"github.com/RaikyD/wb-orders-service/internal/domain"
 	"github.com/RaikyD/wb-orders-service/internal/kafka"
 	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/pii"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
 	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/idempotency"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/masking"
 	"github.com/RaikyD/wb-orders-service/internal/repository"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -23,44 +28,66 @@ import (
 )
 
 type OrdersHandler struct {
-	svc  *application.OrdersService
-	prod *kafka.Producer
+	svc    *application.OrdersService
+	prods  kafka.Producers
+	limits *limits.Limits
+	idem   *idempotency.Guard
+	mask   *masking.Rules
 }
 
-func NewOrdersHandler(svc application.OrdersService, prod *kafka.Producer) *OrdersHandler {
-	return &OrdersHandler{svc: &svc, prod: prod}
+// mask — что из контактов и оплаты показывать по ролям вызывающего; nil — всё как есть
+func NewOrdersHandler(svc *application.OrdersService, prods kafka.Producers, lim *limits.Limits, idem *idempotency.Guard, mask *masking.Rules) *OrdersHandler {
+	return &OrdersHandler{svc: svc, prods: prods, limits: lim, idem: idem, mask: mask}
 }
 
 func (h *OrdersHandler) Register(r chi.Router) {
-	r.Post("/orders", h.CreateOrder)
-	r.Get("/orders/{uid}", h.GetOrderByUID) // было {uuid}
-	r.Post("/orders/generate", h.GenerateOrders)
-	r.Get("/orders", h.ListOrdersBrief) // НОВОЕ
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersRead))
+		r.With(h.limits.Route("orders.get")).Get("/orders/{uid}", h.GetOrderByUID) // было {uuid}
+		r.With(h.limits.Route("orders.list")).Get("/orders", h.ListOrdersBrief)    // НОВОЕ
+		r.With(h.limits.Route("orders.get")).Get("/orders/{uid}/history", h.GetOrderHistory)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersWrite), auth.AuditWrites)
+		r.With(h.limits.Route("orders.create"), h.idem.Wrap("orders.create")).Post("/orders", h.CreateOrder)
+		r.With(h.limits.Route("orders.status")).Patch("/orders/{uid}/status", h.UpdateOrderStatus)
+	})
+	// генератор может залить тысячу заказов за раз — только для админов
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersAdmin), auth.AuditWrites)
+		r.With(h.limits.Route("orders.generate"), h.idem.Wrap("orders.generate")).Post("/orders/generate", h.GenerateOrders)
+		r.With(h.limits.Route("customers.erase")).Delete("/customers/{id}/personal-data", h.EraseCustomer)
+	})
 }
 
 // тут мы будем рассматривать 3 юзер кейса:
 // - application/json:   тело сразу объект domain.Order
 // - text/plain:         тело — строка JSON (парсим)
 // - multipart/form-data: ожидаем файл в поле "file" (parsing .json)
+// Версия формы — поле schema_version или заголовок Schema-Version; без них считаем 0.
+// Заказ уходит в топик пайплайна тенанта запроса.
 func (h *OrdersHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	prod, err := h.prods.For(auth.TenantFrom(r.Context()))
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
 	ct := r.Header.Get("Content-Type")
 	mediatype, params, _ := mime.ParseMediaType(ct)
 
-	var ord domain.Order
+	version, err := domain.ParseSchemaVersion(r.Header.Get("Schema-Version"))
+	if err != nil {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "Schema-Version", Message: err.Error()}}})
+		return
+	}
+
+	var raw []byte
 	var readErr error
 
 	switch mediatype {
-	case "application/json":
-		readErr = helpers.DecodeJSON(r.Body, &ord)
-
-	case "text/plain":
-		// тело — строка, внутри которой JSON
-		raw, err := io.ReadAll(r.Body)
-		if err != nil {
-			readErr = err
-			break
-		}
-		readErr = json.Unmarshal(raw, &ord)
+	case "application/json", "text/plain":
+		// text/plain — та же строка JSON; размер уже ограничен limits.MaxBody/Route
+		raw, readErr = io.ReadAll(r.Body)
 
 	case "multipart/form-data":
 		mr := multipart.NewReader(r.Body, params["boundary"])
@@ -77,30 +104,46 @@ func (h *OrdersHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			// Читаем файл как JSON
-			bufr := bufio.NewReader(io.LimitReader(part, 2<<20))
-			readErr = helpers.DecodeJSON(bufr, &ord)
+			raw, readErr = io.ReadAll(io.LimitReader(part, 2<<20))
 			_ = part.Close()
 			break
 		}
 	default:
-		helpers.HttpError(w, http.StatusUnsupportedMediaType, "unsupported content-type")
+		helpers.HttpError(w, r, http.StatusUnsupportedMediaType, helpers.CodeUnsupportedMediaType, "unsupported content-type")
 		return
 	}
 
+	if limits.IsTooLarge(readErr) {
+		helpers.HttpError(w, r, http.StatusRequestEntityTooLarge, helpers.CodeBodyTooLarge, "request body too large")
+		return
+	}
 	if readErr != nil {
-		helpers.HttpError(w, http.StatusBadRequest, "invalid JSON: "+readErr.Error())
+		helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeInvalidBody, "failed to read body: "+readErr.Error())
+		return
+	}
+
+	// любая поддерживаемая schema_version поднимается до текущей domain.Order
+	po, err := domain.DecodeOrder(raw, version, true)
+	if errors.Is(err, domain.ErrUnsupportedSchemaVersion) {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "schema_version", Message: err.Error()}}})
+		return
+	}
+	if err != nil {
+		helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeInvalidBody, "invalid JSON: "+err.Error())
 		return
 	}
-	if strings.TrimSpace(ord.OrderUID) == "" {
-		helpers.HttpError(w, http.StatusBadRequest, "order_uid is required")
+	ord := *po
+	if err := ord.Validate(); err != nil {
+		helpers.WriteError(w, r, err)
 		return
 	}
 
 	logger.Info("Uploading order on handler", "order", ord)
-	if err := h.prod.PublishOrder(r.Context(), ord); err != nil {
-		helpers.HttpError(w, http.StatusBadGateway, "kafka publish failed: "+err.Error())
+	if err := prod.PublishOrder(r.Context(), ord); err != nil {
+		helpers.WriteError(w, r, err)
 		return
 	}
+	h.svc.Audit().Record(r.Context(), audit.ActionSubmit, auth.TenantFrom(r.Context()), ord.OrderUID)
 
 	helpers.WriteJSON(w, http.StatusAccepted, map[string]any{
 		"status":    "accepted",
@@ -118,18 +161,29 @@ func (h *OrdersHandler) GenerateOrders(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	prod, err := h.prods.For(auth.TenantFrom(r.Context()))
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+
 	logger.Info("Starting generating orders")
 	var published []string
 	for i := 0; i < n; i++ {
 		o := genDemoOrder()
-		if err := h.prod.PublishOrder(r.Context(), o); err != nil {
+		if err := prod.PublishOrder(r.Context(), o); err != nil {
 			logger.Warn("generate: publish failed", "err", err)
 			continue
 		}
 		logger.Info("Order added to topic", "order", o)
+		h.svc.Audit().Record(r.Context(), audit.ActionSubmit, auth.TenantFrom(r.Context()), o.OrderUID)
 
 		published = append(published, o.OrderUID)
 	}
+	if len(published) == 0 {
+		helpers.WriteError(w, r, fmt.Errorf("%w: no orders were published", domain.ErrUpstreamUnavailable))
+		return
+	}
 
 	helpers.WriteJSON(w, http.StatusAccepted, map[string]any{
 		"status":        "accepted",
@@ -141,20 +195,127 @@ func (h *OrdersHandler) GenerateOrders(w http.ResponseWriter, r *http.Request) {
 func (h *OrdersHandler) GetOrderByUID(w http.ResponseWriter, r *http.Request) {
 	uid := chi.URLParam(r, "uid")
 	if strings.TrimSpace(uid) == "" {
-		helpers.HttpError(w, http.StatusBadRequest, "uid is empty")
+		helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeValidationFailed, "uid is empty")
 		return
 	}
 
-	ord, err := h.svc.GetbyUID(r.Context(), uid)
+	// ?as_of= — заказ на момент времени, из истории версий
+	var (
+		ord *domain.Order
+		err error
+	)
+	if v := r.URL.Query().Get("as_of"); v != "" {
+		at, perr := time.Parse(time.RFC3339, v)
+		if perr != nil {
+			helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "as_of", Message: "must be an RFC 3339 timestamp"}}})
+			return
+		}
+		ord, err = h.svc.GetAsOf(r.Context(), auth.TenantFrom(r.Context()), uid, at)
+	} else {
+		ord, err = h.svc.GetbyUID(r.Context(), auth.TenantFrom(r.Context()), uid)
+	}
+	if errors.Is(err, application.ErrHistoryNotSupported) {
+		helpers.HttpError(w, r, http.StatusNotImplemented, helpers.CodeNotImplemented, "order history not supported")
+		return
+	}
 	if err != nil {
-		helpers.HttpError(w, http.StatusInternalServerError, "failed to get order")
+		helpers.WriteError(w, r, err)
 		return
 	}
 	if ord == nil {
-		helpers.HttpError(w, http.StatusNotFound, "order not found")
+		helpers.WriteError(w, r, fmt.Errorf("order %s: %w", uid, domain.ErrNotFound))
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, h.mask.Order(r.Context(), ord))
+}
+
+type orderVersion struct {
+	repository.OrderVersion
+	Diff []domain.FieldChange `json:"diff,omitempty"`
+}
+
+// GetOrderHistory — версии заказа от первой к последней, у каждой кроме первой — отличия от предыдущей.
+// Маскирование применяется до сравнения, иначе замаскированное всплыло бы в diff
+func (h *OrdersHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	uid := chi.URLParam(r, "uid")
+	versions, err := h.svc.History(r.Context(), auth.TenantFrom(r.Context()), uid)
+	if errors.Is(err, application.ErrHistoryNotSupported) {
+		helpers.HttpError(w, r, http.StatusNotImplemented, helpers.CodeNotImplemented, "order history not supported")
+		return
+	}
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	if len(versions) == 0 {
+		helpers.WriteError(w, r, fmt.Errorf("order %s: %w", uid, domain.ErrNotFound))
+		return
+	}
+
+	pol := h.mask.For(auth.FromContext(r.Context()))
+	out := make([]orderVersion, len(versions))
+	for i, v := range versions {
+		v.Order = pol.Apply(v.Order)
+		out[i] = orderVersion{OrderVersion: v}
+		if i > 0 {
+			out[i].Diff = domain.Diff(out[i-1].Order, v.Order)
+		}
+	}
+	helpers.WriteJSON(w, http.StatusOK, map[string]any{"order_uid": uid, "versions": out})
+}
+
+type statusRequest struct {
+	Status *int `json:"status"`
+}
+
+// UpdateOrderStatus проставляет статус всем позициям заказа; подписчики получают событие
+func (h *OrdersHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	uid := chi.URLParam(r, "uid")
+
+	var req statusRequest
+	if err := helpers.DecodeJSON(r.Body, &req); err != nil {
+		if limits.IsTooLarge(err) {
+			helpers.HttpError(w, r, http.StatusRequestEntityTooLarge, helpers.CodeBodyTooLarge, "request body too large")
+			return
+		}
+		helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeInvalidBody, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Status == nil {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "status", Message: "is required"}}})
+		return
+	}
+
+	ord, err := h.svc.UpdateStatus(r.Context(), auth.TenantFrom(r.Context()), uid, *req.Status)
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, h.mask.Order(r.Context(), ord))
+}
+
+// EraseCustomer — DELETE /customers/{id}/personal-data: обезличивает доставку во всех заказах
+// клиента тенанта запроса; ответ — запись журнала стираний
+func (h *OrdersHandler) EraseCustomer(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if id == "" {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "id", Message: "is required"}}})
+		return
+	}
+	actor := ""
+	if p := auth.FromContext(r.Context()); p != nil {
+		actor = p.ID
+	}
+	e, err := h.svc.EraseCustomer(r.Context(), auth.TenantFrom(r.Context()), id, actor, repository.ErasureSourceHTTP)
+	if errors.Is(err, application.ErrEraseNotSupported) {
+		helpers.HttpError(w, r, http.StatusNotImplemented, helpers.CodeNotImplemented, "erasure not supported")
+		return
+	}
+	if err != nil {
+		helpers.WriteError(w, r, err)
 		return
 	}
-	helpers.WriteJSON(w, http.StatusOK, ord)
+	helpers.WriteJSON(w, http.StatusOK, e)
 }
 
 func genDemoOrder() domain.Order {
@@ -226,18 +387,30 @@ func (h *OrdersHandler) ListOrdersBrief(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	type lister interface {
-		ListOrdersBrief(ctx context.Context, limit, offset int) ([]repository.OrderBrief, error)
+	// ?phone= или ?email= — поиск по контакту доставки; при шифровании идёт по слепому индексу
+	q := r.URL.Query()
+	var (
+		rows []repository.OrderBrief
+		err  error
+	)
+	switch phone, email := q.Get("phone"), q.Get("email"); {
+	case phone != "" && email != "":
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "email", Message: "use either phone or email"}}})
+		return
+	case phone != "":
+		rows, err = h.svc.ListByContact(r.Context(), auth.TenantFrom(r.Context()), pii.IndexPhone, phone, limit, offset)
+	case email != "":
+		rows, err = h.svc.ListByContact(r.Context(), auth.TenantFrom(r.Context()), pii.IndexEmail, email, limit, offset)
+	default:
+		rows, err = h.svc.ListBrief(r.Context(), auth.TenantFrom(r.Context()), limit, offset)
 	}
-	if repo, ok := h.svc.Repo().(lister); ok {
-		rows, err := repo.ListOrdersBrief(r.Context(), limit, offset)
-		if err != nil {
-			helpers.HttpError(w, http.StatusInternalServerError, "failed to list orders")
-			return
-		}
-		helpers.WriteJSON(w, http.StatusOK, map[string]any{"rows": rows})
+	if errors.Is(err, application.ErrListNotSupported) {
+		helpers.HttpError(w, r, http.StatusNotImplemented, helpers.CodeNotImplemented, "list not supported")
 		return
 	}
-
-	helpers.HttpError(w, http.StatusNotImplemented, "list not supported")
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, map[string]any{"rows": rows})
 }
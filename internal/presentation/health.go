@@ -0,0 +1,94 @@
+package presentation
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/kafka"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	statusReady       = "ready"
+	statusDegraded    = "degraded"
+	statusUnavailable = "unavailable"
+)
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type LagReporter interface {
+	Name() string
+	Lag() *kafka.LagReport
+}
+
+type HealthHandler struct {
+	db  Pinger
+	lag []LagReporter // консьюмеры пайплайнов
+}
+
+func NewHealthHandler(db Pinger, lag []LagReporter) *HealthHandler {
+	return &HealthHandler{db: db, lag: lag}
+}
+
+// без авторизации: их дёргают kubelet и Prometheus
+func (h *HealthHandler) Register(r chi.Router) {
+	r.Get("/readyz", h.Ready)
+	r.Method(http.MethodGet, "/metrics", promhttp.Handler())
+}
+
+type check struct {
+	Status string           `json:"status"`
+	Error  string           `json:"error,omitempty"`
+	Lag    *kafka.LagReport `json:"lag,omitempty"`
+}
+
+type readiness struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks"`
+}
+
+// Ready — 503 только без базы. Отставание консьюмера — degraded с кодом 200:
+// HTTP-чтение при этом работает, и снимать инстанс с балансировки незачем.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	res := readiness{Status: statusReady, Checks: map[string]check{}}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := h.db.Ping(ctx); err != nil {
+		res.Status = statusUnavailable
+		res.Checks["db"] = check{Status: statusUnavailable, Error: err.Error()}
+	} else {
+		res.Checks["db"] = check{Status: "ok"}
+	}
+
+	// по проверке на пайплайн: kafka_lag.<name>
+	for _, c := range h.lag {
+		lag := check{Status: "ok"}
+		switch rep := c.Lag(); {
+		case rep == nil:
+			lag.Status = "unknown"
+		case rep.Degraded:
+			lag.Status, lag.Lag = statusDegraded, rep
+			if res.Status == statusReady {
+				res.Status = statusDegraded
+			}
+		default:
+			lag.Lag = rep
+			if rep.Error != "" {
+				lag.Status = "unknown"
+			}
+		}
+		res.Checks["kafka_lag."+c.Name()] = lag
+	}
+
+	code := http.StatusOK
+	if res.Status == statusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	helpers.WriteJSON(w, code, res)
+}
@@ -0,0 +1,95 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Стабильные машиночитаемые коды ошибок. Клиенты завязываются на code, а не на текст detail,
+// поэтому существующие коды не переименовываем.
+const (
+	CodeValidationFailed     = "validation_failed"
+	CodeInvalidBody          = "invalid_body"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeNotFound             = "not_found"
+	CodeOrderAlreadyExists   = "order_already_exists"
+	CodeUpstreamUnavailable  = "upstream_unavailable"
+	CodeInternal             = "internal_error"
+	CodeNotImplemented       = "not_implemented"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeRateLimited          = "rate_limited"
+	CodeIdempotencyMismatch  = "idempotency_key_reused"
+	CodeIdempotencyInFlight  = "idempotency_in_progress"
+	CodeConsumerNotPaused    = "consumer_not_paused"
+	CodeConfirmationMismatch = "confirmation_token_mismatch"
+	CodeConsumerGroupActive  = "consumer_group_active"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem — тело ответа по RFC 7807 плюс наши расширения code/request_id/errors
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []domain.FieldError `json:"errors,omitempty"`
+}
+
+func NewProblem(r *http.Request, status int, code, detail string) *Problem {
+	p := &Problem{
+		Type:   "urn:wb-orders:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = middleware.GetReqID(r.Context())
+	}
+	return p
+}
+
+func WriteProblem(w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// HttpError — ошибка уровня HTTP (не тот content-type, нет прав и т.п.)
+func HttpError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, NewProblem(r, status, code, detail))
+}
+
+// WriteError переводит доменные/репозиторные ошибки в problem+json.
+// Всё, что не распознали, отдаём как 500 без подробностей — детали только в лог.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *domain.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		p := NewProblem(r, http.StatusBadRequest, CodeValidationFailed, "request validation failed")
+		p.Errors = verr.Fields
+		WriteProblem(w, p)
+	case errors.Is(err, domain.ErrOrderAlreadyExists):
+		HttpError(w, r, http.StatusConflict, CodeOrderAlreadyExists, "order already exists")
+	case errors.Is(err, domain.ErrNotFound):
+		HttpError(w, r, http.StatusNotFound, CodeNotFound, "resource not found")
+	case errors.Is(err, domain.ErrUpstreamUnavailable):
+		logger.Warn("upstream unavailable", "err", err, "request_id", middleware.GetReqID(r.Context()))
+		HttpError(w, r, http.StatusServiceUnavailable, CodeUpstreamUnavailable, "dependent service is unavailable, retry later")
+	default:
+		logger.Warn("internal error", "err", err, "request_id", middleware.GetReqID(r.Context()))
+		HttpError(w, r, http.StatusInternalServerError, CodeInternal, "internal error")
+	}
+}
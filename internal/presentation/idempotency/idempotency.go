@@ -0,0 +1,209 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+	maxKeyLen      = 255
+)
+
+type Store interface {
+	Reserve(ctx context.Context, scope, key, hash string, ttl, lease time.Duration) (*repository.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, scope, key string, lockedUntil time.Time, status int, contentType string, body []byte) error
+	Release(ctx context.Context, scope, key string, lockedUntil time.Time) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// сколько даём на сохранение ответа или освобождение ключа после обработчика
+const finishTimeout = 5 * time.Second
+
+type Guard struct {
+	store Store
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// NewGuard: ttl — сколько хранится готовый ответ, requestTimeout — сколько максимум идёт запрос.
+// На это время (плюс запас на сохранение ответа) ключ занят; если процесс умер, не освободив его,
+// после аренды ключ можно занять снова, не дожидаясь ttl
+func NewGuard(store Store, ttl, requestTimeout time.Duration) *Guard {
+	return &Guard{store: store, ttl: ttl, lease: requestTimeout + finishTimeout}
+}
+
+// Wrap — middleware для пишущих роутов. Без заголовка Idempotency-Key запрос проходит как обычно.
+// С заголовком: первый ответ сохраняем, повтор с тем же телом получает сохранённый ответ,
+// повтор с другим телом — 422.
+func (g *Guard) Wrap(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if g == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLen {
+				helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeValidationFailed, "Idempotency-Key is too long")
+				return
+			}
+
+			// тело читаем целиком (оно уже ограничено limits), считаем хэш и подкладываем обратно
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				if limits.IsTooLarge(err) {
+					helpers.HttpError(w, r, http.StatusRequestEntityTooLarge, helpers.CodeBodyTooLarge, "request body too large")
+					return
+				}
+				helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeInvalidBody, "failed to read body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// ключ живёт в пределах тенанта: тот же ключ в другом тенанте — другой запрос
+			scope := route + "|" + auth.TenantFrom(r.Context()) + "|" + actor(r)
+			hash := requestHash(r, body)
+
+			rec, fresh, err := g.store.Reserve(r.Context(), scope, key, hash, g.ttl, g.lease)
+			if err != nil {
+				if errors.Is(err, repository.ErrIdempotencyRace) {
+					helpers.HttpError(w, r, http.StatusConflict, helpers.CodeIdempotencyInFlight, "request with this Idempotency-Key is in progress, retry later")
+					return
+				}
+				helpers.WriteError(w, r, fmt.Errorf("%w: idempotency reserve: %w", domain.ErrUpstreamUnavailable, err))
+				return
+			}
+
+			if !fresh {
+				switch {
+				case rec.RequestHash != hash:
+					helpers.HttpError(w, r, http.StatusUnprocessableEntity, helpers.CodeIdempotencyMismatch, "Idempotency-Key was already used with a different request")
+				case !rec.Completed:
+					w.Header().Set("Retry-After", "1")
+					helpers.HttpError(w, r, http.StatusConflict, helpers.CodeIdempotencyInFlight, "request with this Idempotency-Key is in progress, retry later")
+				default:
+					replay(w, rec)
+				}
+				return
+			}
+
+			// ключ освобождаем при любом исходе, кроме сохранённого ответа: 5xx, неудачный Complete
+			// и паника обработчика (defer срабатывает и при ней, паника идёт дальше к Recoverer).
+			// Иначе повторы получали бы 409 до конца аренды
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), finishTimeout)
+				defer cancel()
+				if err := g.store.Release(ctx, scope, key, rec.LockedUntil); err != nil {
+					logger.Warn("idempotency release failed", "err", err, "key", key)
+				}
+			}()
+
+			rw := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			// 5xx не запоминаем: клиент должен иметь возможность честно повторить
+			if rw.status >= 500 {
+				return
+			}
+			// контекст запроса к этому моменту может быть уже отменён
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), finishTimeout)
+			defer cancel()
+			if err := g.store.Complete(ctx, scope, key, rec.LockedUntil, rw.status, rw.Header().Get("Content-Type"), rw.body.Bytes()); err != nil {
+				logger.Warn("idempotency complete failed", "err", err, "key", key)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// RunCleanup периодически чистит протухшие ключи, пока жив ctx
+func (g *Guard) RunCleanup(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := g.store.DeleteExpired(ctx)
+			if err != nil {
+				logger.Warn("idempotency cleanup failed", "err", err)
+				continue
+			}
+			if n > 0 {
+				logger.Info("idempotency keys expired", "count", n)
+			}
+		}
+	}
+}
+
+func replay(w http.ResponseWriter, rec *repository.IdempotencyRecord) {
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(rec.StatusCode)
+	_, _ = w.Write(rec.ResponseBody)
+}
+
+func actor(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.Method + ":" + p.ID
+	}
+	return "anonymous"
+}
+
+// в хэш входит всё, что определяет смысл запроса: метод, путь, query, content-type и тело
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n"+r.URL.Path+"\n"+r.URL.RawQuery+"\n"+r.Header.Get("Content-Type")+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recorder) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recorder) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,189 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Config struct {
+	RateLimitEnabled bool
+	DefaultRate      Rate
+	RouteRates       map[string]Rate // имя роута -> свой лимит
+	MaxBodyBytes     int64
+	RouteMaxBody     map[string]int64
+}
+
+type Limits struct {
+	cfg Config
+
+	// бакеты по имени роута: Route("admin") на нескольких роутах делит один бюджет на клиента
+	mu   sync.Mutex
+	sets map[string]*bucketSet
+}
+
+func New(cfg Config) *Limits {
+	return &Limits{cfg: cfg, sets: make(map[string]*bucketSet)}
+}
+
+// MaxBody — глобальный лимит на тело, вешается на весь роутер.
+// Content-Length больше лимита режем сразу, остальное ограничивает MaxBytesReader.
+func (l *Limits) MaxBody(next http.Handler) http.Handler {
+	return bodyLimit(l.cfg.MaxBodyBytes, next)
+}
+
+// Route навешивает на конкретный роут его лимиты: размер тела и rate limit.
+// Имя роута — ключ в RATE_LIMIT_ROUTES / HTTP_ROUTE_MAX_BODY; роуты с одним именем делят бакеты.
+func (l *Limits) Route(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		h := next
+		if n, ok := l.cfg.RouteMaxBody[name]; ok {
+			h = bodyLimit(n, h)
+		}
+		if !l.cfg.RateLimitEnabled {
+			return h
+		}
+
+		return rateLimit(l.buckets(name), h)
+	}
+}
+
+func (l *Limits) buckets(name string) *bucketSet {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if set, ok := l.sets[name]; ok {
+		return set
+	}
+	rate, ok := l.cfg.RouteRates[name]
+	if !ok {
+		rate = l.cfg.DefaultRate
+	}
+	set := newBucketSet(rate)
+	l.sets[name] = set
+	return set
+}
+
+func rateLimit(set *bucketSet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		d := set.take(key, time.Now())
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(set.rate.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+
+		if !d.allowed {
+			logger.Warn("rate limited", "key", key, "path", r.URL.Path, "request_id", middleware.GetReqID(r.Context()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(d.retryAfter))))
+			helpers.HttpError(w, r, http.StatusTooManyRequests, helpers.CodeRateLimited, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bodyLimit(n int64, next http.Handler) http.Handler {
+	if n <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			helpers.HttpError(w, r, http.StatusRequestEntityTooLarge, helpers.CodeBodyTooLarge, "request body too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsTooLarge — тело обрезано MaxBytesReader'ом, отвечать надо 413, а не 400
+func IsTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe)
+}
+
+// clientKey: аутентифицированных считаем по ключу/субъекту, остальных — по IP.
+// RemoteAddr уже переписан middleware.RealIP.
+func clientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil && p.Method != "anonymous" {
+		return p.Method + ":" + p.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ParseRate разбирает "rps:burst", например "0.5:2"
+func ParseRate(s string) (Rate, error) {
+	rps, burst, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q: want rps:burst", s)
+	}
+	r, err := strconv.ParseFloat(rps, 64)
+	if err != nil || r < 0 {
+		return Rate{}, fmt.Errorf("rate %q: bad rps", s)
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 {
+		return Rate{}, fmt.Errorf("rate %q: bad burst", s)
+	}
+	return Rate{RPS: r, Burst: b}, nil
+}
+
+// ParseRouteRates разбирает "orders.generate=0.2:2,orders.create=10:20"
+func ParseRouteRates(s string) (map[string]Rate, error) {
+	out := make(map[string]Rate)
+	for name, v := range splitPairs(s) {
+		r, err := ParseRate(v)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+		out[name] = r
+	}
+	return out, nil
+}
+
+// ParseRouteSizes разбирает "orders.create=2097152"; 0 — без отдельного лимита
+func ParseRouteSizes(s string) (map[string]int64, error) {
+	out := make(map[string]int64)
+	for name, v := range splitPairs(s) {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("route %s: bad body size %q", name, v)
+		}
+		out[name] = n
+	}
+	return out, nil
+}
+
+func splitPairs(s string) map[string]string {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		out[strings.TrimSpace(name)] = strings.TrimSpace(v)
+	}
+	return out
+}
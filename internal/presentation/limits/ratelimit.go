@@ -0,0 +1,87 @@
+package limits
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate — параметры token bucket: RPS токенов в секунду, не больше Burst в запасе
+type Rate struct {
+	RPS   float64
+	Burst int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketSet — бакеты одного роута, ключ — api key / субъект JWT / IP клиента
+type bucketSet struct {
+	rate Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newBucketSet(rate Rate) *bucketSet {
+	return &bucketSet{rate: rate, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+type decision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // через сколько бакет снова будет полным
+	retryAfter time.Duration // через сколько появится хотя бы один токен
+}
+
+func (s *bucketSet) take(key string, now time.Time) decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	burst := float64(s.rate.Burst)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*s.rate.RPS)
+	b.last = now
+
+	d := decision{}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.allowed = true
+	} else {
+		d.retryAfter = s.wait(1 - b.tokens)
+	}
+	d.remaining = int(b.tokens)
+	d.reset = s.wait(burst - b.tokens)
+	return d
+}
+
+func (s *bucketSet) wait(tokens float64) time.Duration {
+	if s.rate.RPS <= 0 {
+		return time.Hour
+	}
+	return time.Duration(tokens / s.rate.RPS * float64(time.Second))
+}
+
+// раз в минуту выкидываем давно полные бакеты, чтобы map не росла бесконечно
+func (s *bucketSet) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, b := range s.buckets {
+		full := b.tokens+now.Sub(b.last).Seconds()*s.rate.RPS >= float64(s.rate.Burst)
+		if full && now.Sub(b.last) > 5*time.Minute {
+			delete(s.buckets, k)
+		}
+	}
+}
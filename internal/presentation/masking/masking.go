@@ -0,0 +1,211 @@
+package masking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+)
+
+// Strategy — как прячется значение поля
+type Strategy string
+
+const (
+	Redact Strategy = "redact" // "***"
+	Last4  Strategy = "last4"  // видны последние 4 символа: "**********2-33"
+	Email  Strategy = "email"  // первая буква и домен: "i***@example.com"
+	First  Strategy = "first"  // первая буква: "I***"
+)
+
+// Поля, которые можно маскировать
+const (
+	DeliveryName       = "delivery.name"
+	DeliveryPhone      = "delivery.phone"
+	DeliveryZip        = "delivery.zip"
+	DeliveryCity       = "delivery.city"
+	DeliveryAddress    = "delivery.address"
+	DeliveryRegion     = "delivery.region"
+	DeliveryEmail      = "delivery.email"
+	PaymentTransaction = "payment.transaction"
+)
+
+// Policy — какие поля и как маскировать; пустая — заказ отдаётся как есть
+type Policy map[string]Strategy
+
+// Rules — правила из PII_MASKING_FILE (пример — deploy/masking.example.json):
+//
+//	{"default": {"delivery.phone": "last4", ...}, "roles": {"orders:pii": {}, "support": {"delivery.phone": "last4"}}}
+//
+// Роль — scope учётных данных. Вызывающему достаётся политика самой мягкой из его ролей
+// (меньше всего маскируемых полей); нет ни одной — default. orders:admin покрывает все роли.
+// У подписчика вебхуков scope'ов нет, его тела маскируются по секции webhooks, а без неё — по default;
+// "webhooks": {} отдаёт подписчикам заказ целиком.
+type Rules struct {
+	Default  Policy            `json:"default"`
+	Roles    map[string]Policy `json:"roles"`
+	Webhooks Policy            `json:"webhooks"`
+}
+
+// DefaultRules — без файла: полные контакты и номер транзакции видит только orders:pii
+func DefaultRules() *Rules {
+	return &Rules{
+		Default: Policy{
+			DeliveryName:       First,
+			DeliveryPhone:      Last4,
+			DeliveryZip:        Redact,
+			DeliveryAddress:    Redact,
+			DeliveryEmail:      Email,
+			PaymentTransaction: Last4,
+		},
+		Roles: map[string]Policy{auth.ScopeOrdersPII: {}},
+	}
+}
+
+// Load читает правила из файла; пустой путь — DefaultRules
+func Load(path string) (*Rules, error) {
+	if path == "" {
+		return DefaultRules(), nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read masking rules: %w", err)
+	}
+	var r Rules
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("parse masking rules: %w", err)
+	}
+	if err := r.Default.validate("default"); err != nil {
+		return nil, err
+	}
+	for role, p := range r.Roles {
+		if err := p.validate("roles." + role); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.Webhooks.validate("webhooks"); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+var fields = []string{
+	DeliveryName, DeliveryPhone, DeliveryZip, DeliveryCity,
+	DeliveryAddress, DeliveryRegion, DeliveryEmail, PaymentTransaction,
+}
+
+func (p Policy) validate(where string) error {
+	for f, s := range p {
+		if !slices.Contains(fields, f) {
+			return fmt.Errorf("masking rules %s: unknown field %q", where, f)
+		}
+		switch s {
+		case Redact, Last4, Email, First:
+		default:
+			return fmt.Errorf("masking rules %s: field %q: unknown strategy %q", where, f, s)
+		}
+	}
+	return nil
+}
+
+// For — политика для учётных данных; nil-правила ничего не маскируют
+func (r *Rules) For(p *auth.Principal) Policy {
+	if r == nil {
+		return nil
+	}
+	best, found := r.Default, false
+	// роли по порядку имён, чтобы при равенстве выбор не зависел от обхода map
+	for _, role := range sortedKeys(r.Roles) {
+		pol := r.Roles[role]
+		if p.Has(role) && (!found || len(pol) < len(best)) {
+			best, found = pol, true
+		}
+	}
+	return best
+}
+
+// Webhook — политика для тел вебхуков
+func (r *Rules) Webhook() Policy {
+	if r == nil {
+		return nil
+	}
+	if r.Webhooks != nil {
+		return r.Webhooks
+	}
+	return r.Default
+}
+
+// Order — заказ в том виде, в каком его можно показать вызывающему из ctx
+func (r *Rules) Order(ctx context.Context, o *domain.Order) *domain.Order {
+	return r.For(auth.FromContext(ctx)).Apply(o)
+}
+
+// Apply возвращает копию заказа с замаскированными полями; исходный (он же лежит в кэше) не трогается
+func (p Policy) Apply(o *domain.Order) *domain.Order {
+	if o == nil || len(p) == 0 {
+		return o
+	}
+	c := *o
+	for f, s := range p {
+		switch f {
+		case DeliveryName:
+			c.Delivery.Name = s.mask(c.Delivery.Name)
+		case DeliveryPhone:
+			c.Delivery.Phone = s.mask(c.Delivery.Phone)
+		case DeliveryZip:
+			c.Delivery.Zip = s.mask(c.Delivery.Zip)
+		case DeliveryCity:
+			c.Delivery.City = s.mask(c.Delivery.City)
+		case DeliveryAddress:
+			c.Delivery.Address = s.mask(c.Delivery.Address)
+		case DeliveryRegion:
+			c.Delivery.Region = s.mask(c.Delivery.Region)
+		case DeliveryEmail:
+			c.Delivery.Email = s.mask(c.Delivery.Email)
+		case PaymentTransaction:
+			c.Payment.Transaction = s.mask(c.Payment.Transaction)
+		}
+	}
+	return &c
+}
+
+func (s Strategy) mask(v string) string {
+	// пустое и стёртое показывать можно: прятать там нечего
+	if v == "" || v == domain.ErasedMarker {
+		return v
+	}
+	switch s {
+	case Last4:
+		n := utf8.RuneCountInString(v)
+		if n <= 4 {
+			return strings.Repeat("*", n)
+		}
+		r := []rune(v)
+		return strings.Repeat("*", n-4) + string(r[n-4:])
+	case Email:
+		local, domainPart, ok := strings.Cut(v, "@")
+		if !ok || local == "" {
+			return "***"
+		}
+		r, _ := utf8.DecodeRuneInString(local)
+		return string(r) + "***@" + domainPart
+	case First:
+		r, _ := utf8.DecodeRuneInString(v)
+		return string(r) + "***"
+	}
+	return "***"
+}
+
+func sortedKeys(m map[string]Policy) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package masking
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+)
+
+func principal(scopes ...string) *auth.Principal {
+	p := &auth.Principal{ID: "test", Method: "api_key", Scopes: map[string]struct{}{}}
+	for _, s := range scopes {
+		p.Scopes[s] = struct{}{}
+	}
+	return p
+}
+
+func TestRulesFor(t *testing.T) {
+	support := Policy{DeliveryPhone: Last4}
+	rules := &Rules{
+		Default: Policy{DeliveryPhone: Last4, DeliveryEmail: Email, PaymentTransaction: Last4},
+		Roles: map[string]Policy{
+			auth.ScopeOrdersPII: {},
+			"support":           support,
+			"ops":               {DeliveryPhone: Redact, DeliveryEmail: Redact},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		rules *Rules
+		p     *auth.Principal
+		want  Policy
+	}{
+		{"nil rules", nil, principal(auth.ScopeOrdersPII), nil},
+		{"anonymous", rules, nil, rules.Default},
+		{"no matching role", rules, principal(auth.ScopeOrdersRead), rules.Default},
+		{"single role", rules, principal("support"), support},
+		{"softest of several", rules, principal("ops", "support"), support},
+		{"pii wins", rules, principal("ops", auth.ScopeOrdersPII, "support"), Policy{}},
+		{"admin covers every role", rules, principal(auth.ScopeOrdersAdmin), Policy{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.For(tt.p); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("For() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesWebhook(t *testing.T) {
+	def := Policy{DeliveryPhone: Last4}
+	hooks := Policy{DeliveryPhone: Redact}
+
+	tests := []struct {
+		name  string
+		rules *Rules
+		want  Policy
+	}{
+		{"nil rules", nil, nil},
+		{"no webhooks section", &Rules{Default: def}, def},
+		{"own section", &Rules{Default: def, Webhooks: hooks}, hooks},
+		{"explicitly unmasked", &Rules{Default: def, Webhooks: Policy{}}, Policy{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.Webhook(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Webhook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	order := func() *domain.Order {
+		return &domain.Order{
+			OrderUID: "b563feb7b2b84b6test",
+			Delivery: domain.DeliveryData{
+				Name:    "Test Testov",
+				Phone:   "+9720000000",
+				Zip:     "2639809",
+				City:    "Kiryat Mozkin",
+				Address: "Ploshad Mira 15",
+				Email:   "test@gmail.com",
+			},
+			Payment: domain.PaymentData{Transaction: "b563feb7b2b84b6test"},
+		}
+	}
+
+	t.Run("masks a copy", func(t *testing.T) {
+		in := order()
+		got := DefaultRules().Default.Apply(in)
+		if !reflect.DeepEqual(in, order()) {
+			t.Fatalf("input mutated: %+v", in)
+		}
+		want := order()
+		want.Delivery.Name = "T***"
+		want.Delivery.Phone = "*******0000"
+		want.Delivery.Zip = "***"
+		want.Delivery.Address = "***"
+		want.Delivery.Email = "t***@gmail.com"
+		want.Payment.Transaction = "***************test"
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Apply() = %+v\nwant %+v", got, want)
+		}
+	})
+
+	t.Run("empty policy", func(t *testing.T) {
+		in := order()
+		if got := (Policy{}).Apply(in); got != in {
+			t.Fatal("empty policy should return the order as is")
+		}
+	})
+
+	t.Run("nil order", func(t *testing.T) {
+		if got := DefaultRules().Default.Apply(nil); got != nil {
+			t.Fatalf("Apply(nil) = %+v", got)
+		}
+	})
+
+	t.Run("no delivery and payment", func(t *testing.T) {
+		in := &domain.Order{OrderUID: "x"}
+		got := DefaultRules().Default.Apply(in)
+		if got.Delivery != (domain.DeliveryData{}) || got.Payment != (domain.PaymentData{}) {
+			t.Fatalf("empty fields should stay empty: %+v", got)
+		}
+	})
+}
+
+func TestStrategyMask(t *testing.T) {
+	tests := []struct {
+		s    Strategy
+		in   string
+		want string
+	}{
+		{Redact, "Ploshad Mira 15", "***"},
+		{Redact, "", ""},
+		{Redact, domain.ErasedMarker, domain.ErasedMarker},
+
+		{Last4, "+9720000000", "*******0000"},
+		{Last4, "12345", "*2345"},
+		{Last4, "1234", "****"},
+		{Last4, "12", "**"},
+		{Last4, "", ""},
+		{Last4, "тест-тест", "*****тест"},
+
+		{Email, "test@gmail.com", "t***@gmail.com"},
+		{Email, "t@x.io", "t***@x.io"},
+		{Email, "@gmail.com", "***"},
+		{Email, "not-an-email", "***"},
+		{Email, "", ""},
+		{Email, "юля@почта.рф", "ю***@почта.рф"},
+
+		{First, "Test Testov", "T***"},
+		{First, "T", "T***"},
+		{First, "", ""},
+		{First, "Юлия", "Ю***"},
+		{First, domain.ErasedMarker, domain.ErasedMarker},
+	}
+	for _, tt := range tests {
+		if got := tt.s.mask(tt.in); got != tt.want {
+			t.Errorf("%s.mask(%q) = %q, want %q", tt.s, tt.in, got, tt.want)
+		}
+	}
+}
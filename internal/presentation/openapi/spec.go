@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed openapi.json
+var rawSpec []byte
+
+type Spec struct {
+	doc   map[string]any
+	paths []pathTemplate
+}
+
+// Load разбирает встроенный openapi.json; ошибка тут — баг в самом файле
+func Load() (*Spec, error) {
+	dec := json.NewDecoder(bytes.NewReader(rawSpec))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("openapi.json: %w", err)
+	}
+
+	s := &Spec{doc: doc}
+	paths, _ := doc["paths"].(map[string]any)
+	for p, item := range paths {
+		ops, _ := item.(map[string]any)
+		s.paths = append(s.paths, newPathTemplate(p, ops))
+	}
+	// литеральные сегменты важнее параметров: /orders/generate раньше /orders/{uid}
+	sort.Slice(s.paths, func(i, j int) bool {
+		return s.paths[i].literals > s.paths[j].literals
+	})
+	return s, nil
+}
+
+// Mount отдаёт спецификацию как есть; UI (Redoc) лежит в web/docs.html
+func (s *Spec) Mount(r chi.Router) {
+	r.Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write(rawSpec)
+	})
+}
+
+// CheckRoutes сверяет роутер со спецификацией: любой роут без описания — ошибка.
+// Статику (mount на "/*") и корневую страницу не считаем.
+func (s *Spec) CheckRoutes(routes chi.Routes) error {
+	var missing []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if route == "/" || strings.HasSuffix(route, "/*") {
+			return nil
+		}
+		route = strings.TrimSuffix(route, "/")
+		if _, ok := s.operation(method, route); !ok {
+			missing = append(missing, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes missing from openapi.json: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// operation ищет операцию по шаблону пути ровно так, как он записан в роутере
+func (s *Spec) operation(method, template string) (map[string]any, bool) {
+	for _, p := range s.paths {
+		if p.raw == template {
+			op, ok := p.ops[strings.ToLower(method)].(map[string]any)
+			return op, ok
+		}
+	}
+	return nil, false
+}
+
+// resolve разворачивает локальные $ref вида "#/components/schemas/Order"
+func (s *Spec) resolve(node map[string]any) map[string]any {
+	for i := 0; i < 16; i++ {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var cur any = s.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, _ := cur.(map[string]any)
+			cur = m[part]
+		}
+		next, ok := cur.(map[string]any)
+		if !ok {
+			return node
+		}
+		node = next
+	}
+	return node
+}
+
+type pathTemplate struct {
+	raw      string
+	segments []string
+	literals int
+	ops      map[string]any
+}
+
+func newPathTemplate(raw string, ops map[string]any) pathTemplate {
+	t := pathTemplate{raw: raw, segments: strings.Split(strings.Trim(raw, "/"), "/"), ops: ops}
+	for _, seg := range t.segments {
+		if !isParam(seg) {
+			t.literals++
+		}
+	}
+	return t
+}
+
+// match сопоставляет реальный путь запроса с шаблоном и возвращает path-параметры
+func (t pathTemplate) match(path string) (map[string]string, bool) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segs) != len(t.segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, seg := range t.segments {
+		if isParam(seg) {
+			if segs[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = segs[i]
+			continue
+		}
+		if seg != segs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func isParam(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
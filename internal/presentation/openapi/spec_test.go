@@ -0,0 +1,57 @@
+package openapi_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/openapi"
+	"github.com/go-chi/chi/v5"
+)
+
+// router собирает роуты так же, как cmd/main.go; зависимости не нужны — запросы не выполняются
+func router(t *testing.T) (chi.Router, *openapi.Spec) {
+	t.Helper()
+	logger.Init()
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+
+	r := chi.NewRouter()
+	h := presentation.NewOrdersHandler(nil, nil, nil, nil, nil)
+	r.Group(func(r chi.Router) {
+		h.Register(r)
+		presentation.NewWebhooksHandler(nil, nil).Register(r)
+		presentation.NewConsumerHandler(nil, nil).Register(r)
+		presentation.NewDLQHandler(nil, nil).Register(r)
+		presentation.NewAuditHandler(nil, nil).Register(r)
+		presentation.NewHealthHandler(nil, nil).Register(r)
+		spec.Mount(r)
+	})
+	h.RegisterStreams(r)
+	presentation.NewSocketHandler(nil, nil, 0, nil, nil).Register(r)
+	return r, spec
+}
+
+func TestCheckRoutes(t *testing.T) {
+	r, spec := router(t)
+	if err := spec.CheckRoutes(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRoutesMissing(t *testing.T) {
+	r, spec := router(t)
+	r.Get("/orders/{uid}/undocumented", func(http.ResponseWriter, *http.Request) {})
+
+	err := spec.CheckRoutes(r)
+	if err == nil {
+		t.Fatal("undocumented route passed the check")
+	}
+	if !strings.Contains(err.Error(), "GET /orders/{uid}/undocumented") {
+		t.Fatalf("error does not name the route: %v", err)
+	}
+}
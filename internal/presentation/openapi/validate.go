@@ -0,0 +1,314 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/google/uuid"
+)
+
+// Validate — необязательный middleware (OPENAPI_VALIDATE), проверяет запрос по спецификации:
+// параметры, content-type и JSON-тело. Пути, которых нет в спецификации (статика), пропускает.
+// Поддерживается ровно то подмножество JSON Schema, которое используется в openapi.json.
+func (s *Spec) Validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, pathParams, ok := s.find(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// анониму на закрытой операции первым отвечает RequireScope (401):
+		// 400 с разбором полей раньше проверки доступа ему не положен
+		if auth.FromContext(r.Context()) == nil && s.secured(op) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		verr := &domain.ValidationError{}
+		s.checkParams(r, op, pathParams, verr)
+
+		if rb, ok := op["requestBody"].(map[string]any); ok {
+			status, code, msg := s.checkBody(r, s.resolve(rb), verr)
+			if status != 0 {
+				helpers.HttpError(w, r, status, code, msg)
+				return
+			}
+		}
+
+		if err := verr.Err(); err != nil {
+			helpers.WriteError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// secured — требует ли операция учётных данных: своё security, иначе глобальное
+func (s *Spec) secured(op map[string]any) bool {
+	if sec, ok := op["security"].([]any); ok {
+		return len(sec) > 0
+	}
+	global, _ := s.doc["security"].([]any)
+	return len(global) > 0
+}
+
+func (s *Spec) find(method, path string) (map[string]any, map[string]string, bool) {
+	for _, p := range s.paths {
+		params, ok := p.match(path)
+		if !ok {
+			continue
+		}
+		op, ok := p.ops[strings.ToLower(method)].(map[string]any)
+		if !ok {
+			// путь наш, а метода нет — пусть роутер сам ответит 405
+			return nil, nil, false
+		}
+		return op, params, true
+	}
+	return nil, nil, false
+}
+
+func (s *Spec) checkParams(r *http.Request, op map[string]any, pathParams map[string]string, verr *domain.ValidationError) {
+	params, _ := op["parameters"].([]any)
+	for _, raw := range params {
+		pm, _ := raw.(map[string]any)
+		pm = s.resolve(pm)
+		name, _ := pm["name"].(string)
+		in, _ := pm["in"].(string)
+		required, _ := pm["required"].(bool)
+
+		var (
+			val     string
+			present bool
+		)
+		switch in {
+		case "query":
+			present = r.URL.Query().Has(name)
+			val = r.URL.Query().Get(name)
+		case "header":
+			val = r.Header.Get(name)
+			present = val != ""
+		case "path":
+			val, present = pathParams[name]
+		default:
+			continue
+		}
+
+		if !present {
+			if required {
+				verr.Add(name, "is required")
+			}
+			continue
+		}
+		schema, _ := pm["schema"].(map[string]any)
+		s.validate(s.resolve(schema), coerce(val, s.resolve(schema)), name, verr)
+	}
+}
+
+// checkBody возвращает статус != 0, если запрос надо отбить до валидации полей (415/413/400)
+func (s *Spec) checkBody(r *http.Request, rb map[string]any, verr *domain.ValidationError) (int, string, string) {
+	content, _ := rb["content"].(map[string]any)
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media, ok := content[mediatype].(map[string]any)
+	if !ok {
+		return http.StatusUnsupportedMediaType, helpers.CodeUnsupportedMediaType, "unsupported content-type"
+	}
+
+	// multipart и прочее не разбираем — это сделает хендлер
+	if mediatype != "application/json" {
+		return 0, "", ""
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if limits.IsTooLarge(err) {
+			return http.StatusRequestEntityTooLarge, helpers.CodeBodyTooLarge, "request body too large"
+		}
+		return http.StatusBadRequest, helpers.CodeInvalidBody, "failed to read body"
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if required, _ := rb["required"].(bool); required && len(bytes.TrimSpace(body)) == 0 {
+		verr.Add("body", "is required")
+		return 0, "", ""
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return http.StatusBadRequest, helpers.CodeInvalidBody, "invalid JSON: " + err.Error()
+	}
+	schema, _ := media["schema"].(map[string]any)
+	s.validate(s.resolve(schema), v, "", verr)
+	return 0, "", ""
+}
+
+func (s *Spec) validate(schema map[string]any, v any, path string, verr *domain.ValidationError) {
+	if schema == nil {
+		return
+	}
+	field := path
+	if field == "" {
+		field = "body"
+	}
+
+	if !typeMatches(schema["type"], v) {
+		verr.Add(field, fmt.Sprintf("must be of type %v", schema["type"]))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		verr.Add(field, fmt.Sprintf("must be one of %v", enum))
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if min, ok := number(schema["minLength"]); ok && float64(n) < min {
+			verr.Add(field, fmt.Sprintf("must be at least %v characters", min))
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(n) > max {
+			verr.Add(field, fmt.Sprintf("must be at most %v characters", max))
+		}
+		switch schema["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, val); err != nil {
+				verr.Add(field, "must be an RFC 3339 date-time")
+			}
+		case "uuid":
+			if _, err := uuid.Parse(val); err != nil {
+				verr.Add(field, "must be a UUID")
+			}
+		}
+
+	case json.Number:
+		f, _ := val.Float64()
+		if min, ok := number(schema["minimum"]); ok && f < min {
+			verr.Add(field, fmt.Sprintf("must be >= %v", min))
+		}
+		if max, ok := number(schema["maximum"]); ok && f > max {
+			verr.Add(field, fmt.Sprintf("must be <= %v", max))
+		}
+
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		for i, it := range val {
+			s.validate(s.resolve(items), it, fmt.Sprintf("%s[%d]", path, i), verr)
+		}
+
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, name := range req {
+				if _, ok := val[name.(string)]; !ok {
+					verr.Add(join(path, name.(string)), "is required")
+				}
+			}
+		}
+		closed := schema["additionalProperties"] == false
+		// по отсортированным ключам, чтобы порядок ошибок в ответе был стабильным
+		for _, name := range slices.Sorted(maps.Keys(val)) {
+			pv := val[name]
+			ps, ok := props[name].(map[string]any)
+			if !ok {
+				if closed {
+					verr.Add(join(path, name), "unknown field")
+				}
+				continue
+			}
+			s.validate(s.resolve(ps), pv, join(path, name), verr)
+		}
+	}
+}
+
+func typeMatches(t any, v any) bool {
+	switch tt := t.(type) {
+	case nil:
+		return true
+	case string:
+		return isType(tt, v)
+	case []any:
+		for _, one := range tt {
+			if name, ok := one.(string); ok && isType(name, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, v any) bool {
+	switch name {
+	case "null":
+		return v == nil
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := strconv.ParseInt(n.String(), 10, 64)
+		return err == nil
+	}
+	return false
+}
+
+// coerce приводит строку из query/header/path к типу схемы, чтобы проверить её тем же validate
+func coerce(raw string, schema map[string]any) any {
+	switch schema["type"] {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,156 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+)
+
+// decode разбирает JSON так же, как Load: числа — json.Number
+func decode(t *testing.T, raw string) any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	s := &Spec{doc: decode(t, `{
+		"components": {"schemas": {
+			"Item": {"type": "object", "required": ["sku"], "properties": {"sku": {"type": "string"}}}
+		}}
+	}`).(map[string]any)}
+	schema := decode(t, `{
+		"type": "object",
+		"required": ["name", "kind"],
+		"additionalProperties": false,
+		"properties": {
+			"name":  {"type": "string", "minLength": 2},
+			"kind":  {"type": "string", "enum": ["a", "b"]},
+			"count": {"type": "integer", "minimum": 1},
+			"note":  {"type": ["string", "null"]},
+			"items": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}}
+		}
+	}`).(map[string]any)
+
+	tests := []struct {
+		name string
+		body string
+		want []domain.FieldError
+	}{
+		{"valid", `{"name": "ok", "kind": "a", "count": 3, "note": null, "items": [{"sku": "x"}]}`, nil},
+		{"body of wrong type", `[]`, []domain.FieldError{{Field: "body", Message: "must be of type object"}}},
+		{"field of wrong type", `{"name": 5, "kind": "a"}`, []domain.FieldError{{Field: "name", Message: "must be of type string"}}},
+		{"fraction for integer", `{"name": "ok", "kind": "a", "count": 1.5}`, []domain.FieldError{{Field: "count", Message: "must be of type integer"}}},
+		{"type union", `{"name": "ok", "kind": "a", "note": 1}`, []domain.FieldError{{Field: "note", Message: "must be of type [string null]"}}},
+		{"required missing", `{}`, []domain.FieldError{
+			{Field: "name", Message: "is required"},
+			{Field: "kind", Message: "is required"},
+		}},
+		{"enum", `{"name": "ok", "kind": "c"}`, []domain.FieldError{{Field: "kind", Message: "must be one of [a b]"}}},
+		{"unknown fields sorted", `{"name": "ok", "kind": "a", "zeta": 1, "alpha": 2}`, []domain.FieldError{
+			{Field: "alpha", Message: "unknown field"},
+			{Field: "zeta", Message: "unknown field"},
+		}},
+		{"nested via ref", `{"name": "ok", "kind": "a", "items": [{"sku": "x"}, {}]}`, []domain.FieldError{{Field: "items[1].sku", Message: "is required"}}},
+		{"bounds", `{"name": "o", "kind": "a", "count": 0}`, []domain.FieldError{
+			{Field: "count", Message: "must be >= 1"},
+			{Field: "name", Message: "must be at least 2 characters"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := &domain.ValidationError{}
+			s.validate(schema, decode(t, tt.body), "", verr)
+			if !reflect.DeepEqual(verr.Fields, tt.want) {
+				t.Fatalf("fields = %+v, want %+v", verr.Fields, tt.want)
+			}
+		})
+	}
+
+	// вложенные объекты без additionalProperties: false принимают лишние поля
+	t.Run("open nested object", func(t *testing.T) {
+		verr := &domain.ValidationError{}
+		s.validate(schema, decode(t, `{"name": "ok", "kind": "a", "items": [{"sku": "x", "extra": true}]}`), "", verr)
+		if len(verr.Fields) != 0 {
+			t.Fatalf("fields = %+v, want none", verr.Fields)
+		}
+	})
+}
+
+func TestValidateMiddleware(t *testing.T) {
+	logger.Init()
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	h := spec.Validate(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		anonymous   bool
+		want        int
+	}{
+		{"valid body", http.MethodPost, "/webhooks", "application/json", `{"url": "https://hooks.example.com", "events": ["order.created"]}`, false, http.StatusNoContent},
+		{"unknown field", http.MethodPost, "/webhooks", "application/json", `{"url": "https://hooks.example.com", "extra": 1}`, false, http.StatusBadRequest},
+		{"enum in array", http.MethodPost, "/webhooks", "application/json", `{"url": "https://hooks.example.com", "events": ["order.deleted"]}`, false, http.StatusBadRequest},
+		{"wrong type", http.MethodPost, "/webhooks", "application/json", `{"url": "https://hooks.example.com", "enabled": "yes"}`, false, http.StatusBadRequest},
+		{"required body", http.MethodPost, "/webhooks", "application/json", ``, false, http.StatusBadRequest},
+		{"broken JSON", http.MethodPost, "/webhooks", "application/json", `{"url":`, false, http.StatusBadRequest},
+		{"unsupported content-type", http.MethodPost, "/webhooks", "text/plain", `url`, false, http.StatusUnsupportedMediaType},
+		{"query enum", http.MethodGet, "/webhooks/0b8e7f8a-7d9c-4a4e-9d7e-6f1b2c3d4e5f/deliveries?state=lost", "", ``, false, http.StatusBadRequest},
+		{"path format", http.MethodGet, "/webhooks/not-a-uuid/deliveries", "", ``, false, http.StatusBadRequest},
+		{"path outside spec", http.MethodGet, "/static/app.js", "", ``, false, http.StatusNoContent},
+		{"anonymous is left to auth", http.MethodPost, "/webhooks", "application/json", `{"extra": 1}`, true, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if !tt.anonymous {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{ID: "test", Method: "api_key"}))
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestSecured(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	for path, want := range map[string]bool{"/webhooks": true, "/orders/abc": true, "/readyz": false, "/metrics": false} {
+		op, _, ok := spec.find(http.MethodGet, path)
+		if !ok {
+			t.Fatalf("GET %s not found in spec", path)
+		}
+		if got := spec.secured(op); got != want {
+			t.Errorf("secured(GET %s) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package presentation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/masking"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	sseHeartbeat    = 15 * time.Second
+	sseWriteTimeout = 10 * time.Second
+	sseBuffer       = 64
+)
+
+// RegisterStreams — долгоживущие роуты, их нельзя вешать под middleware.Timeout
+func (h *OrdersHandler) RegisterStreams(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersRead))
+		r.With(h.limits.Route("orders.stream")).Get("/orders/stream", h.StreamOrders)
+	})
+}
+
+// StreamOrders — SSE со свежесохранёнными заказами.
+// Фильтры: ?customer_id=...&delivery_service=...; докачка по Last-Event-ID из буфера шины.
+func (h *OrdersHandler) StreamOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	customerID := q.Get("customer_id")
+	deliveryService := q.Get("delivery_service")
+	tenant := auth.TenantFrom(r.Context())
+	pol := h.mask.For(auth.FromContext(r.Context()))
+	filter := func(ev application.Event) bool {
+		if ev.Order.Tenant != tenant {
+			return false
+		}
+		if customerID != "" && ev.Order.CustomerID != customerID {
+			return false
+		}
+		if deliveryService != "" && ev.Order.DeliveryService != deliveryService {
+			return false
+		}
+		return true
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("last_event_id")
+	}
+	var (
+		since  uint64
+		resume bool
+	)
+	if lastID != "" {
+		v, err := strconv.ParseUint(lastID, 10, 64)
+		since, resume = v, err == nil
+	}
+
+	sub, backlog, complete := h.svc.Events().Subscribe(since, resume, sseBuffer, filter)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(write func() error) bool {
+		// медленный клиент не должен держать горутину вечно
+		_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if err := write(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	push := func(ev application.Event) bool {
+		if !send(func() error { return writeSSE(w, ev, pol) }) {
+			return false
+		}
+		h.svc.RecordStreamed(r.Context(), tenant, ev.Order.OrderUID)
+		return true
+	}
+
+	if !send(func() error {
+		_, err := fmt.Fprint(w, "retry: 3000\n\n")
+		return err
+	}) {
+		return
+	}
+
+	// часть истории потеряна — пусть клиент перечитает состояние целиком
+	if !complete {
+		if !send(func() error {
+			_, err := fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+			return err
+		}) {
+			return
+		}
+	}
+	for _, ev := range backlog {
+		if !push(ev) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Lagged():
+			logger.Warn("sse client is too slow, disconnecting", "remote_addr", r.RemoteAddr)
+			return
+		case ev := <-sub.C:
+			if !push(ev) {
+				return
+			}
+		case <-ticker.C:
+			if !send(func() error {
+				_, err := fmt.Fprint(w, ": ping\n\n")
+				return err
+			}) {
+				return
+			}
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev application.Event, pol masking.Policy) error {
+	data, err := json.Marshal(pol.Apply(ev.Order))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
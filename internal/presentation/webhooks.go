@@ -0,0 +1,248 @@
+package presentation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/helpers"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/RaikyD/wb-orders-service/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const minSecretLen = 16
+
+type WebhookStore interface {
+	CreateSubscription(ctx context.Context, tenant string, s *repository.WebhookSubscription) (*repository.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, tenant string, id uuid.UUID) (*repository.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context, tenant string) ([]repository.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, tenant string, id uuid.UUID, patch repository.WebhookPatch) (*repository.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, tenant string, id uuid.UUID) error
+	ListDeliveries(ctx context.Context, tenant string, subID uuid.UUID, state string, limit, offset int) ([]repository.WebhookDelivery, error)
+}
+
+type WebhooksHandler struct {
+	store  WebhookStore
+	limits *limits.Limits
+}
+
+func NewWebhooksHandler(store WebhookStore, lim *limits.Limits) *WebhooksHandler {
+	return &WebhooksHandler{store: store, limits: lim}
+}
+
+// подписки видят секреты и чужие данные — только админам; каждый видит и заводит подписки своего тенанта
+func (h *WebhooksHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersAdmin), h.limits.Route("webhooks"))
+		r.Get("/webhooks", h.List)
+		r.Get("/webhooks/{id}", h.Get)
+		r.Get("/webhooks/{id}/deliveries", h.Deliveries)
+		r.Group(func(r chi.Router) {
+			r.Use(auth.AuditWrites)
+			r.Post("/webhooks", h.Create)
+			r.Patch("/webhooks/{id}", h.Update)
+			r.Delete("/webhooks/{id}", h.Delete)
+		})
+	})
+}
+
+type webhookRequest struct {
+	URL         *string   `json:"url"`
+	Events      *[]string `json:"events"`
+	Secret      *string   `json:"secret"`
+	Description *string   `json:"description"`
+	Enabled     *bool     `json:"enabled"`
+}
+
+func (req *webhookRequest) validate(create bool) error {
+	verr := &domain.ValidationError{}
+	if req.URL == nil {
+		if create {
+			verr.Add("url", "is required")
+		}
+	} else if u, err := url.Parse(*req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.Add("url", "must be an absolute http(s) URL")
+	} else if webhooks.CheckTarget(u) != nil {
+		verr.Add("url", "must point to a public address")
+	}
+	if req.Events != nil {
+		for i, ev := range *req.Events {
+			if !slices.Contains(webhooks.EventTypes, ev) {
+				verr.Add("events["+strconv.Itoa(i)+"]", "unknown event type")
+			}
+		}
+	}
+	if req.Secret != nil && len(*req.Secret) < minSecretLen {
+		verr.Add("secret", "must be at least 16 characters")
+	}
+	if create && req.Enabled != nil {
+		verr.Add("enabled", "is not allowed on create")
+	}
+	return verr.Err()
+}
+
+// ответ на создание — единственный раз, когда секрет отдаётся наружу
+type createdWebhook struct {
+	*repository.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+func (h *WebhooksHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if err := req.validate(true); err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+
+	sub := &repository.WebhookSubscription{URL: *req.URL, Events: []string{}}
+	if req.Events != nil {
+		sub.Events = *req.Events
+	}
+	if req.Description != nil {
+		sub.Description = *req.Description
+	}
+	if req.Secret != nil {
+		sub.Secret = *req.Secret
+	} else {
+		buf := make([]byte, 32)
+		_, _ = rand.Read(buf)
+		sub.Secret = hex.EncodeToString(buf)
+	}
+
+	created, err := h.store.CreateSubscription(r.Context(), auth.TenantFrom(r.Context()), sub)
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusCreated, createdWebhook{WebhookSubscription: created, Secret: created.Secret})
+}
+
+func (h *WebhooksHandler) List(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.store.ListSubscriptions(r.Context(), auth.TenantFrom(r.Context()))
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, subs)
+}
+
+func (h *WebhooksHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.store.GetSubscription(r.Context(), auth.TenantFrom(r.Context()), id)
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, sub)
+}
+
+// Update — частичное обновление; enabled=true заодно сбрасывает счётчик ошибок
+func (h *WebhooksHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if err := req.validate(false); err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+
+	sub, err := h.store.UpdateSubscription(r.Context(), auth.TenantFrom(r.Context()), id, repository.WebhookPatch{
+		URL:         req.URL,
+		Events:      req.Events,
+		Secret:      req.Secret,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+	})
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, sub)
+}
+
+func (h *WebhooksHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteSubscription(r.Context(), auth.TenantFrom(r.Context()), id); err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries — журнал доставок подписчика: ?state=pending|delivered|failed&limit=&offset=
+func (h *WebhooksHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state != "" && state != "pending" && state != "delivered" && state != "failed" {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "state", Message: "must be pending, delivered or failed"}}})
+		return
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	// 404 на несуществующего подписчика, а не пустой список
+	if _, err := h.store.GetSubscription(r.Context(), auth.TenantFrom(r.Context()), id); err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	rows, err := h.store.ListDeliveries(r.Context(), auth.TenantFrom(r.Context()), id, state, limit, offset)
+	if err != nil {
+		helpers.WriteError(w, r, err)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, rows)
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.WriteError(w, r, &domain.ValidationError{Fields: []domain.FieldError{{Field: "id", Message: "must be a UUID"}}})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := helpers.DecodeJSON(r.Body, v); err != nil {
+		if limits.IsTooLarge(err) {
+			helpers.HttpError(w, r, http.StatusRequestEntityTooLarge, helpers.CodeBodyTooLarge, "request body too large")
+			return false
+		}
+		helpers.HttpError(w, r, http.StatusBadRequest, helpers.CodeInvalidBody, "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,278 @@
+package presentation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/auth"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/limits"
+	"github.com/RaikyD/wb-orders-service/internal/presentation/masking"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+	wsBuffer       = 128
+)
+
+// Протокол /orders/ws (JSON в обе стороны).
+//
+// Клиент:
+//
+//	{"action": "subscribe",   "order_uids": ["..."], "track_numbers": ["..."]}
+//	{"action": "unsubscribe", "order_uids": ["..."], "track_numbers": ["..."]}
+//
+// Сервер:
+//
+//	{"type": "subscribed", "order_uids": [...], "track_numbers": [...]} — текущий набор подписок
+//	{"type": "snapshot", "order": {...}}                               — заказ целиком при подписке по order_uid
+//	{"type": "order.created" | "order.status_changed", "event_id": 1, "order": {...}}
+//	{"type": "error", "code": "...", "message": "..."}
+type wsClientMessage struct {
+	Action       string   `json:"action"`
+	OrderUIDs    []string `json:"order_uids"`
+	TrackNumbers []string `json:"track_numbers"`
+}
+
+type wsServerMessage struct {
+	Type         string        `json:"type"`
+	EventID      uint64        `json:"event_id,omitempty"`
+	Order        *domain.Order `json:"order,omitempty"`
+	OrderUIDs    []string      `json:"order_uids,omitempty"`
+	TrackNumbers []string      `json:"track_numbers,omitempty"`
+	Code         string        `json:"code,omitempty"`
+	Message      string        `json:"message,omitempty"`
+}
+
+type SocketHandler struct {
+	svc            *application.OrdersService
+	limits         *limits.Limits
+	maxSubs        int
+	originPatterns []string
+	mask           *masking.Rules
+}
+
+func NewSocketHandler(svc *application.OrdersService, lim *limits.Limits, maxSubs int, originPatterns []string, mask *masking.Rules) *SocketHandler {
+	return &SocketHandler{svc: svc, limits: lim, maxSubs: maxSubs, originPatterns: originPatterns, mask: mask}
+}
+
+func (h *SocketHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeOrdersRead))
+		r.With(h.limits.Route("orders.ws")).Get("/orders/ws", h.Serve)
+	})
+}
+
+func (h *SocketHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: h.originPatterns})
+	if err != nil {
+		// Accept уже ответил клиенту
+		logger.Warn("ws accept failed", "err", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := &wsConn{
+		conn:    conn,
+		svc:     h.svc,
+		tenant:  auth.TenantFrom(r.Context()),
+		mask:    h.mask.For(auth.FromContext(r.Context())),
+		maxSubs: h.maxSubs,
+		uids:    make(map[string]struct{}),
+		tracks:  make(map[string]struct{}),
+	}
+
+	// фильтр на стороне шины: чужие тенанты и неотслеживаемые заказы не занимают буфер сокета,
+	// иначе всплеск событий по всему сервису отключал бы клиентов как медленных.
+	// Подписки меняются на лету — фильтр читает текущее состояние c под его мьютексом
+	sub, _, _ := h.svc.Events().Subscribe(0, false, wsBuffer, func(ev application.Event) bool {
+		return c.matches(ev.Order)
+	})
+	defer sub.Close()
+
+	go c.keepalive(ctx, cancel)
+	go c.readLoop(ctx, cancel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+		case <-sub.Lagged():
+			logger.Warn("ws client is too slow, disconnecting", "remote_addr", r.RemoteAddr)
+			conn.Close(websocket.StatusTryAgainLater, "client is too slow")
+			return
+		case ev := <-sub.C:
+			if err := c.write(ctx, wsServerMessage{Type: ev.Type, EventID: ev.ID, Order: c.mask.Apply(ev.Order)}); err != nil {
+				return
+			}
+			h.svc.RecordStreamed(r.Context(), c.tenant, ev.Order.OrderUID)
+		}
+	}
+}
+
+type wsConn struct {
+	conn    *websocket.Conn
+	svc     *application.OrdersService
+	tenant  string // соединение видит заказы только своего тенанта
+	mask    masking.Policy
+	maxSubs int
+
+	// пишет и основной цикл, и readLoop (ответы на subscribe)
+	writeMu sync.Mutex
+
+	mu     sync.RWMutex
+	uids   map[string]struct{}
+	tracks map[string]struct{}
+}
+
+func (c *wsConn) write(ctx context.Context, msg wsServerMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, c.conn, msg)
+}
+
+func (c *wsConn) matches(o *domain.Order) bool {
+	if o == nil || o.Tenant != c.tenant {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, byUID := c.uids[o.OrderUID]
+	_, byTrack := c.tracks[o.TrackNumber]
+	return byUID || byTrack
+}
+
+func (c *wsConn) readLoop(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	for {
+		var msg wsClientMessage
+		if err := wsjson.Read(ctx, c.conn, &msg); err != nil {
+			var ce websocket.CloseError
+			if !errors.As(err, &ce) && ctx.Err() == nil {
+				logger.Warn("ws read failed", "err", err)
+			}
+			return
+		}
+
+		var err error
+		switch msg.Action {
+		case "subscribe":
+			err = c.subscribe(ctx, msg)
+		case "unsubscribe":
+			c.unsubscribe(msg)
+			err = c.write(ctx, c.state())
+		default:
+			err = c.write(ctx, wsServerMessage{Type: "error", Code: "unknown_action", Message: "action must be subscribe or unsubscribe"})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *wsConn) subscribe(ctx context.Context, msg wsClientMessage) error {
+	c.mu.Lock()
+	added := make([]string, 0, len(msg.OrderUIDs))
+	for _, uid := range msg.OrderUIDs {
+		if _, ok := c.uids[uid]; !ok && uid != "" {
+			added = append(added, uid)
+		}
+	}
+	var newTracks []string
+	for _, tn := range msg.TrackNumbers {
+		if _, ok := c.tracks[tn]; !ok && tn != "" {
+			newTracks = append(newTracks, tn)
+		}
+	}
+	if len(c.uids)+len(c.tracks)+len(added)+len(newTracks) > c.maxSubs {
+		c.mu.Unlock()
+		return c.write(ctx, wsServerMessage{
+			Type:    "error",
+			Code:    "subscription_limit",
+			Message: "too many subscriptions on this connection",
+		})
+	}
+	for _, uid := range added {
+		c.uids[uid] = struct{}{}
+	}
+	for _, tn := range newTracks {
+		c.tracks[tn] = struct{}{}
+	}
+	c.mu.Unlock()
+
+	if err := c.write(ctx, c.state()); err != nil {
+		return err
+	}
+
+	// по order_uid сразу отдаём текущее состояние заказа, дальше — только изменения
+	for _, uid := range added {
+		o, err := c.svc.GetbyUID(ctx, c.tenant, uid)
+		if err != nil || o == nil {
+			continue
+		}
+		if err := c.write(ctx, wsServerMessage{Type: "snapshot", Order: c.mask.Apply(o)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *wsConn) unsubscribe(msg wsClientMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, uid := range msg.OrderUIDs {
+		delete(c.uids, uid)
+	}
+	for _, tn := range msg.TrackNumbers {
+		delete(c.tracks, tn)
+	}
+}
+
+func (c *wsConn) state() wsServerMessage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	msg := wsServerMessage{Type: "subscribed"}
+	for uid := range c.uids {
+		msg.OrderUIDs = append(msg.OrderUIDs, uid)
+	}
+	for tn := range c.tracks {
+		msg.TrackNumbers = append(msg.TrackNumbers, tn)
+	}
+	return msg
+}
+
+// keepalive шлёт ping; не дождались pong — соединение мёртвое, закрываем
+func (c *wsConn) keepalive(ctx context.Context, cancel context.CancelFunc) {
+	t := time.NewTicker(wsPingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			pctx, pcancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := c.conn.Ping(pctx)
+			pcancel()
+			if err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ArchiveRepository — выборка заказов в холодный архив и индекс wb.archived_orders
+type ArchiveRepository struct {
+	pool   *pgxpool.Pool
+	orders *OrderRepository
+}
+
+// NewArchiveRepository — поверх репозитория заказов: заказы собираются им же, с расшифровкой доставки
+func NewArchiveRepository(orders *OrderRepository) *ArchiveRepository {
+	return &ArchiveRepository{pool: orders.pool, orders: orders}
+}
+
+// OrdersBefore — до limit заказов всех тенантов с date_created раньше before, старые первыми,
+// собранные целиком из таблиц
+func (a *ArchiveRepository) OrdersBefore(ctx context.Context, before time.Time, limit int) ([]*domain.Order, error) {
+	var out []*domain.Order
+	err := inTenant(ctx, a.pool, AllTenants, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id FROM wb.orders
+			WHERE date_created < $1
+			ORDER BY date_created, id
+			LIMIT $2
+		`, before, limit)
+		if err != nil {
+			return err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			o, err := a.orders.getOrder(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if o != nil {
+				out = append(out, o)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// MarkArchived одной транзакцией заносит заказы в индекс под file и удаляет их из wb:
+// доставка, оплата и позиции уходят каскадом, ключ uid и история версий — вместе с заказом
+func (a *ArchiveRepository) MarkArchived(ctx context.Context, file string, orders []*domain.Order) error {
+	return inTenant(ctx, a.pool, AllTenants, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, o := range orders {
+			// тот же заказ мог уже попасть в файл прошлого прогона, упавшего до удаления — берём новый файл
+			batch.Queue(`
+				INSERT INTO wb.archived_orders (tenant_id, order_uid, order_id, date_created, file)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (tenant_id, order_uid) DO UPDATE
+				SET order_id = EXCLUDED.order_id, date_created = EXCLUDED.date_created,
+				    file = EXCLUDED.file, archived_at = now()
+			`, o.Tenant, o.OrderUID, o.OrderID, o.DateCreated, file)
+			batch.Queue(`DELETE FROM wb.orders WHERE id = $1 AND date_created = $2`, o.OrderID, o.DateCreated)
+			batch.Queue(`DELETE FROM wb.order_keys WHERE tenant_id = $1 AND order_uid = $2`, o.Tenant, o.OrderUID)
+			batch.Queue(`DELETE FROM wb.order_history WHERE order_id = $1`, o.OrderID)
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// LocateArchived — файл архива с заказом тенанта; "" — в архиве его нет
+func (a *ArchiveRepository) LocateArchived(ctx context.Context, tenant, uid string) (string, error) {
+	var file string
+	err := inTenant(ctx, a.pool, tenant, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx,
+			`SELECT file FROM wb.archived_orders WHERE tenant_id = $1 AND order_uid = $2`, tenant, uid,
+		).Scan(&file)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return file, err
+}
+
+// CustomerErased — стирали ли данные клиента тенанта после created, то есть когда заказ с такой
+// date_created уже существовал. Заказы, оформленные после стирания, под него не попадают
+func (a *ArchiveRepository) CustomerErased(ctx context.Context, tenant, customerID string, created time.Time) (bool, error) {
+	var erased bool
+	err := inTenant(ctx, a.pool, tenant, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM wb.erasures
+				WHERE tenant_id = $1 AND customer_id = $2 AND erased_at >= $3
+			)
+		`, tenant, customerID, created).Scan(&erased)
+	})
+	return erased, err
+}
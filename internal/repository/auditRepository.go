@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AuditEntry — строка wb.audit_log
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Tenant    string    `json:"tenant_id"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	OrderUID  string    `json:"order_uid,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Source    string    `json:"source"`
+	Fields    []string  `json:"fields,omitempty"`
+}
+
+// AuditQuery — фильтры журнала; пустые поля не фильтруют
+type AuditQuery struct {
+	Actor    string
+	OrderUID string
+	From     *time.Time // включительно
+	To       *time.Time // не включительно
+	Limit    int
+	Offset   int
+}
+
+type AuditRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditRepository(p *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{pool: p}
+}
+
+// InsertAudit дописывает пачку записей; в пачке бывают разные тенанты, поэтому AllTenants
+func (a *AuditRepository) InsertAudit(ctx context.Context, entries []AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return inTenant(ctx, a.pool, AllTenants, func(tx pgx.Tx) error {
+		_, err := tx.CopyFrom(ctx,
+			pgx.Identifier{"wb", "audit_log"},
+			[]string{"tenant_id", "at", "actor", "action", "order_uid", "request_id", "source", "fields"},
+			pgx.CopyFromSlice(len(entries), func(i int) ([]any, error) {
+				e := entries[i]
+				fields := e.Fields
+				if fields == nil {
+					fields = []string{}
+				}
+				return []any{e.Tenant, e.At, e.Actor, e.Action, e.OrderUID, e.RequestID, e.Source, fields}, nil
+			}),
+		)
+		return err
+	})
+}
+
+// ListAudit — записи тенанта, свежие первыми
+func (a *AuditRepository) ListAudit(ctx context.Context, tenant string, q AuditQuery) ([]AuditEntry, error) {
+	where := []string{"tenant_id = $1"}
+	args := []any{tenant}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if q.Actor != "" {
+		add("actor = ?", q.Actor)
+	}
+	if q.OrderUID != "" {
+		add("order_uid = ?", q.OrderUID)
+	}
+	if q.From != nil {
+		add("at >= ?", *q.From)
+	}
+	if q.To != nil {
+		add("at < ?", *q.To)
+	}
+	args = append(args, q.Limit, q.Offset)
+	sql := `SELECT id, tenant_id, at, actor, action, order_uid, request_id, source, fields
+		FROM wb.audit_log
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	out := []AuditEntry{}
+	err := inTenant(ctx, a.pool, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e AuditEntry
+			if err := rows.Scan(&e.ID, &e.Tenant, &e.At, &e.Actor, &e.Action, &e.OrderUID, &e.RequestID, &e.Source, &e.Fields); err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DLQRedrive — запись о том, что сообщение из DLQ отправлено обратно в основной топик
+type DLQRedrive struct {
+	DLQTopic    string    `json:"-"`
+	Partition   int       `json:"-"`
+	Offset      int64     `json:"-"`
+	TargetTopic string    `json:"target_topic"`
+	Patched     bool      `json:"patched"`
+	Actor       string    `json:"actor"`
+	Count       int       `json:"redrive_count"`
+	RedrivenAt  time.Time `json:"redriven_at"`
+}
+
+// DLQKey — координаты сообщения в DLQ
+type DLQKey struct {
+	Partition int   `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+type DLQRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewDLQRepository(p *pgxpool.Pool) *DLQRepository {
+	return &DLQRepository{pool: p}
+}
+
+// Redrive записывает отправку и вызывает publish в одной транзакции: если publish упал,
+// записи нет и сообщение можно отправить снова. false — уже отправляли, а force не задан.
+func (p *DLQRepository) Redrive(ctx context.Context, rec DLQRedrive, force bool, publish func() error) (bool, error) {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// строка держится заблокированной до коммита — параллельный redrive того же сообщения ждёт
+	q := `
+		INSERT INTO wb.dlq_redrives (dlq_topic, dlq_partition, dlq_offset, target_topic, patched, actor)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (dlq_topic, dlq_partition, dlq_offset) DO NOTHING
+	`
+	if force {
+		q = `
+			INSERT INTO wb.dlq_redrives (dlq_topic, dlq_partition, dlq_offset, target_topic, patched, actor)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (dlq_topic, dlq_partition, dlq_offset) DO UPDATE
+			SET target_topic = EXCLUDED.target_topic,
+			    patched = EXCLUDED.patched,
+			    actor = EXCLUDED.actor,
+			    redrive_count = wb.dlq_redrives.redrive_count + 1,
+			    redriven_at = now()
+		`
+	}
+	tag, err := tx.Exec(ctx, q, rec.DLQTopic, rec.Partition, rec.Offset, rec.TargetTopic, rec.Patched, rec.Actor)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := publish(); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// Redrives — записи об отправке для указанных сообщений топика
+func (p *DLQRepository) Redrives(ctx context.Context, topic string, keys []DLQKey) (map[DLQKey]DLQRedrive, error) {
+	out := make(map[DLQKey]DLQRedrive, len(keys))
+	if len(keys) == 0 {
+		return out, nil
+	}
+	parts := make([]int32, len(keys))
+	offsets := make([]int64, len(keys))
+	for i, k := range keys {
+		parts[i], offsets[i] = int32(k.Partition), k.Offset
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT dlq_partition, dlq_offset, target_topic, patched, actor, redrive_count, redriven_at
+		FROM wb.dlq_redrives
+		WHERE dlq_topic = $1
+		  AND (dlq_partition, dlq_offset) IN (SELECT * FROM unnest($2::int[], $3::bigint[]))
+	`, topic, parts, offsets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := DLQRedrive{DLQTopic: topic}
+		if err := rows.Scan(&r.Partition, &r.Offset, &r.TargetTopic, &r.Patched, &r.Actor, &r.Count, &r.RedrivenAt); err != nil {
+			return nil, err
+		}
+		out[DLQKey{Partition: r.Partition, Offset: r.Offset}] = r
+	}
+	return out, rows.Err()
+}
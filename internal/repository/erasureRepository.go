@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ErasureSourceHTTP = "http"
+	ErasureSourceCLI  = "cli"
+)
+
+// Erasure — запись журнала wb.erasures
+type Erasure struct {
+	ID         uuid.UUID `json:"id"`
+	Tenant     string    `json:"tenant_id"`
+	CustomerID string    `json:"customer_id"`
+	Orders     int       `json:"orders"`
+	OrderUIDs  []string  `json:"order_uids"`
+	Actor      string    `json:"actor"`
+	Source     string    `json:"source"`
+	ErasedAt   time.Time `json:"erased_at"`
+}
+
+// EraseCustomer обезличивает доставку во всех заказах клиента тенанта — в wb.delivery, в payload и во всех
+// прошлых версиях wb.order_history (само стирание ложится туда новой версией) —
+// и одной транзакцией с этим пишет запись в wb.erasures и по событию CustomerDataErased на заказ в outbox.
+// Заказов нет — запись в журнале всё равно появляется, с orders = 0.
+// Тела вебхуков с заказами клиента, доставленные и нет, и события OrderCreated в outbox
+// (неотправленные и хранимые после отправки) обезличиваются так же.
+// Файлы холодного архива не переписываются: доставку архивных заказов обезличивает при чтении
+// archive.Archiver.Lookup по этому журналу, см. CustomerErased.
+func (p *OrderRepository) EraseCustomer(ctx context.Context, tenant, customerID, actor, source string) (*Erasure, error) {
+	e := &Erasure{Tenant: tenant, CustomerID: customerID, Actor: actor, Source: source, OrderUIDs: []string{}}
+	patch, err := json.Marshal(domain.DeliveryData{}.Anonymized())
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id, date_created, order_uid FROM wb.orders
+			WHERE tenant_id = $1 AND customer_id = $2
+			FOR UPDATE
+		`, tenant, customerID)
+		if err != nil {
+			return err
+		}
+		type ref struct {
+			id      uuid.UUID
+			created time.Time
+			uid     string
+		}
+		var refs []ref
+		for rows.Next() {
+			var r ref
+			if err := rows.Scan(&r.id, &r.created, &r.uid); err != nil {
+				rows.Close()
+				return err
+			}
+			refs = append(refs, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		batch := &pgx.Batch{}
+		ids := make([]string, 0, len(refs))
+		for _, r := range refs {
+			batch.Queue(`
+				UPDATE wb.delivery
+				SET name = $3, phone = '', zip = '', address = '', email = '', phone_bidx = NULL, email_bidx = NULL
+				WHERE order_id = $1 AND date_created = $2
+			`, r.id, r.created, domain.ErasedMarker)
+			// в payload поверх доставки кладём обезличенные поля, город и регион остаются как были
+			batch.Queue(`
+				UPDATE wb.orders
+				SET payload = jsonb_set(payload, '{delivery}', (payload->'delivery') || ($3::jsonb - 'city' - 'region'))
+				WHERE id = $1 AND date_created = $2 AND jsonb_typeof(payload->'delivery') = 'object'
+			`, r.id, r.created, patch)
+			// прошлые версии заказа хранят те же данные — стираем и там
+			batch.Queue(`
+				UPDATE wb.order_history
+				SET snapshot = jsonb_set(snapshot, '{delivery}', (snapshot->'delivery') || ($2::jsonb - 'city' - 'region'))
+				WHERE order_id = $1 AND jsonb_typeof(snapshot->'delivery') = 'object'
+			`, r.id, patch)
+			e.OrderUIDs = append(e.OrderUIDs, r.uid)
+			ids = append(ids, r.id.String())
+		}
+		// outbox без tenant_id, а order_uid уникален только в тенанте — сверяем ещё и id заказа
+		batch.Queue(`
+			UPDATE wb.outbox
+			SET payload = jsonb_set(payload, '{data,order,delivery}', (payload->'data'->'order'->'delivery') || ($4::jsonb - 'city' - 'region'))
+			WHERE event_type = $1 AND order_uid = ANY($2) AND payload->'data'->'order'->>'OrderID' = ANY($3)
+			  AND jsonb_typeof(payload->'data'->'order'->'delivery') = 'object'
+		`, domain.EventOrderCreated, e.OrderUIDs, ids, patch)
+		// очередь вебхуков хранит заказ целиком; индекса по клиенту там нет, но стирание — редкая операция
+		batch.Queue(`
+			UPDATE wb.webhook_deliveries
+			SET payload = jsonb_set(payload, '{order,delivery}', (payload->'order'->'delivery') || ($3::jsonb - 'city' - 'region'))
+			WHERE tenant_id = $1 AND payload->'order'->>'customer_id' = $2
+			  AND jsonb_typeof(payload->'order'->'delivery') = 'object'
+		`, tenant, customerID, patch)
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		for _, r := range refs {
+			if err := snapshotOrder(ctx, tx, r.id, r.created, HistoryErase); err != nil {
+				return err
+			}
+		}
+		e.Orders = len(refs)
+
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO wb.erasures (tenant_id, customer_id, orders, actor, source)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, erased_at
+		`, tenant, customerID, e.Orders, actor, source).Scan(&e.ID, &e.ErasedAt); err != nil {
+			return err
+		}
+
+		for _, uid := range e.OrderUIDs {
+			ev, err := domain.NewEvent(domain.EventCustomerDataErased, uid, domain.CustomerDataErasedData{
+				ErasureID: e.ID, CustomerID: customerID, Tenant: tenant,
+			})
+			if err != nil {
+				return err
+			}
+			if err := insertOutbox(ctx, tx, ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Что породило версию заказа в wb.order_history. Версию пишет только изменение содержания.
+// Служебные перезаписи payload — перешифрование (RotatePII) и подъём формы (UpgradePayloads) —
+// версий не порождают: заказ тот же, а снимки при чтении и так расшифровываются и поднимаются
+// до текущей формы (decodeSnapshot), так что ни as_of, ни diff между версиями их не видят
+const (
+	HistoryCreate       = "create"
+	HistoryStatusChange = "status_change"
+	HistoryErase        = "erase"
+)
+
+// OrderVersion — версия заказа; действует с ValidFrom до ValidFrom следующей
+type OrderVersion struct {
+	Version   int           `json:"version"`
+	Change    string        `json:"change"`
+	ValidFrom time.Time     `json:"valid_from"`
+	Order     *domain.Order `json:"order"`
+}
+
+// snapshotOrder записывает текущий payload заказа новой версией. Зовётся в транзакции изменения,
+// после него: откатилось изменение — откатилась и версия
+func snapshotOrder(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, created time.Time, change string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO wb.order_history (tenant_id, order_uid, version, order_id, date_created, change, snapshot)
+		SELECT o.tenant_id, o.order_uid,
+		       coalesce((SELECT max(h.version) FROM wb.order_history h
+		                 WHERE h.tenant_id = o.tenant_id AND h.order_uid = o.order_uid), 0) + 1,
+		       o.id, o.date_created, $3, o.payload
+		FROM wb.orders o
+		WHERE o.id = $1 AND o.date_created = $2 AND o.payload IS NOT NULL
+	`, orderID, created, change)
+	return err
+}
+
+// OrderHistory — все версии заказа тенанта, от первой к последней; пусто — истории нет
+func (p *OrderRepository) OrderHistory(ctx context.Context, tenant, uid string) ([]OrderVersion, error) {
+	out := []OrderVersion{}
+	err := p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT version, change, valid_from, order_id, snapshot
+			FROM wb.order_history
+			WHERE tenant_id = $1 AND order_uid = $2
+			ORDER BY version
+		`, tenant, uid)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				v       OrderVersion
+				orderID uuid.UUID
+				raw     []byte
+			)
+			if err := rows.Scan(&v.Version, &v.Change, &v.ValidFrom, &orderID, &raw); err != nil {
+				return err
+			}
+			if v.Order, err = p.decodeSnapshot(ctx, tenant, orderID, raw); err != nil {
+				return err
+			}
+			out = append(out, v)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OrderAsOf — заказ тенанта в том виде, в каком он был в момент at; nil — тогда его ещё не было
+// (или его история уже удалена вместе с ним)
+func (p *OrderRepository) OrderAsOf(ctx context.Context, tenant, uid string, at time.Time) (*domain.Order, error) {
+	var o *domain.Order
+	err := p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		var (
+			orderID uuid.UUID
+			raw     []byte
+		)
+		err := tx.QueryRow(ctx, `
+			SELECT order_id, snapshot
+			FROM wb.order_history
+			WHERE tenant_id = $1 AND order_uid = $2 AND valid_from <= $3
+			ORDER BY version DESC
+			LIMIT 1
+		`, tenant, uid, at).Scan(&orderID, &raw)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		o, err = p.decodeSnapshot(ctx, tenant, orderID, raw)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// decodeSnapshot — снимок в domain.Order: расшифровка доставки и подъём старой версии формы, как у кэша
+func (p *OrderRepository) decodeSnapshot(ctx context.Context, tenant string, orderID uuid.UUID, raw []byte) (*domain.Order, error) {
+	raw, err := p.openPayload(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	o, err := domain.DecodeOrder(raw, domain.VersionUnknown, false)
+	if err != nil {
+		return nil, err
+	}
+	o.OrderID = orderID
+	o.Tenant = tenant
+	return o, nil
+}
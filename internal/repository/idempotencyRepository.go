@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdempotencyRecord struct {
+	Scope        string
+	Key          string
+	RequestHash  string
+	Completed    bool
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	ExpiresAt    time.Time
+	LockedUntil  time.Time // для in_progress — до какого момента ключ занят этим запросом
+}
+
+type IdempotencyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyRepository(p *pgxpool.Pool) *IdempotencyRepository {
+	return &IdempotencyRepository{pool: p}
+}
+
+// Reserve пытается занять ключ на lease. Ключ свободен, если записи нет, она протухла
+// или in_progress с истёкшей арендой (процесс упал, не освободив ключ) — тогда пишем
+// in_progress и возвращаем (rec, true) с LockedUntil: это токен для Complete и Release.
+// Иначе отдаём существующую запись.
+func (p *IdempotencyRepository) Reserve(ctx context.Context, scope, key, hash string, ttl, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	// в базе время хранится с точностью до микросекунд, токен должен совпасть при сравнении
+	now := time.Now()
+	lockedUntil := now.Add(lease).Truncate(time.Microsecond)
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO wb.idempotency_keys (scope, idem_key, request_hash, expires_at, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, idem_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, state = 'in_progress',
+		    status_code = NULL, content_type = NULL, response_body = NULL,
+		    created_at = now(), expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+		WHERE wb.idempotency_keys.expires_at < now()
+		   OR (wb.idempotency_keys.state = 'in_progress' AND wb.idempotency_keys.locked_until < now())
+	`, scope, key, hash, now.Add(ttl), lockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+	if tag.RowsAffected() == 1 {
+		return &IdempotencyRecord{Scope: scope, Key: key, RequestHash: hash, LockedUntil: lockedUntil}, true, nil
+	}
+
+	rec := &IdempotencyRecord{Scope: scope, Key: key}
+	var (
+		state       string
+		status      *int
+		contentType *string
+		leasedUntil *time.Time
+	)
+	err = p.pool.QueryRow(ctx, `
+		SELECT request_hash, state, status_code, content_type, response_body, expires_at, locked_until
+		FROM wb.idempotency_keys
+		WHERE scope = $1 AND idem_key = $2
+	`, scope, key).Scan(&rec.RequestHash, &state, &status, &contentType, &rec.ResponseBody, &rec.ExpiresAt, &leasedUntil)
+	if err != nil {
+		// запись успели удалить между INSERT и SELECT — пусть клиент повторит
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, ErrIdempotencyRace
+		}
+		return nil, false, err
+	}
+	rec.Completed = state == "completed"
+	if status != nil {
+		rec.StatusCode = *status
+	}
+	if contentType != nil {
+		rec.ContentType = *contentType
+	}
+	if leasedUntil != nil {
+		rec.LockedUntil = *leasedUntil
+	}
+	return rec, false, nil
+}
+
+var (
+	ErrIdempotencyRace      = errors.New("idempotency key changed concurrently")
+	ErrIdempotencyLeaseLost = errors.New("idempotency key lease expired before completion")
+)
+
+// Complete сохраняет ответ. lockedUntil — из Reserve: если аренда истекла и ключ уже занял
+// другой запрос, поздний ответ его не перезапишет
+func (p *IdempotencyRepository) Complete(ctx context.Context, scope, key string, lockedUntil time.Time, status int, contentType string, body []byte) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE wb.idempotency_keys
+		SET state = 'completed', status_code = $4, content_type = $5, response_body = $6, locked_until = NULL
+		WHERE scope = $1 AND idem_key = $2 AND state = 'in_progress' AND locked_until = $3
+	`, scope, key, lockedUntil, status, contentType, body)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// Release освобождает ключ, если запрос упал и сохранять его ответ нельзя
+func (p *IdempotencyRepository) Release(ctx context.Context, scope, key string, lockedUntil time.Time) error {
+	_, err := p.pool.Exec(ctx,
+		`DELETE FROM wb.idempotency_keys WHERE scope = $1 AND idem_key = $2 AND state = 'in_progress' AND locked_until = $3`,
+		scope, key, lockedUntil,
+	)
+	return err
+}
+
+func (p *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM wb.idempotency_keys WHERE expires_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
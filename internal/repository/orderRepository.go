@@ -6,40 +6,126 @@ import (
 	"errors"
 	"github.com/RaikyD/wb-orders-service/internal/domain"
 	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/pii"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
 	"time"
 )
 
 type OrderRepo interface {
 	AddOrder(ctx context.Context, order *domain.Order) error
-	GetOrderByUID(ctx context.Context, uid string) (*domain.Order, error)
-	GetOrderById(ctx context.Context, id uuid.UUID) (*domain.Order, error)
+	GetOrderByUID(ctx context.Context, tenant, uid string) (*domain.Order, error)
+	GetOrderById(ctx context.Context, tenant string, id uuid.UUID) (*domain.Order, error)
 	ListRecentPayloads(ctx context.Context, limit int) ([]struct {
 		ID      uuid.UUID
+		Tenant  string
 		Payload []byte
 	},
 		error)
+	UpdateItemsStatus(ctx context.Context, tenant, uid string, status int) error
 }
 
 type OrderRepository struct {
 	pool *pgxpool.Pool
+	// pii шифрует телефон, email и адрес доставки; nil — пишем открытым текстом
+	pii *pii.Protector
 }
 
 func NewOrderRepository(p *pgxpool.Pool) *OrderRepository {
 	return &OrderRepository{pool: p}
 }
 
-var ErrOrderAlreadyExists = errors.New("order already exists")
+// WithPII включает шифрование персональных полей доставки, см. internal/pii
+func (p *OrderRepository) WithPII(prot *pii.Protector) *OrderRepository {
+	p.pii = prot
+	return p
+}
+
+// AllTenants — wb.tenant_id для служебных проходов по всем тенантам (кэш, миграции payload).
+// Настоящим тенантом быть не может: domain.ValidTenant его не пропускает.
+const AllTenants = "*"
+
+// setTenant — до конца транзакции RLS показывает только строки tenant, см. миграцию tenant_rls
+func setTenant(ctx context.Context, tx pgx.Tx, tenant string) error {
+	_, err := tx.Exec(ctx, `SELECT set_config('wb.tenant_id', $1, true)`, tenant)
+	return err
+}
+
+// inTenant выполняет fn в транзакции, привязанной к тенанту
+func (p *OrderRepository) inTenant(ctx context.Context, tenant string, fn func(tx pgx.Tx) error) error {
+	return inTenant(ctx, p.pool, tenant, fn)
+}
 
+func inTenant(ctx context.Context, pool *pgxpool.Pool, tenant string, fn func(tx pgx.Tx) error) error {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := setTenant(ctx, tx, tenant); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+var ErrOrderAlreadyExists = domain.ErrOrderAlreadyExists
+
+// AddOrder пишет заказ. Месяц date_created без партиции (старый заказ или job ещё не успел
+// создать будущую) — создаём партиции и пробуем ещё раз, но только для даты в окне
+// domain.CheckDateCreated: вход проверяет Validate, а здесь — на случай пути в обход него
 func (p *OrderRepository) AddOrder(ctx context.Context, o *domain.Order) error {
-	payload, err := json.Marshal(o)
+	err := p.addOrder(ctx, o)
+	if !isNoPartition(err) {
+		return err
+	}
+	if msg := domain.CheckDateCreated(o.DateCreated, time.Now()); msg != "" {
+		v := &domain.ValidationError{}
+		v.Add("date_created", msg)
+		return v
+	}
+	logger.Info("no partition for order, creating", "order_uid", o.OrderUID, "date_created", o.DateCreated)
+	if _, err := p.pool.Exec(ctx, `SELECT wb.ensure_order_partitions($1)`, o.DateCreated); err != nil {
+		return err
+	}
+	return p.addOrder(ctx, o)
+}
+
+// isNoPartition — вставка в партиционированную таблицу, у которой нет партиции под строку
+func isNoPartition(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514" && strings.HasPrefix(pgErr.Message, "no partition of relation")
+}
+
+func (p *OrderRepository) addOrder(ctx context.Context, o *domain.Order) error {
+	// в БД всегда кладём текущую версию, на входе заказ уже поднят до неё
+	o.SchemaVersion = domain.OrderSchemaVersion
+	if o.Tenant == "" {
+		o.Tenant = domain.DefaultTenant
+	}
+	// в таблицы, payload и outbox доставка уходит зашифрованной, сам o остаётся открытым для кэша
+	// и событий внутри процесса
+	sealed, err := p.pii.SealDelivery(ctx, o.Delivery)
+	if err != nil {
+		return err
+	}
+	stored := *o
+	stored.Delivery = sealed
+	payload, err := json.Marshal(&stored)
 	if err != nil {
 		logger.Warn("Error while marshalling json-data")
 		return err
 	}
+	var keyID *string
+	if p.pii != nil {
+		id := p.pii.CurrentKeyID()
+		keyID = &id
+	}
 
 	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
@@ -53,18 +139,57 @@ func (p *OrderRepository) AddOrder(ctx context.Context, o *domain.Order) error {
 			tx.Rollback(ctx)
 		}
 	}()
+	if err = setTenant(ctx, tx, o.Tenant); err != nil {
+		return err
+	}
+
+	// сначала ключ: уникальность (tenant_id, order_uid) держит wb.order_keys,
+	// партиционированная wb.orders без date_created в ключе её не обеспечит
+	orderID := uuid.New()
+	_, err = tx.Exec(ctx,
+		`INSERT INTO wb.order_keys (tenant_id, order_uid, order_id, date_created) VALUES ($1, $2, $3, $4)`,
+		o.Tenant, o.OrderUID, orderID, o.DateCreated,
+	)
+	if err != nil {
+		//обрабатываем уникальное нарушение по order_uid
+		var pgErr *pgconn.PgError
+		// 23505 код для обозначение дупликата
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Заказ уже есть — достанем его id, чтобы вызвать позже кэширование.
+			// Уникальность в пределах тенанта, так что это заказ того же тенанта
+			if err2 := p.inTenant(ctx, o.Tenant, func(tx pgx.Tx) error {
+				return tx.QueryRow(ctx,
+					`SELECT order_id FROM wb.order_keys WHERE tenant_id = $1 AND order_uid = $2`, o.Tenant, o.OrderUID,
+				).Scan(&orderID)
+			}); err2 == nil {
+				o.OrderID = orderID
+			}
+			// транзакция уже сломана, пишем событие отдельно: записи заказа тут нет,
+			// так что откатывать вместе с ним нечего. Не записалось — вернём ошибку, сообщение перечитают.
+			ev, err := domain.NewEvent(domain.EventOrderDuplicateIgnored, o.OrderUID, domain.OrderDuplicateIgnoredData{OrderID: orderID})
+			if err != nil {
+				return err
+			}
+			if err := insertOutbox(ctx, p.pool, ev); err != nil {
+				logger.Warn("outbox insert failed", "err", err, "type", ev.Type)
+				return err
+			}
+			return ErrOrderAlreadyExists
+		}
+		logger.Warn("insert into wb.order_keys failed")
+		return err
+	}
 
 	//Start with ordersTable
-	var orderID uuid.UUID
-	err = tx.QueryRow(ctx,
+	_, err = tx.Exec(ctx,
 		`INSERT INTO wb.orders 
-    			(order_uid, track_number, entry, locale, internal_signature, customer_id,
-			 	delivery_service, shardkey, sm_id, date_created, oof_shard, payload)
+    			(id, order_uid, track_number, entry, locale, internal_signature, customer_id,
+			 	delivery_service, shardkey, sm_id, date_created, oof_shard, payload, payload_version, tenant_id)
 			 VALUES
-			     ($1, $2, $3, $4, $5, $6,
-			 		$7, $8, $9, $10, $11, $12)
-			RETURNING id
-			`, o.OrderUID,
+			     ($1, $2, $3, $4, $5, $6, $7,
+			 		$8, $9, $10, $11, $12, $13, $14, $15)
+			`, orderID,
+		o.OrderUID,
 		o.TrackNumber,
 		o.Entry,
 		o.Locale,
@@ -73,43 +198,36 @@ func (p *OrderRepository) AddOrder(ctx context.Context, o *domain.Order) error {
 		o.DeliveryService,
 		o.Shardkey,
 		o.SMID,
-		o.DateCreated, // timestamptz в схеме
+		o.DateCreated, // timestamptz в схеме, ключ партиционирования
 		o.OofShard,
 		payload,
-	).Scan(&orderID)
-
+		o.SchemaVersion,
+		o.Tenant,
+	)
 	if err != nil {
-		//обрабатываем уникальное нарушение по order_uid
-		var pgErr *pgconn.PgError
-		// 23505 код для обозначение дупликата
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			// Заказ уже есть — достанем его id, чтобы вызвать позже кэширование
-			if err2 := p.pool.QueryRow(ctx,
-				`SELECT id FROM wb.orders WHERE order_uid = $1`, o.OrderUID,
-			).Scan(&orderID); err2 == nil {
-				o.OrderID = orderID
-				return ErrOrderAlreadyExists
-			}
-			return ErrOrderAlreadyExists
-		}
-
 		logger.Warn("insert into wb.orders failed")
 		return err
 	}
 
 	//Working with delivery-table
 	_, err = tx.Exec(ctx,
-		`INSERT INTO wb.delivery (order_id, name, phone, zip, city, address, region, email)
+		`INSERT INTO wb.delivery (order_id, tenant_id, date_created, name, phone, zip, city, address, region, email,
+			                          pii_key_id, phone_bidx, email_bidx)
 			 VALUES
-			     ($1, $2, $3, $4, $5, $6, $7, $8)
+			     ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 			`, orderID,
-		o.Delivery.Name,
-		o.Delivery.Phone,
-		o.Delivery.Zip,
-		o.Delivery.City,
-		o.Delivery.Address,
-		o.Delivery.Region,
-		o.Delivery.Email,
+		o.Tenant,
+		o.DateCreated,
+		sealed.Name,
+		sealed.Phone,
+		sealed.Zip,
+		sealed.City,
+		sealed.Address,
+		sealed.Region,
+		sealed.Email,
+		keyID,
+		nullable(p.pii.BlindIndex(pii.IndexPhone, o.Delivery.Phone)),
+		nullable(p.pii.BlindIndex(pii.IndexEmail, o.Delivery.Email)),
 	)
 
 	if err != nil {
@@ -121,13 +239,15 @@ func (p *OrderRepository) AddOrder(ctx context.Context, o *domain.Order) error {
 	pay := o.Payment
 	_, err = tx.Exec(ctx, `
 		INSERT INTO wb.payment
-			(order_id, transaction, request_id, currency, provider,
+			(order_id, tenant_id, date_created, transaction, request_id, currency, provider,
 			 amount_cents, payment_dt, bank, delivery_cost_cents, goods_total_cents, custom_fee_cents)
 		VALUES
-			($1, $2, $3, $4, $5,
-			 $6, $7, $8, $9, $10, $11)
+			($1, $2, $3, $4, $5, $6, $7,
+			 $8, $9, $10, $11, $12, $13)
 	`,
 		orderID,
+		o.Tenant,
+		o.DateCreated,
 		pay.Transaction,
 		pay.RequestID,
 		pay.Currency,
@@ -149,11 +269,13 @@ func (p *OrderRepository) AddOrder(ctx context.Context, o *domain.Order) error {
 		for _, it := range o.Items {
 			batch.Queue(`
 				INSERT INTO wb.items
-					(order_id, chrt_id, track_number, price_cents, rid, name, sale, size, total_price_cents, nm_id, brand, status)
+					(order_id, tenant_id, date_created, chrt_id, track_number, price_cents, rid, name, sale, size, total_price_cents, nm_id, brand, status)
 				VALUES
-					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 			`,
 				orderID,
+				o.Tenant,
+				o.DateCreated,
 				it.ChrtID,
 				it.TrackNumber,
 				it.Price,
@@ -173,21 +295,50 @@ func (p *OrderRepository) AddOrder(ctx context.Context, o *domain.Order) error {
 		}
 	}
 
+	if err = snapshotOrder(ctx, tx, orderID, o.DateCreated, HistoryCreate); err != nil {
+		return err
+	}
+
+	// событие в той же транзакции: откатился заказ — откатилось и событие.
+	// В outbox и orders.events — та же зашифрованная доставка, что в payload
+	o.OrderID = orderID
+	stored.OrderID = orderID
+	ev, err := domain.NewEvent(domain.EventOrderCreated, o.OrderUID, domain.OrderCreatedData{Order: &stored})
+	if err != nil {
+		return err
+	}
+	if err = insertOutbox(ctx, tx, ev); err != nil {
+		logger.Warn("outbox insert failed", "err", err, "type", ev.Type)
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		logger.Warn("Error while commiting tx")
+		o.OrderID = uuid.Nil
 		return err
 	}
 	tx = nil
-	o.OrderID = orderID
 	return nil
 }
 
-func (p *OrderRepository) GetOrderById(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+// GetOrderById — заказ тенанта по id; чужой RLS не покажет
+func (p *OrderRepository) GetOrderById(ctx context.Context, tenant string, id uuid.UUID) (*domain.Order, error) {
+	var order *domain.Order
+	err := p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		var err error
+		order, err = p.getOrder(ctx, tx, id)
+		return err
+	})
+	return order, err
+}
+
+// getOrder собирает заказ из таблиц; nil — не нашёлся. Доставка отдаётся расшифрованной
+func (p *OrderRepository) getOrder(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*domain.Order, error) {
 	order := &domain.Order{}
-	err := p.pool.QueryRow(ctx,
+	err := tx.QueryRow(ctx,
 		`
 		  SELECT order_uid, track_number, entry, locale, internal_signature,
-				 customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+				 customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, tenant_id
 		  FROM wb.orders WHERE id = $1
 		`, id).Scan(
 		&order.OrderUID,
@@ -201,6 +352,7 @@ func (p *OrderRepository) GetOrderById(ctx context.Context, id uuid.UUID) (*doma
 		&order.SMID,
 		&order.DateCreated,
 		&order.OofShard,
+		&order.Tenant,
 	)
 	if err != nil {
 		logger.Warn("Error while geting data from wb.orders")
@@ -210,7 +362,7 @@ func (p *OrderRepository) GetOrderById(ctx context.Context, id uuid.UUID) (*doma
 		return nil, err
 	}
 
-	err = p.pool.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		SELECT
 		  name, phone, zip, city, address, region, email
 		FROM wb.delivery
@@ -229,8 +381,11 @@ func (p *OrderRepository) GetOrderById(ctx context.Context, id uuid.UUID) (*doma
 			return nil, err
 		}
 	}
+	if order.Delivery, err = p.pii.OpenDelivery(ctx, order.Delivery); err != nil {
+		return nil, err
+	}
 
-	err = p.pool.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		SELECT
 		  transaction, request_id, currency, provider,
 		  amount_cents, payment_dt, bank,
@@ -255,7 +410,7 @@ func (p *OrderRepository) GetOrderById(ctx context.Context, id uuid.UUID) (*doma
 		}
 	}
 
-	rows, err := p.pool.Query(ctx, `
+	rows, err := tx.Query(ctx, `
 		SELECT
 		  chrt_id, track_number, price_cents, rid, name, sale, size, total_price_cents, nm_id, brand, status
 		FROM wb.items
@@ -293,57 +448,78 @@ func (p *OrderRepository) GetOrderById(ctx context.Context, id uuid.UUID) (*doma
 	}
 	order.Items = items
 	order.OrderID = id
+	// собран из таблиц, а не из payload — значит, в текущей форме
+	order.SchemaVersion = domain.OrderSchemaVersion
 
 	return order, nil
 }
 
-func (p *OrderRepository) GetOrderByUID(ctx context.Context, uid string) (*domain.Order, error) {
-	var id uuid.UUID
-	err := p.pool.QueryRow(ctx, `SELECT id FROM wb.orders WHERE order_uid = $1`, uid).Scan(&id)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
+// GetOrderByUID — заказ тенанта; чужой заказ с тем же uid не находится
+func (p *OrderRepository) GetOrderByUID(ctx context.Context, tenant, uid string) (*domain.Order, error) {
+	var order *domain.Order
+	err := p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		var id uuid.UUID
+		err := tx.QueryRow(ctx, `SELECT order_id FROM wb.order_keys WHERE tenant_id = $1 AND order_uid = $2`, tenant, uid).Scan(&id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return err
 		}
-		return nil, err
-	}
-	return p.GetOrderById(ctx, id)
+		order, err = p.getOrder(ctx, tx, id)
+		return err
+	})
+	return order, err
 }
 
 func (p *OrderRepository) ListRecentPayloads(ctx context.Context, limit int) ([]struct {
 	ID      uuid.UUID
+	Tenant  string
 	Payload []byte
 },
 	error,
 ) {
-	rows, err := p.pool.Query(ctx,
-		`SELECT id, payload
+	var out []struct {
+		ID      uuid.UUID
+		Tenant  string
+		Payload []byte
+	}
+	// кэш общий на все тенанты, он сам раскладывает заказы по ним
+	err := p.inTenant(ctx, AllTenants, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx,
+			`SELECT id, tenant_id, payload
 			FROM wb.orders
 			ORDER BY created_at DESC
 			LIMIT $1
 			`, limit)
-	if err != nil {
-		logger.Warn("Error at gettings cache from db")
-		return nil, err
-	}
-	defer rows.Close()
+		if err != nil {
+			logger.Warn("Error at gettings cache from db")
+			return err
+		}
+		defer rows.Close()
 
-	var out []struct {
-		ID      uuid.UUID
-		Payload []byte
-	}
-	for rows.Next() {
-		var id uuid.UUID
-		var payload []byte
-		if err := rows.Scan(&id, &payload); err != nil {
-			return nil, err
+		for rows.Next() {
+			var id uuid.UUID
+			var tenant string
+			var payload []byte
+			if err := rows.Scan(&id, &tenant, &payload); err != nil {
+				return err
+			}
+			if payload, err = p.openPayload(ctx, payload); err != nil {
+				// без ключа payload не прочитать; кэш возьмёт заказ из таблиц — или пропустит его
+				logger.Warn("decrypt payload failed", "err", err, "id", id)
+				payload = nil
+			}
+			out = append(out, struct {
+				ID      uuid.UUID
+				Tenant  string
+				Payload []byte
+			}{ID: id, Tenant: tenant, Payload: payload})
 		}
-		out = append(out, struct {
-			ID      uuid.UUID
-			Payload []byte
-		}{ID: id, Payload: payload})
-	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 	return out, nil
 }
@@ -357,30 +533,175 @@ type OrderBrief struct {
 	AmountCents *int      `json:"amount_cents"`
 }
 
-func (p *OrderRepository) ListOrdersBrief(ctx context.Context, limit, offset int) ([]OrderBrief, error) {
-	rows, err := p.pool.Query(ctx, `
-		SELECT o.id, o.order_uid, o.track_number, o.customer_id, o.date_created,
-		       pay.amount_cents
-		FROM wb.orders o
-		LEFT JOIN wb.payment pay ON pay.order_id = o.id
-		ORDER BY o.created_at DESC
-		LIMIT $1 OFFSET $2
-	`, limit, offset)
+func (p *OrderRepository) ListOrdersBrief(ctx context.Context, tenant string, limit, offset int) ([]OrderBrief, error) {
+	var out []OrderBrief
+	err := p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT o.id, o.order_uid, o.track_number, o.customer_id, o.date_created,
+			       pay.amount_cents
+			FROM wb.orders o
+			LEFT JOIN wb.payment pay ON pay.order_id = o.id AND pay.date_created = o.date_created
+			WHERE o.tenant_id = $1
+			ORDER BY o.created_at DESC
+			LIMIT $2 OFFSET $3
+		`, tenant, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r OrderBrief
+			if err := rows.Scan(&r.ID, &r.OrderUID, &r.TrackNumber, &r.CustomerID, &r.DateCreated, &r.AmountCents); err != nil {
+				return err
+			}
+			out = append(out, r)
+		}
+		return rows.Err()
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return out, nil
+}
 
-	var out []OrderBrief
-	for rows.Next() {
-		var r OrderBrief
-		if err := rows.Scan(&r.ID, &r.OrderUID, &r.TrackNumber, &r.CustomerID, &r.DateCreated, &r.AmountCents); err != nil {
-			return nil, err
+// UpdateItemsStatus проставляет статус всем позициям заказа — и в wb.items, и в payload,
+// чтобы кэш, восстановленный из payload, не расходился с таблицами
+func (p *OrderRepository) UpdateItemsStatus(ctx context.Context, tenant, uid string, status int) error {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = setTenant(ctx, tx, tenant); err != nil {
+		return err
+	}
+
+	var (
+		orderID uuid.UUID
+		created time.Time
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT id, date_created FROM wb.orders WHERE tenant_id = $1 AND order_uid = $2 FOR UPDATE`, tenant, uid,
+	).Scan(&orderID, &created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrNotFound
 		}
-		out = append(out, r)
+		return err
 	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
+
+	// date_created в условиях — чтобы трогать одну партицию, а не все
+	if _, err = tx.Exec(ctx, `UPDATE wb.items SET status = $2 WHERE order_id = $1 AND date_created = $3`, orderID, status, created); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE wb.orders
+		SET payload = jsonb_set(payload, '{items}', (
+			SELECT coalesce(jsonb_agg(jsonb_set(it, '{status}', to_jsonb($2::int))), '[]'::jsonb)
+			FROM jsonb_array_elements(payload->'items') it
+		))
+		WHERE id = $1 AND date_created = $3 AND jsonb_typeof(payload->'items') = 'array'
+	`, orderID, status, created)
+	if err != nil {
+		logger.Warn("update payload items status failed")
+		return err
+	}
+	if err = snapshotOrder(ctx, tx, orderID, created, HistoryStatusChange); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpgradePayloads переписывает payload, сохранённые в старых версиях, в текущую.
+// Идёт пачками по batch строк, каждая пачка — своя транзакция, так что прерванный
+// прогон просто продолжится с того же места. dryRun только считает, что поменялось бы.
+// Возвращает число переписанных и число битых (не разобрались, оставлены как есть) payload.
+// Новой версии в истории не пишет: содержание заказа то же, см. HistoryCreate.
+func (p *OrderRepository) UpgradePayloads(ctx context.Context, batch int, dryRun bool) (upgraded, broken int, err error) {
+	var afterID uuid.UUID
+	for {
+		tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+		if err != nil {
+			return upgraded, broken, err
+		}
+		if err := setTenant(ctx, tx, AllTenants); err != nil {
+			tx.Rollback(ctx)
+			return upgraded, broken, err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT id, payload, payload_version
+			FROM wb.orders
+			WHERE payload_version < $1 AND id > $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		`, domain.OrderSchemaVersion, afterID, batch)
+		if err != nil {
+			tx.Rollback(ctx)
+			return upgraded, broken, err
+		}
+		type row struct {
+			id      uuid.UUID
+			payload []byte
+			version int
+		}
+		var page []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.payload, &r.version); err != nil {
+				rows.Close()
+				tx.Rollback(ctx)
+				return upgraded, broken, err
+			}
+			page = append(page, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			tx.Rollback(ctx)
+			return upgraded, broken, err
+		}
+		if len(page) == 0 {
+			tx.Rollback(ctx)
+			return upgraded, broken, nil
+		}
+
+		for _, r := range page {
+			afterID = r.id
+			o, err := domain.DecodeOrder(r.payload, r.version, false)
+			if err != nil {
+				logger.Warn("payload upgrade: cannot decode, skip", "err", err, "id", r.id, "version", r.version)
+				broken++
+				continue
+			}
+			o.OrderID = uuid.Nil
+			o.SchemaVersion = domain.OrderSchemaVersion
+			out, err := json.Marshal(o)
+			if err != nil {
+				tx.Rollback(ctx)
+				return upgraded, broken, err
+			}
+			if !dryRun {
+				if _, err := tx.Exec(ctx,
+					`UPDATE wb.orders SET payload = $2, payload_version = $3 WHERE id = $1`,
+					r.id, out, domain.OrderSchemaVersion,
+				); err != nil {
+					tx.Rollback(ctx)
+					return upgraded, broken, err
+				}
+			}
+			upgraded++
+		}
+
+		if dryRun {
+			tx.Rollback(ctx)
+			continue
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return upgraded, broken, err
+		}
 	}
-	return out, nil
 }
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OutboxRecord — неопубликованное событие вместе с готовым телом сообщения
+type OutboxRecord struct {
+	ID       int64
+	Type     string
+	Version  int
+	OrderUID string
+	EventID  string
+	Payload  []byte
+}
+
+// execer — общий знаменатель pool и tx, чтобы писать в outbox из транзакции заказа
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertOutbox(ctx context.Context, q execer, ev domain.Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO wb.outbox (event_id, event_type, event_version, order_uid, payload)
+		VALUES ($1, $2, $3, $4, $5)
+	`, ev.ID, ev.Type, ev.Version, ev.OrderUID, payload)
+	return err
+}
+
+type OutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepository(p *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{pool: p}
+}
+
+// Add — событие без сопутствующей записи заказа (например, OrderRejected)
+func (p *OutboxRepository) Add(ctx context.Context, ev domain.Event) error {
+	return insertOutbox(ctx, p.pool, ev)
+}
+
+// PublishBatch берёт пачку неопубликованных событий под блокировкой, отдаёт их в publish
+// и помечает опубликованными только если publish вернул nil. Так событие не теряется
+// при падении между отправкой и коммитом — в худшем случае уйдёт повторно (at-least-once).
+func (p *OutboxRepository) PublishBatch(ctx context.Context, limit int, publish func([]OutboxRecord) error) (int, error) {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// SKIP LOCKED — несколько инстансов не дерутся за одни и те же строки
+	rows, err := tx.Query(ctx, `
+		SELECT id, event_type, event_version, order_uid, event_id::text, payload
+		FROM wb.outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var batch []OutboxRecord
+	for rows.Next() {
+		var r OutboxRecord
+		if err := rows.Scan(&r.ID, &r.Type, &r.Version, &r.OrderUID, &r.EventID, &r.Payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int64, len(batch))
+	for i, r := range batch {
+		ids[i] = r.ID
+	}
+	if _, err := tx.Exec(ctx, `UPDATE wb.outbox SET published_at = now() WHERE id = ANY($1)`, ids); err != nil {
+		return 0, err
+	}
+	return len(batch), tx.Commit(ctx)
+}
+
+// DeletePublished чистит опубликованные события старше retention
+func (p *OutboxRepository) DeletePublished(ctx context.Context, retention time.Duration) (int64, error) {
+	tag, err := p.pool.Exec(ctx,
+		`DELETE FROM wb.outbox WHERE published_at IS NOT NULL AND published_at < $1`,
+		time.Now().Add(-retention),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// partitionedTables — таблицы заказа, порезанные по месяцам. Порядок важен при отцеплении:
+// сначала ссылающиеся, потом wb.orders, иначе внешние ключи не дадут отцепить месяц
+var partitionedTables = []string{"items", "payment", "delivery", "orders"}
+
+// ArchiveSchema — куда переезжают отцепленные партиции в режиме archive
+const ArchiveSchema = "wb_archive"
+
+// PartitionRepository ведёт помесячные партиции wb.orders и её дочерних таблиц,
+// см. миграцию orders_partitioning
+type PartitionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPartitionRepository(p *pgxpool.Pool) *PartitionRepository {
+	return &PartitionRepository{pool: p}
+}
+
+// monthStart — начало месяца t по UTC, границы партиций считаются так же
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// EnsureMonths создаёт недостающие партиции месяцев с from по to включительно
+func (p *PartitionRepository) EnsureMonths(ctx context.Context, from, to time.Time) error {
+	for m := monthStart(from); !m.After(to); m = m.AddDate(0, 1, 0) {
+		if _, err := p.pool.Exec(ctx, `SELECT wb.ensure_order_partitions($1)`, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Months — месяцы, под которые у wb.orders есть партиции, по возрастанию
+func (p *PartitionRepository) Months(ctx context.Context) ([]time.Time, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class parent ON parent.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = parent.relnamespace
+		WHERE n.nspname = 'wb' AND parent.relname = 'orders'
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []time.Time
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		// партиции, заведённые руками под другим именем, не наши — их не трогаем
+		m, err := time.Parse("2006_01", strings.TrimPrefix(name, "orders_"))
+		if err != nil {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// RetireMonth отцепляет месяц от всех таблиц заказа одной транзакцией: archive — переносит
+// партиции в ArchiveSchema (orders_2025_01 и т.д., при совпадении имени с суффиксом времени),
+// иначе удаляет. Ключи и история заказов месяца (wb.order_keys, wb.order_history) удаляются в обоих случаях.
+func (p *PartitionRepository) RetireMonth(ctx context.Context, month time.Time, archive bool) error {
+	month = monthStart(month)
+	suffix := month.Format("2006_01")
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := setTenant(ctx, tx, AllTenants); err != nil {
+		return err
+	}
+
+	for _, t := range partitionedTables {
+		name := t + "_" + suffix
+		part := pgx.Identifier{"wb", name}.Sanitize()
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, "wb."+name).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `ALTER TABLE `+pgx.Identifier{"wb", t}.Sanitize()+` DETACH PARTITION `+part); err != nil {
+			return err
+		}
+		if !archive {
+			if _, err := tx.Exec(ctx, `DROP TABLE `+part); err != nil {
+				return err
+			}
+			continue
+		}
+		// месяц уже архивировали раньше (в него потом пришёл запоздавший заказ) — не затираем
+		var taken bool
+		if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, ArchiveSchema+"."+name).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			renamed := name + "_" + time.Now().UTC().Format("20060102150405")
+			if _, err := tx.Exec(ctx, `ALTER TABLE `+part+` RENAME TO `+pgx.Identifier{renamed}.Sanitize()); err != nil {
+				return err
+			}
+			part = pgx.Identifier{"wb", renamed}.Sanitize()
+		}
+		if _, err := tx.Exec(ctx, `ALTER TABLE `+part+` SET SCHEMA `+pgx.Identifier{ArchiveSchema}.Sanitize()); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range []string{"order_keys", "order_history"} {
+		if _, err := tx.Exec(ctx,
+			`DELETE FROM `+pgx.Identifier{"wb", t}.Sanitize()+` WHERE date_created >= $1 AND date_created < $2`,
+			month, month.AddDate(0, 1, 0),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
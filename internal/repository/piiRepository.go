@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/pii"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// piiFields — зашифрованные поля доставки и в wb.delivery, и в payload
+var piiFields = []string{"phone", "email", "address"}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// mapPayloadDelivery применяет fn к персональным полям delivery в payload. Payload бывают
+// разных версий, поэтому разбираем как есть, а не через domain.Order
+func mapPayloadDelivery(payload []byte, fn func(string) (string, error)) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, err
+	}
+	raw, ok := doc["delivery"]
+	if !ok {
+		return payload, nil
+	}
+	var d map[string]any
+	if err := json.Unmarshal(raw, &d); err != nil || d == nil {
+		return payload, nil
+	}
+	for _, f := range piiFields {
+		s, ok := d[f].(string)
+		if !ok {
+			continue
+		}
+		v, err := fn(s)
+		if err != nil {
+			return nil, err
+		}
+		d[f] = v
+	}
+	out, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	doc["delivery"] = out
+	return json.Marshal(doc)
+}
+
+// openPayload — payload с расшифрованной доставкой; без зашифрованных полей — тот же срез
+func (p *OrderRepository) openPayload(ctx context.Context, payload []byte) ([]byte, error) {
+	if len(payload) == 0 || !json.Valid(payload) || !containsSealed(payload) {
+		return payload, nil
+	}
+	return mapPayloadDelivery(payload, func(s string) (string, error) { return p.pii.Open(ctx, s) })
+}
+
+func containsSealed(payload []byte) bool {
+	var probe struct {
+		Delivery map[string]any `json:"delivery"`
+	}
+	if json.Unmarshal(payload, &probe) != nil {
+		return false
+	}
+	for _, f := range piiFields {
+		if s, ok := probe.Delivery[f].(string); ok && pii.Sealed(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RotatePII перешифровывает текущим ключом до batch доставок, зашифрованных старым ключом
+// или записанных открытым текстом, вместе с payload их заказов. Возвращает, сколько строк
+// обработано; 0 — всё уже под текущим ключом. Прошлые версии заказа перешифровываются на месте,
+// новой версии в истории нет — см. HistoryCreate
+func (p *OrderRepository) RotatePII(ctx context.Context, batch int) (int, error) {
+	if p.pii == nil {
+		return 0, nil
+	}
+	current := p.pii.CurrentKeyID()
+	n := 0
+	err := p.inTenant(ctx, AllTenants, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT order_id, date_created, phone, email, address
+			FROM wb.delivery
+			WHERE pii_key_id IS DISTINCT FROM $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, current, batch)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			orderID uuid.UUID
+			created time.Time
+			d       domain.DeliveryData
+		}
+		var page []row
+		for rows.Next() {
+			var r row
+			var phone, email, address *string
+			if err := rows.Scan(&r.orderID, &r.created, &phone, &email, &address); err != nil {
+				rows.Close()
+				return err
+			}
+			r.d.Phone, r.d.Email, r.d.Address = deref(phone), deref(email), deref(address)
+			page = append(page, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range page {
+			plain, err := p.pii.OpenDelivery(ctx, r.d)
+			if err != nil {
+				return err
+			}
+			sealed, err := p.pii.SealDelivery(ctx, plain)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `
+				UPDATE wb.delivery
+				SET phone = $3, email = $4, address = $5, pii_key_id = $6, phone_bidx = $7, email_bidx = $8
+				WHERE order_id = $1 AND date_created = $2
+			`, r.orderID, r.created, sealed.Phone, sealed.Email, sealed.Address, current,
+				nullable(p.pii.BlindIndex(pii.IndexPhone, plain.Phone)),
+				nullable(p.pii.BlindIndex(pii.IndexEmail, plain.Email)),
+			); err != nil {
+				return err
+			}
+
+			var payload []byte
+			err = tx.QueryRow(ctx,
+				`SELECT payload FROM wb.orders WHERE id = $1 AND date_created = $2 FOR UPDATE`, r.orderID, r.created,
+			).Scan(&payload)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+			if len(payload) > 0 {
+				out, err := mapPayloadDelivery(payload, func(s string) (string, error) {
+					v, err := p.pii.Open(ctx, s)
+					if err != nil {
+						return "", err
+					}
+					return p.pii.Seal(ctx, v)
+				})
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx,
+					`UPDATE wb.orders SET payload = $3 WHERE id = $1 AND date_created = $2`, r.orderID, r.created, out,
+				); err != nil {
+					return err
+				}
+			}
+			if err := p.rotateHistory(ctx, tx, r.orderID); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// rotateHistory перешифровывает текущим ключом доставку во всех версиях заказа:
+// иначе после вывода старого ключа прошлые версии не открыть
+func (p *OrderRepository) rotateHistory(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) error {
+	rows, err := tx.Query(ctx,
+		`SELECT tenant_id, order_uid, version, snapshot FROM wb.order_history WHERE order_id = $1 FOR UPDATE`, orderID,
+	)
+	if err != nil {
+		return err
+	}
+	type version struct {
+		tenant, uid string
+		n           int
+		snapshot    []byte
+	}
+	var versions []version
+	for rows.Next() {
+		var v version
+		if err := rows.Scan(&v.tenant, &v.uid, &v.n, &v.snapshot); err != nil {
+			rows.Close()
+			return err
+		}
+		versions = append(versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		out, err := mapPayloadDelivery(v.snapshot, func(s string) (string, error) {
+			plain, err := p.pii.Open(ctx, s)
+			if err != nil {
+				return "", err
+			}
+			return p.pii.Seal(ctx, plain)
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE wb.order_history SET snapshot = $4 WHERE tenant_id = $1 AND order_uid = $2 AND version = $3`,
+			v.tenant, v.uid, v.n, out,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ListOrdersByContact — заказы тенанта с телефоном или email доставки (kind — pii.IndexPhone
+// или pii.IndexEmail). При шифровании ищем по слепому индексу, без него — по открытым колонкам
+func (p *OrderRepository) ListOrdersByContact(ctx context.Context, tenant, kind, value string, limit, offset int) ([]OrderBrief, error) {
+	cond := `d.phone_bidx = $2`
+	arg := p.pii.BlindIndex(kind, value)
+	switch {
+	case p.pii == nil && kind == pii.IndexPhone:
+		cond, arg = `regexp_replace(d.phone, '\D', '', 'g') = $2`, pii.Normalize(kind, value)
+	case p.pii == nil:
+		cond, arg = `lower(trim(d.email)) = $2`, pii.Normalize(kind, value)
+	case kind == pii.IndexEmail:
+		cond = `d.email_bidx = $2`
+	}
+	if arg == "" {
+		return []OrderBrief{}, nil
+	}
+
+	out := []OrderBrief{}
+	err := p.inTenant(ctx, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT o.id, o.order_uid, o.track_number, o.customer_id, o.date_created,
+			       pay.amount_cents
+			FROM wb.delivery d
+			JOIN wb.orders o ON o.id = d.order_id AND o.date_created = d.date_created
+			LEFT JOIN wb.payment pay ON pay.order_id = o.id AND pay.date_created = o.date_created
+			WHERE d.tenant_id = $1 AND `+cond+`
+			ORDER BY o.created_at DESC
+			LIMIT $3 OFFSET $4
+		`, tenant, arg, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r OrderBrief
+			if err := rows.Scan(&r.ID, &r.OrderUID, &r.TrackNumber, &r.CustomerID, &r.DateCreated, &r.AmountCents); err != nil {
+				return err
+			}
+			out = append(out, r)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WebhookSubscription struct {
+	ID                  uuid.UUID `json:"id"`
+	Tenant              string    `json:"tenant_id"`
+	URL                 string    `json:"url"`
+	Events              []string  `json:"events"`
+	Secret              string    `json:"-"`
+	Description         string    `json:"description"`
+	Enabled             bool      `json:"enabled"`
+	DisabledReason      *string   `json:"disabled_reason,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// WebhookPatch — частичное обновление подписки, nil = не трогать
+type WebhookPatch struct {
+	URL         *string
+	Events      *[]string
+	Secret      *string
+	Description *string
+	Enabled     *bool
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID uuid.UUID  `json:"subscription_id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	State          string     `json:"state"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookJob — доставка, взятая воркером в работу, вместе с адресом и секретом подписчика
+type WebhookJob struct {
+	WebhookDelivery
+	URL     string
+	Secret  string
+	Payload []byte
+}
+
+const subscriptionColumns = `id, tenant_id, url, events, secret, description, enabled, disabled_reason, consecutive_failures, created_at, updated_at`
+
+type WebhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookRepository(p *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{pool: p}
+}
+
+func scanSubscription(row pgx.Row) (*WebhookSubscription, error) {
+	var s WebhookSubscription
+	err := row.Scan(&s.ID, &s.Tenant, &s.URL, &s.Events, &s.Secret, &s.Description, &s.Enabled,
+		&s.DisabledReason, &s.ConsecutiveFailures, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// subscriptionOf — одна подписка из запроса в транзакции тенанта
+func (p *WebhookRepository) subscriptionOf(ctx context.Context, tenant, sql string, args ...any) (*WebhookSubscription, error) {
+	var s *WebhookSubscription
+	err := inTenant(ctx, p.pool, tenant, func(tx pgx.Tx) error {
+		var err error
+		s, err = scanSubscription(tx.QueryRow(ctx, sql, args...))
+		return err
+	})
+	return s, err
+}
+
+// Подписки и их доставки видны только своему тенанту: и условием в запросе, и RLS
+
+func (p *WebhookRepository) CreateSubscription(ctx context.Context, tenant string, s *WebhookSubscription) (*WebhookSubscription, error) {
+	return p.subscriptionOf(ctx, tenant, `
+		INSERT INTO wb.webhook_subscriptions (tenant_id, url, events, secret, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+subscriptionColumns,
+		tenant, s.URL, s.Events, s.Secret, s.Description,
+	)
+}
+
+func (p *WebhookRepository) GetSubscription(ctx context.Context, tenant string, id uuid.UUID) (*WebhookSubscription, error) {
+	return p.subscriptionOf(ctx, tenant,
+		`SELECT `+subscriptionColumns+` FROM wb.webhook_subscriptions WHERE tenant_id = $1 AND id = $2`, tenant, id)
+}
+
+func (p *WebhookRepository) ListSubscriptions(ctx context.Context, tenant string) ([]WebhookSubscription, error) {
+	out := make([]WebhookSubscription, 0)
+	err := inTenant(ctx, p.pool, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx,
+			`SELECT `+subscriptionColumns+` FROM wb.webhook_subscriptions WHERE tenant_id = $1 ORDER BY created_at`, tenant)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			s, err := scanSubscription(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, *s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateSubscription применяет патч. Включение подписки сбрасывает счётчик ошибок.
+func (p *WebhookRepository) UpdateSubscription(ctx context.Context, tenant string, id uuid.UUID, patch WebhookPatch) (*WebhookSubscription, error) {
+	var events []string
+	if patch.Events != nil {
+		events = *patch.Events
+	}
+	return p.subscriptionOf(ctx, tenant, `
+		UPDATE wb.webhook_subscriptions SET
+			url                  = COALESCE($2, url),
+			events               = CASE WHEN $3 THEN $4::text[] ELSE events END,
+			secret               = COALESCE($5, secret),
+			description          = COALESCE($6, description),
+			enabled              = COALESCE($7, enabled),
+			disabled_reason      = CASE WHEN $7 IS TRUE THEN NULL ELSE disabled_reason END,
+			consecutive_failures = CASE WHEN $7 IS TRUE THEN 0 ELSE consecutive_failures END,
+			updated_at           = now()
+		WHERE id = $1 AND tenant_id = $8
+		RETURNING `+subscriptionColumns,
+		id, patch.URL, patch.Events != nil, events, patch.Secret, patch.Description, patch.Enabled, tenant,
+	)
+}
+
+func (p *WebhookRepository) DeleteSubscription(ctx context.Context, tenant string, id uuid.UUID) error {
+	return inTenant(ctx, p.pool, tenant, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM wb.webhook_subscriptions WHERE tenant_id = $1 AND id = $2`, tenant, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// EnqueueEvent ставит событие заказа тенанта в очередь включённым подписчикам этого тенанта,
+// которым оно интересно
+func (p *WebhookRepository) EnqueueEvent(ctx context.Context, tenant string, eventID uuid.UUID, eventType string, payload []byte) (int64, error) {
+	var n int64
+	err := inTenant(ctx, p.pool, tenant, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO wb.webhook_deliveries (subscription_id, tenant_id, event_id, event_type, payload)
+			SELECT id, tenant_id, $2, $3, $4
+			FROM wb.webhook_subscriptions
+			WHERE tenant_id = $1 AND enabled AND (cardinality(events) = 0 OR $3 = ANY(events))
+		`, tenant, eventID, eventType, payload)
+		n = tag.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// ClaimDue забирает созревшие доставки и сдвигает им next_attempt_at на lease,
+// чтобы параллельный воркер (или другой инстанс) не взял их повторно.
+// Упавший посреди доставки воркер просто отдаст их обратно по истечении lease.
+// Диспетчер общий на все тенанты, поэтому ходит под AllTenants.
+func (p *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]WebhookJob, error) {
+	var out []WebhookJob
+	err := inTenant(ctx, p.pool, AllTenants, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			WITH due AS (
+				SELECT d.id
+				FROM wb.webhook_deliveries d
+				JOIN wb.webhook_subscriptions s ON s.id = d.subscription_id
+				WHERE d.state = 'pending' AND d.next_attempt_at <= now() AND s.enabled
+				ORDER BY d.next_attempt_at
+				LIMIT $1
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			UPDATE wb.webhook_deliveries d
+			SET next_attempt_at = now() + $2::interval
+			FROM due, wb.webhook_subscriptions s
+			WHERE d.id = due.id AND s.id = d.subscription_id
+			RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.state, d.attempts,
+			          d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at,
+			          s.url, s.secret, d.payload
+		`, limit, lease)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var j WebhookJob
+			if err := rows.Scan(&j.ID, &j.SubscriptionID, &j.EventID, &j.EventType, &j.State, &j.Attempts,
+				&j.NextAttemptAt, &j.LastStatusCode, &j.LastError, &j.CreatedAt, &j.DeliveredAt,
+				&j.URL, &j.Secret, &j.Payload); err != nil {
+				return err
+			}
+			out = append(out, j)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MarkDelivered закрывает доставку и обнуляет счётчик ошибок подписчика
+func (p *WebhookRepository) MarkDelivered(ctx context.Context, j *WebhookJob, status int) error {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := setTenant(ctx, tx, AllTenants); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE wb.webhook_deliveries
+		SET state = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now()
+		WHERE id = $1
+	`, j.ID, status); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE wb.webhook_subscriptions SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures <> 0`,
+		j.SubscriptionID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// MarkFailed фиксирует неудачную попытку. nextAt == nil — доставка больше не повторяется.
+// Если у подписчика набралось disableAfter ошибок подряд, он выключается; true — выключили именно сейчас.
+func (p *WebhookRepository) MarkFailed(ctx context.Context, j *WebhookJob, status *int, errText string, nextAt *time.Time, disableAfter int) (bool, error) {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	if err := setTenant(ctx, tx, AllTenants); err != nil {
+		return false, err
+	}
+
+	state := "pending"
+	next := time.Now()
+	if nextAt == nil {
+		state = "failed"
+	} else {
+		next = *nextAt
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE wb.webhook_deliveries
+		SET state = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4, next_attempt_at = $5
+		WHERE id = $1
+	`, j.ID, state, status, errText, next); err != nil {
+		return false, err
+	}
+
+	var disabled bool
+	if err := tx.QueryRow(ctx, `
+		UPDATE wb.webhook_subscriptions SET
+			consecutive_failures = consecutive_failures + 1,
+			enabled         = enabled AND consecutive_failures + 1 < $2,
+			disabled_reason = CASE WHEN enabled AND consecutive_failures + 1 >= $2
+			                       THEN 'too many consecutive delivery failures' ELSE disabled_reason END,
+			updated_at      = now()
+		WHERE id = $1
+		RETURNING NOT enabled AND consecutive_failures = $2
+	`, j.SubscriptionID, disableAfter).Scan(&disabled); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+	return disabled, tx.Commit(ctx)
+}
+
+// ListDeliveries — журнал доставок подписчика, свежие сверху; state пустой — все
+func (p *WebhookRepository) ListDeliveries(ctx context.Context, tenant string, subID uuid.UUID, state string, limit, offset int) ([]WebhookDelivery, error) {
+	out := make([]WebhookDelivery, 0)
+	err := inTenant(ctx, p.pool, tenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id, subscription_id, event_id, event_type, state, attempts,
+			       next_attempt_at, last_status_code, last_error, created_at, delivered_at
+			FROM wb.webhook_deliveries
+			WHERE tenant_id = $1 AND subscription_id = $2 AND ($3 = '' OR state = $3)
+			ORDER BY id DESC
+			LIMIT $4 OFFSET $5
+		`, tenant, subID, state, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var d WebhookDelivery
+			if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.State, &d.Attempts,
+				&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+				return err
+			}
+			out = append(out, d)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ErrPrivateTarget — адрес подписчика ведёт внутрь: loopback, частная сеть, link-local и т.п.
+// Диспетчер ходит из кластера, и без этой проверки вебхук — способ просканировать соседей
+var ErrPrivateTarget = errors.New("webhook target is not a public address")
+
+// CGNAT (RFC 6598) IsPrivate не считает, а внутри облаков им адресуют вполне внутренние сервисы
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsValid() &&
+		!a.IsLoopback() && !a.IsPrivate() && !a.IsUnspecified() &&
+		!a.IsLinkLocalUnicast() && !a.IsLinkLocalMulticast() &&
+		!a.IsInterfaceLocalMulticast() && !a.IsMulticast() &&
+		!sharedAddressSpace.Contains(a)
+}
+
+// CheckTarget — проверка URL при регистрации: хост-литерал IP должен быть публичным, localhost нельзя.
+// Имена здесь не резолвим: DNS может ответить иначе к моменту доставки, это ловит диспетчер
+func CheckTarget(u *url.URL) error {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateTarget
+	}
+	if a, err := netip.ParseAddr(host); err == nil && !publicAddr(a) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
+
+// dialPublic резолвит хост сам и соединяется только с проверенным адресом: имя, которое
+// после регистрации стало указывать внутрь (DNS rebinding), до подписчика не дойдёт
+func dialPublic(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if !publicAddr(a) {
+				return nil, fmt.Errorf("%s: %w", host, ErrPrivateTarget)
+			}
+		}
+		var lastErr error
+		for _, a := range addrs {
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(a.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("%s: no addresses", host)
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,41 @@
+package webhooks
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestCheckTarget(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+	}{
+		{"https://hooks.example.com/orders", false},
+		{"http://93.184.216.34:8080/", false},
+		{"https://[2606:4700::1111]/", false},
+		{"http://localhost:9000/", true},
+		{"http://api.localhost./", true},
+		{"http://127.0.0.1/", true},
+		{"http://10.1.2.3/", true},
+		{"http://172.16.0.1/", true},
+		{"http://192.168.1.1/", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://100.64.0.1/", true},
+		{"http://0.0.0.0/", true},
+		{"http://[::1]/", true},
+		{"http://[fe80::1]/", true},
+		{"http://[fd00::1]/", true},
+		{"http://[::ffff:127.0.0.1]/", true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.url, err)
+		}
+		err = CheckTarget(u)
+		if got := errors.Is(err, ErrPrivateTarget); got != tt.private {
+			t.Errorf("CheckTarget(%q) = %v, want private=%v", tt.url, err, tt.private)
+		}
+	}
+}
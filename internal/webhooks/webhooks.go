@@ -0,0 +1,245 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/wb-orders-service/internal/application"
+	"github.com/RaikyD/wb-orders-service/internal/domain"
+	"github.com/RaikyD/wb-orders-service/internal/logger"
+	"github.com/RaikyD/wb-orders-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	pollInterval = time.Second
+	batchSize    = 50
+	workers      = 8
+	baseBackoff  = 10 * time.Second
+	maxBackoff   = time.Hour
+)
+
+// EventTypes — события, на которые можно подписаться
+var EventTypes = []string{application.EventOrderCreated, application.EventOrderStatusChanged}
+
+// Payload — тело, которое получает подписчик
+type Payload struct {
+	ID        uuid.UUID     `json:"id"`
+	Type      string        `json:"type"`
+	CreatedAt time.Time     `json:"created_at"`
+	Order     *domain.Order `json:"order"`
+}
+
+type Store interface {
+	EnqueueEvent(ctx context.Context, tenant string, eventID uuid.UUID, eventType string, payload []byte) (int64, error)
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]repository.WebhookJob, error)
+	MarkDelivered(ctx context.Context, j *repository.WebhookJob, status int) error
+	MarkFailed(ctx context.Context, j *repository.WebhookJob, status *int, errText string, nextAt *time.Time, disableAfter int) (bool, error)
+}
+
+type Config struct {
+	Timeout      time.Duration // на один HTTP-запрос к подписчику
+	MaxAge       time.Duration // после этого доставка считается проваленной
+	DisableAfter int           // столько ошибок подряд — и подписчик выключается
+}
+
+// Queue — application.EventSink, кладёт события в очередь доставок в Postgres;
+// заказ уходит только подписчикам его тенанта
+type Queue struct {
+	store Store
+	mask  func(*domain.Order) *domain.Order
+}
+
+// NewQueue — mask прячет персональные данные до записи в очередь (masking.Rules.Webhook);
+// nil — заказ уходит как есть
+func NewQueue(store Store, mask func(*domain.Order) *domain.Order) *Queue {
+	return &Queue{store: store, mask: mask}
+}
+
+func (q *Queue) Enqueue(ctx context.Context, typ string, o *domain.Order) error {
+	if q.mask != nil {
+		o = q.mask(o)
+	}
+	p := Payload{ID: uuid.New(), Type: typ, CreatedAt: time.Now().UTC(), Order: o}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = q.store.EnqueueEvent(ctx, o.Tenant, p.ID, typ, body)
+	return err
+}
+
+// Dispatcher забирает созревшие доставки и отправляет их подписчикам
+type Dispatcher struct {
+	store  Store
+	cfg    Config
+	client *http.Client
+}
+
+func NewDispatcher(store Store, cfg Config) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: publicTransport(),
+			// редирект — это ошибка конфигурации подписчика, а не повод слать подписанное тело куда-то ещё
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// publicTransport — как http.DefaultTransport, но без прокси из окружения (через него проверка
+// адреса теряет смысл) и с соединением только на публичные адреса, см. dialPublic
+func publicTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialPublic(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	return t
+}
+
+// Run крутится, пока жив ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	logger.Info("webhook dispatcher started", "max_age", d.cfg.MaxAge, "disable_after", d.cfg.DisableAfter)
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			// пока очередь не пуста — выгребаем без пауз
+			for ctx.Err() == nil {
+				if d.tick(ctx) < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) tick(ctx context.Context) int {
+	// lease с запасом на таймаут запроса, чтобы доставку не взяли повторно, пока мы её шлём
+	jobs, err := d.store.ClaimDue(ctx, batchSize, d.cfg.Timeout*2+time.Minute)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("webhook claim failed", "err", err)
+		}
+		return 0
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(j *repository.WebhookJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.deliver(ctx, j)
+		}(&jobs[i])
+	}
+	wg.Wait()
+	return len(jobs)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, j *repository.WebhookJob) {
+	status, err := d.send(ctx, j)
+
+	// результат пишем даже если ctx уже отменён — иначе попытка потеряется
+	wctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err == nil {
+		if err := d.store.MarkDelivered(wctx, j, status); err != nil {
+			logger.Warn("webhook mark delivered failed", "err", err, "delivery_id", j.ID)
+		}
+		return
+	}
+
+	var code *int
+	if status != 0 {
+		code = &status
+	}
+	next := nextAttempt(j.Attempts + 1)
+	nextAt := &next
+	if next.After(j.CreatedAt.Add(d.cfg.MaxAge)) {
+		nextAt = nil
+	}
+	disabled, merr := d.store.MarkFailed(wctx, j, code, err.Error(), nextAt, d.cfg.DisableAfter)
+	if merr != nil {
+		logger.Warn("webhook mark failed failed", "err", merr, "delivery_id", j.ID)
+		return
+	}
+	logger.Warn("webhook delivery failed",
+		"err", err, "delivery_id", j.ID, "subscription_id", j.SubscriptionID,
+		"attempt", j.Attempts+1, "gave_up", nextAt == nil)
+	if disabled {
+		logger.Warn("webhook subscription disabled", "subscription_id", j.SubscriptionID, "url", j.URL)
+	}
+}
+
+// send возвращает код ответа (0, если до ответа не дошло) и ошибку для всего, кроме 2xx
+func (d *Dispatcher) send(ctx context.Context, j *repository.WebhookJob) (int, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.URL, bytes.NewReader(j.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wb-orders-service-webhooks/1")
+	req.Header.Set(HeaderID, j.EventID.String())
+	req.Header.Set(HeaderEvent, j.EventType)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(j.Secret, ts, j.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign — подпись, которую проверяет подписчик:
+// hex(HMAC-SHA256(secret, timestamp + "." + body)) с префиксом "sha256=".
+// Timestamp в подписи не даёт переиграть старый запрос.
+func Sign(secret, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// nextAttempt — экспоненциальная пауза 10s, 20s, 40s... до часа, с джиттером ±20%
+func nextAttempt(attempt int) time.Time {
+	backoff := maxBackoff
+	if attempt < 20 {
+		backoff = min(baseBackoff<<(attempt-1), maxBackoff)
+	}
+	jitter := time.Duration((rand.Float64()*0.4 - 0.2) * float64(backoff))
+	return time.Now().Add(backoff + jitter)
+}